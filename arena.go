@@ -0,0 +1,68 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import "unsafe"
+
+const defaultArenaChunk = 64 << 10
+
+// Arena is a resettable allocator for decoded strings and byte slices. Values
+// decoded WithArena share its memory and must not be used after Reset.
+type Arena struct {
+	chunk int
+	bufs  [][]byte
+	i     int // current buffer
+	off   int // offset in the current buffer
+}
+
+func NewArena(chunkSize int) *Arena {
+	if chunkSize <= 0 {
+		chunkSize = defaultArenaChunk
+	}
+	return &Arena{chunk: chunkSize}
+}
+
+func (a *Arena) alloc(n int) []byte {
+	if n > a.chunk {
+		return make([]byte, n)
+	}
+	for ; a.i < len(a.bufs); a.i, a.off = a.i+1, 0 {
+		if a.off+n <= a.chunk {
+			p := a.bufs[a.i][a.off : a.off+n : a.off+n]
+			a.off += n
+			return p
+		}
+	}
+	a.bufs = append(a.bufs, make([]byte, a.chunk))
+	a.off = n
+	return a.bufs[a.i][:n:n]
+}
+
+// adopt takes over the used buffers of x, so they are reused after Reset.
+func (a *Arena) adopt(x *Arena) {
+	bufs := make([][]byte, 0, len(a.bufs)+len(x.bufs))
+	bufs = append(append(append(bufs, a.bufs[:a.i]...), x.bufs...), a.bufs[a.i:]...)
+	a.bufs, a.i = bufs, a.i+len(x.bufs)
+}
+
+// Reset makes all memory of the arena available for reuse.
+func (a *Arena) Reset() {
+	a.i, a.off = 0, 0
+}
+
+func (d *Decoder) alloc(n int) []byte {
+	if d.arena != nil {
+		return d.arena.alloc(n)
+	}
+	return make([]byte, n)
+}
+
+// string converts data returned by next without copying it when it is owned
+// by the arena or, in trusted mode, is either a fresh allocation or a part of the input
+func (d *Decoder) string(data []byte) string {
+	if d.arena != nil || d.trusted {
+		return *(*string)(unsafe.Pointer(&data))
+	}
+	return string(data)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestArena(t *testing.T) {
+	x := NewTestInputObject()
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewArena(64)
+	for i := 0; i < 3; i++ {
+		y := &TestInputObject{}
+		if err = Unmarshal(data, &y, WithArena(a)); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, x, y)
+		a.Reset()
+	}
+}
+
+func TestArenaParallel(t *testing.T) {
+	x := make([][]string, 8)
+	for i := range x {
+		for j := 0; j < 100; j++ {
+			x[i] = append(x[i], strings.Repeat("x", i+j))
+		}
+	}
+	vv := make([]interface{}, len(x))
+	for i := range x {
+		vv[i] = x[i]
+	}
+	data, err := Marshal(vv[0], vv[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewArena(64)
+	for i := 0; i < 3; i++ {
+		y := make([][]string, len(x))
+		for i := range y {
+			vv[i] = &y[i]
+		}
+		if err = Unmarshal(data, vv[0], append(vv[1:], WithArena(a), WithParallel())...); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, x, y)
+		a.Reset()
+	}
+}
+
+func TestArenaAllocs(t *testing.T) {
+	x := []string{"a", "bc", strings.Repeat("d", 100), ""}
+	data, err := Marshal(x, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocs := func(opts ...Option) float64 {
+		y := make([]string, len(x))
+		var z []byte
+		r := bytes.NewReader(data)
+		dec := NewDecoder(r, opts...)
+		n := testing.AllocsPerRun(100, func() {
+			if dec.arena != nil {
+				dec.arena.Reset()
+			}
+			r.Reset(data)
+			dec.Reset(r)
+			if err := dec.Decode(&y); err != nil {
+				t.Fatal(err)
+			}
+			if err := dec.Decode(&z); err != nil {
+				t.Fatal(err)
+			}
+		})
+		assertEqual(t, x, y)
+		assertEqual(t, []byte{1, 2, 3}, z)
+		return n
+	}
+	if n, m := allocs(), allocs(WithArena(NewArena(0))); m+float64(len(x)) > n {
+		t.Fatalf("%v vs %v allocations", n, m)
+	}
+}
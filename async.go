@@ -0,0 +1,90 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"io"
+	"sync"
+)
+
+const defaultAsyncSize = 1 << 20
+
+// asyncWriter fills one buffer while a background goroutine writes the other one to w
+type asyncWriter struct {
+	buf  []byte
+	full chan []byte
+	free chan []byte
+	done chan struct{}
+	mu   sync.Mutex
+	err  error
+}
+
+func newAsyncWriter(w io.Writer, size int) *asyncWriter {
+	if size <= 0 {
+		size = defaultAsyncSize
+	}
+	a := &asyncWriter{
+		buf:  make([]byte, 0, size),
+		full: make(chan []byte, 1),
+		free: make(chan []byte, 2),
+		done: make(chan struct{}),
+	}
+	a.free <- make([]byte, 0, size)
+	go func() {
+		defer close(a.done)
+		for p := range a.full {
+			if a.error() == nil {
+				if _, err := w.Write(p); err != nil {
+					a.mu.Lock()
+					a.err = err
+					a.mu.Unlock()
+				}
+			}
+			a.free <- p[:0]
+		}
+	}()
+	return a
+}
+
+func (a *asyncWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		m := copy(a.buf[len(a.buf):cap(a.buf)], p)
+		a.buf, p = a.buf[:len(a.buf)+m], p[m:]
+		if len(a.buf) == cap(a.buf) {
+			a.full <- a.buf
+			a.buf = <-a.free
+			if err := a.error(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the buffered data and waits for the background writes to complete
+func (a *asyncWriter) Flush() error {
+	if len(a.buf) > 0 {
+		a.full <- a.buf
+	} else {
+		a.free <- a.buf
+	}
+	a.buf = <-a.free
+	a.free <- <-a.free
+	return a.error()
+}
+
+func (a *asyncWriter) error() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Close flushes the writer and stops the background goroutine
+func (a *asyncWriter) Close() error {
+	err := a.Flush()
+	close(a.full)
+	<-a.done
+	return err
+}
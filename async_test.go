@@ -0,0 +1,65 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDumpAsyncWrite(t *testing.T) {
+	b := NewMemoryBackend()
+	x1 := NewTestInputObject()
+	x2 := NewTestInputArray()
+	if err := Dump("a.dat", x1, x2, WithBackend(b), WithCanonical()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Dump("b.dat", x1, x2, WithBackend(b), WithCanonical(), WithAsyncWrite(64)); err != nil {
+		t.Fatal(err)
+	}
+	if err := DumpAtomic("c.dat", x1, x2, WithBackend(b), WithCanonical(), WithAsyncWrite(0)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, b.files["a.dat"], b.files["b.dat"])
+	assertEqual(t, b.files["a.dat"], b.files["c.dat"])
+
+	y1 := &TestInputObject{}
+	y2 := &TestInputArray{}
+	if err := Load("b.dat", &y1, &y2, WithBackend(b)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x1, y1)
+	assertEqual(t, x2, y2)
+}
+
+type failingWriter struct {
+	n int
+}
+
+var errFailingWriter = errors.New("failing writer")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errFailingWriter
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestDumpAsyncWriteError(t *testing.T) {
+	x := NewTestInputArray()
+	for _, n := range []int{0, 1, 2} {
+		err := dumpWriter(&failingWriter{n: n}, []Option{WithAsyncWrite(16)}, func(enc *Encoder) error {
+			for i := 0; i < 10; i++ {
+				if err := enc.Encode(x); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != errFailingWriter {
+			t.Fatalf("write error should be returned after %d writes, got %v", n, err)
+		}
+	}
+}
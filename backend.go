@@ -0,0 +1,175 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Backend is the storage used by Dump and Load. Writers returned by Create
+// may implement Sync() error to support WithSync, readers returned by Open may
+// implement io.Seeker to let LoadNth seek to indexed values. Backends may implement
+// MkdirAll(dir string) error to create chunk directories for DumpChunked and
+// Append(name string) (io.WriteCloser, error) to let namespace containers grow in place.
+type Backend interface {
+	Create(name string) (io.WriteCloser, error)
+	Open(name string) (io.ReadCloser, error)
+	Rename(oldname, newname string) error
+	Remove(name string) error
+}
+
+var OSBackend Backend = osBackend{}
+
+type osBackend struct{}
+
+func (osBackend) Create(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+func (osBackend) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (osBackend) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (osBackend) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osBackend) Append(name string) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+}
+
+func (osBackend) SyncDir(dir string) error {
+	return syncDir(dir)
+}
+
+func (osBackend) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0755)
+}
+
+type MemoryBackend struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{files: make(map[string][]byte)}
+}
+
+type memoryFile struct {
+	bytes.Buffer
+	b      *MemoryBackend
+	name   string
+	append bool
+}
+
+func (f *memoryFile) Close() error {
+	f.b.mu.Lock()
+	if data := f.b.files[f.name]; f.append {
+		f.b.files[f.name] = append(data[:len(data):len(data)], f.Bytes()...)
+	} else {
+		f.b.files[f.name] = f.Bytes()
+	}
+	f.b.mu.Unlock()
+	return nil
+}
+
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error {
+	return nil
+}
+
+func (b *MemoryBackend) Create(name string) (io.WriteCloser, error) {
+	b.mu.Lock()
+	b.files[name] = nil
+	b.mu.Unlock()
+	return &memoryFile{b: b, name: name}, nil
+}
+
+func (b *MemoryBackend) Append(name string) (io.WriteCloser, error) {
+	return &memoryFile{b: b, name: name, append: true}, nil
+}
+
+func (b *MemoryBackend) Open(name string) (io.ReadCloser, error) {
+	b.mu.RLock()
+	data, ok := b.files[name]
+	b.mu.RUnlock()
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return memoryReader{bytes.NewReader(data)}, nil
+}
+
+func (b *MemoryBackend) Rename(oldname, newname string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	delete(b.files, oldname)
+	b.files[newname] = data
+	return nil
+}
+
+func (b *MemoryBackend) Remove(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(b.files, name)
+	return nil
+}
+
+func backendOf(o *options) Backend {
+	if o.backend == nil {
+		return OSBackend
+	}
+	return o.backend
+}
+
+func fileOptions(opts []Option) *options {
+	o := new(options)
+	o.apply(opts)
+	return o
+}
+
+func tempName(filename string) string {
+	return fmt.Sprintf("%s.tmp%d", filename, rand.Uint32())
+}
+
+func syncFile(w io.Writer) error {
+	if f, ok := w.(interface {
+		Sync() error
+	}); ok {
+		return f.Sync()
+	}
+	return nil
+}
+
+func syncParent(b Backend, filename string) error {
+	return syncDirOf(b, filepath.Dir(filename))
+}
+
+func syncDirOf(b Backend, dir string) error {
+	if s, ok := b.(interface {
+		SyncDir(dir string) error
+	}); ok {
+		return s.SyncDir(dir)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	b := NewMemoryBackend()
+
+	x1 := NewTestInputObject()
+	x2 := NewTestInputArray()
+	err := Dump("a.dat", WithBackend(b), WithIndex(), WithSync(), x1, x2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DumpAtomic("b.dat", WithBackend(b), x2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y1 := &TestInputObject{}
+	err = Load("a.dat", &y1, WithBackend(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x1, y1)
+
+	y2 := &TestInputArray{}
+	err = LoadNth("a.dat", 1, &y2, WithBackend(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x2, y2)
+
+	y2 = &TestInputArray{}
+	err = Load("b.dat", &y2, WithBackend(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x2, y2)
+	assertEqual(t, 2, len(b.files))
+
+	err = Load("c.dat", &y2, WithBackend(b))
+	if !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if err = b.Remove("c.dat"); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat("a.dat"); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryBackendSnapshot(t *testing.T) {
+	b := NewMemoryBackend()
+	s := NewSnapshotSaver("state.dat", 1, WithBackend(b))
+
+	for i := 1; i <= 3; i++ {
+		if err := s.Save(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertEqual(t, 2, len(b.files))
+
+	var y int
+	if err := s.Load(&y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 3, y)
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import "encoding/base64"
+
+// BinaryPolicy controls how the Decoder decodes binary values into interface{}. Strings are always
+// decoded as string, so with the default policy text and binary values stay distinguishable.
+type BinaryPolicy uint8
+
+const (
+	BinaryBytes  BinaryPolicy = iota // decode binary values as []byte
+	BinaryBase64                     // decode binary values as standard base64 strings, e.g. for JSON export
+)
+
+// binaryInterface returns binary data decoded into interface{} according to the policy
+func (d *Decoder) binaryInterface(data []byte) interface{} {
+	if d.binaryPolicy == BinaryBase64 {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return data
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+const binaryChunkSize = 64 << 10 // of binaries of unknown length written by BinaryWriter
+
+// binaryReader reads the remaining n bytes of a binary value, or chunks of a binary stream
+// if n < 0, from the input of a Decoder
+type binaryReader struct {
+	d *Decoder
+	n int64
+	i int // chunks read, if n < 0
+	c int // remaining bytes of the current chunk
+}
+
+func (r *binaryReader) Read(p []byte) (int, error) {
+	if r.n < 0 {
+		for r.c == 0 {
+			more, err := r.d.more(r.i, -1)
+			if err != nil {
+				return 0, err
+			} else if !more {
+				r.n = 0
+				return 0, io.EOF
+			}
+			r.i++
+			if r.c, err = r.d.readChunkHeader(); err != nil {
+				return 0, err
+			}
+		}
+		if len(p) > r.c {
+			p = p[:r.c]
+		}
+		n, err := r.d.r.Read(p)
+		r.c -= n
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.d.r.Read(p)
+	r.n -= int64(n)
+	if err == io.EOF && r.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// BinaryReader returns a reader of the next binary or string value and its length, or -1 for
+// binaries of unknown length, which lets large values be copied without holding them in memory.
+// The reader must be read to its end before decoding the following values.
+func (d *Decoder) BinaryReader() (io.Reader, int64, error) {
+	t, err := d.readType()
+	if err != nil {
+		return nil, 0, err
+	}
+	if tt := typeOf(t); tt != StringType && tt != BinaryType {
+		return nil, 0, &DecoderTypeError{tt.String(), reflect.TypeOf((*io.Reader)(nil)).Elem()}
+	}
+	n, err := d.readLength(t)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &binaryReader{d: d, n: int64(n)}, int64(n), nil
+}
+
+// readChunkHeader reads the type and length of a chunk of a binary stream
+func (d *Decoder) readChunkHeader() (int, error) {
+	t, err := d.readType()
+	if err != nil {
+		return 0, err
+	}
+	if typeOf(t) != BinaryType || t == tBinaryStream {
+		return 0, &DecoderError{fmt.Sprintf("binary chunk of type %#x", t)}
+	}
+	return d.readLength(t)
+}
+
+// readChunk appends the next chunk of a binary stream to buf
+func (d *Decoder) readChunk(buf []byte) ([]byte, error) {
+	p, err := d.r.peek(1)
+	if err != nil {
+		return buf, err
+	}
+	if typeOf(p[0]) != BinaryType || p[0] == tBinaryStream {
+		return buf, &DecoderError{fmt.Sprintf("binary chunk of type %#x", p[0])}
+	}
+	return d.readRaw(buf)
+}
+
+// readBinaryStream reads the data of chunks of a binary stream
+func (d *Decoder) readBinaryStream() ([]byte, error) {
+	data := []byte{}
+	for i := 0; ; i++ {
+		if more, err := d.more(i, -1); err != nil {
+			return nil, err
+		} else if !more {
+			return data, nil
+		}
+		n, err := d.readChunkHeader()
+		if err != nil {
+			return nil, err
+		}
+		p, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, p...)
+	}
+}
+
+func (d *Decoder) decodeBinaryStream(v reflect.Value) error {
+	data, err := d.readBinaryStream()
+	if err != nil {
+		return err
+	}
+	for v.Kind() == reflect.Ptr {
+		v = indirect(v)
+	}
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes(data)
+	case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		v.Set(reflect.ValueOf(d.binaryInterface(data)))
+	case v.Kind() == reflect.Struct && v.CanAddr():
+		if vb, ok := v.Addr().Interface().(encoding.BinaryUnmarshaler); ok {
+			return vb.UnmarshalBinary(data)
+		}
+		fallthrough
+	default:
+		return &DecoderTypeError{"binary", v.Type()}
+	}
+	return nil
+}
+
+// binaryWriter writes a binary value of n bytes, or chunks of a binary stream if n < 0
+type binaryWriter struct {
+	e   *Encoder
+	n   int64
+	buf []byte // of the current chunk
+	err error
+}
+
+func (w *binaryWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.n >= 0 {
+		if int64(len(p)) > w.n {
+			w.err = &EncoderError{fmt.Sprintf("binary value longer than declared by %d bytes", int64(len(p))-w.n)}
+			return 0, w.err
+		}
+		if w.err = w.e.writeRaw(p); w.err != nil {
+			return 0, w.err
+		}
+		w.n -= int64(len(p))
+		return len(p), nil
+	}
+
+	n := len(p)
+	for len(p) > 0 {
+		k := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf, p = w.buf[:len(w.buf)+k], p[k:]
+		if len(w.buf) == cap(w.buf) {
+			if w.err = w.e.EncodeBinary(w.buf); w.err != nil {
+				return n - len(p), w.err
+			}
+			w.buf = w.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+// Close ends the binary value, which fails if fewer bytes than declared were written.
+func (w *binaryWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.n > 0 {
+		w.err = &EncoderError{fmt.Sprintf("binary value shorter than declared by %d bytes", w.n)}
+		return w.err
+	}
+	w.err = &EncoderError{"binary value is closed"}
+	if w.n < 0 {
+		if len(w.buf) > 0 {
+			if err := w.e.EncodeBinary(w.buf); err != nil {
+				return err
+			}
+		}
+		return w.e.EncodeArrayEnd()
+	}
+	return nil
+}
+
+// BinaryWriter encodes data written to the returned writer as a binary value of n bytes, or of
+// unknown length if n < 0, which is written in chunks. Nothing else may be encoded until the
+// writer is closed.
+func (e *Encoder) BinaryWriter(n int64) (io.WriteCloser, error) {
+	if n < 0 {
+		if err := e.writeType(tBinaryStream); err != nil {
+			return nil, err
+		}
+		return &binaryWriter{e: e, n: -1, buf: make([]byte, 0, binaryChunkSize)}, nil
+	}
+	if int64(int(n)) != n {
+		return nil, &EncoderError{fmt.Sprintf("binary value of %d bytes", n)}
+	}
+	if err := e.writeLength('B', int(n)); err != nil {
+		return nil, err
+	}
+	return &binaryWriter{e: e, n: n}, nil
+}
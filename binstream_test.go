@@ -0,0 +1,153 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDecoderBinaryReader(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789"), 10000)
+	data, err := Marshal(blob, "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(bytes.NewReader(data))
+	r, n, err := dec.BinaryReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, int64(len(blob)), n)
+	var buf bytes.Buffer
+	if _, err = io.CopyBuffer(&buf, r, make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, blob, buf.Bytes())
+	s, err := dec.DecodeString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "next", s)
+
+	dec = NewDecoder(bytes.NewReader(data[:1000]))
+	if r, _, err = dec.BinaryReader(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(r); err != io.ErrUnexpectedEOF {
+		t.Fatal(err)
+	}
+
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.Skip()
+	if _, _, err = dec.BinaryReader(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = NewDecoder(bytes.NewReader([]byte{tTrue})).BinaryReader(); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestEncoderBinaryWriter(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789"), 20000)
+	for _, n := range []int64{int64(len(blob)), -1} {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		w, err := enc.BinaryWriter(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.CopyBuffer(w, bytes.NewReader(blob), make([]byte, 7777)); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = enc.Encode("next"); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		var y []byte
+		var s string
+		if err = Unmarshal(data, &y, &s); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, blob, y)
+		assertEqual(t, "next", s)
+
+		dec := NewDecoder(bytes.NewReader(data))
+		r, m, err := dec.BinaryReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, n, m)
+		p, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, blob, p)
+
+		dec = NewDecoder(bytes.NewReader(data))
+		if err = dec.Skip(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err = dec.DecodeString(); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, "next", s)
+
+		var c bytes.Buffer
+		if err = CopyValue(NewEncoder(&c), NewDecoder(bytes.NewReader(data))); err != nil {
+			t.Fatal(err)
+		}
+		y = nil
+		if err = Unmarshal(c.Bytes(), &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, blob, y)
+	}
+
+	enc := NewEncoder(new(bytes.Buffer))
+	w, err := enc.BinaryWriter(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("abcd")); err == nil {
+		t.FailNow()
+	}
+	w, _ = enc.BinaryWriter(3)
+	w.Write([]byte("ab"))
+	if err = w.Close(); err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	var y []byte
+	if err = Unmarshal([]byte{tBinaryStream, tString8, 1, 'a', tEnd}, &y); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestBinaryWriterStreamPolicy(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	w, err := enc.BinaryWriter(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("binary")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var x interface{}
+	if err = NewDecoder(&buf, WithBinaryPolicy(BinaryBase64)).Decode(&x); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "YmluYXJ5", x)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+type checkpoint struct {
+	depth     int
+	started   bool
+	counted   bool
+	remaining int
+}
+
+// Checkpoint marks the current position in the input, so values decoded after it can be
+// decoded again following Rollback. Input read after the checkpoint is buffered until
+// Rollback or Release. A new checkpoint releases the previous one.
+func (d *Decoder) Checkpoint() {
+	d.Release()
+	d.cp = &checkpoint{d.depth, d.started, d.counted, d.remaining}
+	d.r.recording = true
+}
+
+// Rollback rewinds the Decoder to the last checkpoint and removes it.
+func (d *Decoder) Rollback() error {
+	if d.cp == nil {
+		return &DecoderError{"rollback without checkpoint"}
+	}
+	r := d.r
+	r.buf = append(r.rec, r.buf...)
+	r.n -= int64(len(r.rec))
+	r.rec, r.recording = nil, false
+	d.depth, d.started, d.counted, d.remaining = d.cp.depth, d.cp.started, d.cp.counted, d.cp.remaining
+	d.cp = nil
+	return nil
+}
+
+// Release removes the last checkpoint, keeping the current position.
+func (d *Decoder) Release() {
+	if d.cp == nil {
+		return
+	}
+	r := d.r
+	if r.sum != nil {
+		r.sum.Write(r.rec)
+	}
+	r.rec, r.recording = nil, false
+	d.cp = nil
+}
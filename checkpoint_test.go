@@ -0,0 +1,47 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecoderCheckpoint(t *testing.T) {
+	data, err := Marshal(map[string]interface{}{"A": "x"}, 2, WithValueCount(), WithChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewDecoder(bytes.NewReader(data), WithChecksum())
+	dec.Checkpoint()
+	var x1 []int
+	if err = dec.Decode(&x1); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = dec.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, int64(0), dec.InputOffset())
+
+	dec.Checkpoint()
+	var x2 struct{ A string }
+	if err = dec.Decode(&x2); err != nil {
+		t.Fatal(err)
+	}
+	dec.Release()
+	assertEqual(t, "x", x2.A)
+
+	var n int
+	if err = dec.Decode(&n); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 2, n)
+	if err = dec.verifyChecksum(); err != nil {
+		t.Fatal(err)
+	}
+	if err = dec.Rollback(); err == nil {
+		t.Fatal("expected error")
+	}
+}
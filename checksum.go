@@ -0,0 +1,55 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+)
+
+func (e *Encoder) writeChecksum() error {
+	return e.writeRaw(append([]byte{tChecksum}, e.sum.Sum(nil)...))
+}
+
+// verifyChecksum consumes the rest of the stream and compares it against the checksum footer
+func (d *Decoder) verifyChecksum() error {
+	if d.r.sum == nil {
+		return nil
+	}
+	if err := d.readHeader(); err != nil {
+		return err
+	}
+	for {
+		p, err := d.r.peek(1)
+		if err == io.EOF {
+			return &DecoderError{"missing checksum"}
+		} else if err != nil {
+			return err
+		}
+		switch p[0] {
+		case tChecksum:
+			sum := d.r.sum.Sum(nil)
+			p, err := d.next(1 + sha256.Size)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return &DecoderError{"missing checksum"}
+			} else if err != nil {
+				return err
+			}
+			if !bytes.Equal(p[1:], sum) {
+				return &DecoderError{"checksum mismatch"}
+			}
+			d.r.sum = nil // verified
+			return nil
+		case tIndex:
+			if err = d.readIndexFooter(); err != nil {
+				return err
+			}
+		default:
+			if _, err = d.readRaw(nil); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDumpChecksum(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	x1 := NewTestInputObject()
+	x2 := NewTestInputArray()
+	err := Dump(fn, WithChecksum(), WithIndex(), x1, x2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y1 := &TestInputObject{}
+	err = Load(fn, &y1, WithChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x1, y1)
+
+	y2 := &TestInputArray{}
+	err = LoadNth(fn, 1, &y2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x2, y2)
+
+	var n int
+	err = LoadFunc(fn, func(dec *Decoder) error {
+		n++
+		return nil
+	}, WithChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 2, n)
+
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xFF
+	err = Unmarshal(data, &y1, WithChecksum())
+	if _, ok := err.(*DecoderError); !ok {
+		t.Fatal(err)
+	}
+	_ = err.Error()
+}
+
+func TestLoadMissingChecksum(t *testing.T) {
+	data, err := Marshal(1, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y int
+	err = Unmarshal(data, &y, WithChecksum())
+	if _, ok := err.(*DecoderError); !ok {
+		t.Fatal(err)
+	}
+	_ = err.Error()
+}
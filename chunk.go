@@ -0,0 +1,192 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const defaultChunkSize = 64 << 10
+
+// chunkManifest is the value dumped by DumpChunked in place of the values
+type chunkManifest struct {
+	Size   int64
+	Chunks [][]byte
+}
+
+// gear holds random values of bytes for content-defined chunking
+var gear [256]uint64
+
+func init() {
+	x := uint64(0x676f646174) // splitmix64, so that chunk boundaries never change
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		gear[i] = z ^ z>>31
+	}
+}
+
+// splitChunks splits data at content-defined boundaries into chunks of about size bytes
+func splitChunks(data []byte, size int) [][]byte {
+	bits := uint(1)
+	for 1<<bits < size {
+		bits++
+	}
+	mask := uint64(1)<<bits - 1<<(64-bits)
+	min, max := size/4, size*4
+
+	var chunks [][]byte
+	for len(data) > 0 {
+		n := len(data)
+		if n > max {
+			n = max
+		}
+		var h uint64
+		for i := min; i < n; i++ {
+			if h = h<<1 + gear[data[i]]; h&mask == 0 {
+				n = i + 1
+				break
+			}
+		}
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return chunks
+}
+
+func chunkDir(filename string, o *options) string {
+	if o.chunkDir != "" {
+		return o.chunkDir
+	}
+	return filepath.Join(filepath.Dir(filename), "chunks")
+}
+
+func chunkName(dir string, sum []byte) string {
+	return filepath.Join(dir, hex.EncodeToString(sum))
+}
+
+// storeChunk writes chunk into dir, unless a chunk with the same content is already there
+func storeChunk(b Backend, dir string, sum, chunk []byte, o *options) error {
+	name := chunkName(dir, sum)
+	if f, err := b.Open(name); err == nil {
+		return f.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	tmp := tempName(name)
+	f, err := b.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(chunk); err == nil && o.sync {
+		err = syncFile(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = b.Rename(tmp, name)
+	}
+	if err != nil {
+		b.Remove(tmp)
+	}
+	return err
+}
+
+// DumpChunked encodes values into content-defined chunks stored by their SHA-256 in the chunk
+// directory (see WithChunkDir), and atomically dumps a manifest of the chunks into filename.
+// Successive dumps share unchanged chunks; chunks no manifest refers to are never removed.
+func DumpChunked(filename string, v interface{}, vv ...interface{}) error {
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+	o := fileOptions(opts)
+
+	data, err := marshal(vv, opts)
+	if err != nil {
+		return err
+	}
+
+	b := backendOf(o)
+	dir := chunkDir(filename, o)
+	if m, ok := b.(interface {
+		MkdirAll(dir string) error
+	}); ok {
+		if err = m.MkdirAll(dir); err != nil {
+			return err
+		}
+	}
+	size := o.chunkSize
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	m := chunkManifest{Size: int64(len(data))}
+	for _, chunk := range splitChunks(data, size) {
+		sum := sha256.Sum256(chunk)
+		if err = storeChunk(b, dir, sum[:], chunk, o); err != nil {
+			return err
+		}
+		m.Chunks = append(m.Chunks, sum[:])
+	}
+	if o.sync {
+		if err = syncDirOf(b, dir); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := dumpTemp(filename, opts, func(enc *Encoder) error {
+		return enc.Encode(m)
+	})
+	if err != nil {
+		return err
+	}
+	return renameTemp(tmp, filename, opts)
+}
+
+// LoadChunked reads values dumped by DumpChunked, verifying every chunk against its hash.
+func LoadChunked(filename string, v interface{}, vv ...interface{}) error {
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+	o := fileOptions(opts)
+
+	var m chunkManifest
+	if err := load(filename, []interface{}{&m}, opts); err != nil {
+		return err
+	}
+	if o.maxTotalBytes > 0 && m.Size > o.maxTotalBytes {
+		return &DecoderError{fmt.Sprintf("chunked values of %d bytes exceed %d bytes", m.Size, o.maxTotalBytes)}
+	}
+
+	b := backendOf(o)
+	dir := chunkDir(filename, o)
+	var buf bytes.Buffer
+	for _, sum := range m.Chunks {
+		name := chunkName(dir, sum)
+		f, err := b.Open(name)
+		if err != nil {
+			return err
+		}
+		chunk, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if s := sha256.Sum256(chunk); !bytes.Equal(s[:], sum) {
+			return &DecoderError{fmt.Sprintf("chunk %s is corrupted", name)}
+		}
+		if int64(buf.Len()+len(chunk)) > m.Size {
+			return &DecoderError{fmt.Sprintf("chunks exceed %d bytes", m.Size)}
+		}
+		buf.Write(chunk)
+	}
+	if int64(buf.Len()) != m.Size {
+		return &DecoderError{fmt.Sprintf("chunks hold %d of %d bytes", buf.Len(), m.Size)}
+	}
+	return unmarshal(buf.Bytes(), vv, opts)
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDumpChunked(t *testing.T) {
+	b := NewMemoryBackend()
+	x := make([]string, 5000)
+	for i := range x {
+		x[i] = fmt.Sprintf("record %d", i)
+	}
+	opts := []interface{}{WithBackend(b), WithChunkSize(1024)}
+	if err := DumpChunked("a.dat", x, opts...); err != nil {
+		t.Fatal(err)
+	}
+	n := len(b.files)
+	if n < 20 {
+		t.Fatalf("%d files are not chunked", n)
+	}
+
+	// an insertion shifts the following bytes, but only changes nearby chunks
+	x = append(x[:100], append([]string{"inserted"}, x[100:]...)...)
+	if err := DumpChunked("b.dat", x, opts...); err != nil {
+		t.Fatal(err)
+	}
+	if added := len(b.files) - n; added > 4 {
+		t.Fatalf("%d files are added", added)
+	}
+
+	var y []string
+	if err := LoadChunked("b.dat", &y, opts...); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+
+	var m chunkManifest
+	if err := Load("a.dat", &m, WithBackend(b)); err != nil {
+		t.Fatal(err)
+	}
+	name := chunkName("chunks", m.Chunks[0])
+	b.files[name] = append(b.files[name][:0:0], 'x')
+	if err := LoadChunked("a.dat", &y, opts...); err == nil {
+		t.Fatal("corrupted chunk should not load")
+	}
+}
+
+func TestDumpChunkedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	x := NewTestInputObject()
+	filename := filepath.Join(dir, "state.dat")
+	if err = DumpChunked(filename, x, WithChunkDir(filepath.Join(dir, "store")), WithSync()); err != nil {
+		t.Fatal(err)
+	}
+	y := &TestInputObject{}
+	if err = LoadChunked(filename, &y, WithChunkDir(filepath.Join(dir, "store"))); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+// Command godat provides tools for the godat format.
+//
+// Usage:
+//
+//	godat vectors    write the conformance corpus as JSON to stdout
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/lokhman/godat"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: godat vectors")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "vectors":
+		w := bufio.NewWriter(os.Stdout)
+		if err := godat.WriteConformanceVectors(w); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := w.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import "reflect"
+
+// Coercion converts value x decoded from the wire into a value of the target type.
+type Coercion func(x interface{}) (interface{}, error)
+
+type coercionKey struct {
+	from Type
+	to   reflect.Type
+}
+
+// WithCoercion makes the Decoder convert values of wire type from with fn, whenever they
+// are decoded into values of the same type as to, e.g. strings into time.Time{}.
+func WithCoercion(from Type, to interface{}, fn Coercion) Option {
+	t := reflect.TypeOf(to)
+	if t == nil {
+		panic("godat: WithCoercion nil value")
+	}
+	return func(o *options) {
+		m := make(map[coercionKey]Coercion, len(o.coercions)+1)
+		for k, v := range o.coercions {
+			m[k] = v // options may be shared between decoders
+		}
+		m[coercionKey{from, t}] = fn
+		o.coercions = m
+	}
+}
+
+func newCoercingDecoder(t reflect.Type, dec decoderFunc) decoderFunc {
+	return func(d *Decoder, tt byte, v reflect.Value) error {
+		if d.coercions == nil {
+			return dec(d, tt, v)
+		}
+		fn, ok := d.coercions[coercionKey{typeOf(tt), t}]
+		if !ok {
+			return dec(d, tt, v)
+		}
+
+		var x interface{}
+		if err := d.decodeType(tt, reflect.ValueOf(&x).Elem()); err != nil {
+			return err
+		}
+		y, err := fn(x)
+		if err != nil {
+			return err
+		}
+		if y == nil {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		yv := reflect.ValueOf(y)
+		if !yv.Type().AssignableTo(t) {
+			return &DecoderTypeError{typeOf(tt).String(), t}
+		}
+		v.Set(yv)
+		return nil
+	}
+}
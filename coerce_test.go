@@ -0,0 +1,59 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodeCoercion(t *testing.T) {
+	opts := []interface{}{
+		WithCoercion(StringType, time.Time{}, func(x interface{}) (interface{}, error) {
+			return time.Parse(time.RFC3339, x.(string))
+		}),
+		WithCoercion(IntType, false, func(x interface{}) (interface{}, error) {
+			return x.(int64) != 0, nil
+		}),
+	}
+	data, err := Marshal(map[string]interface{}{
+		"At":   "2018-03-01T10:00:00Z",
+		"Next": "2018-03-02T10:00:00Z",
+		"On":   1,
+		"Tags": []int{0, 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var x struct {
+		At   time.Time
+		Next *time.Time
+		On   bool
+		Tags []bool
+	}
+	if err = Unmarshal(data, &x); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = Unmarshal(data, &x, opts[0], opts[1]); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC), x.At)
+	assertEqual(t, time.Date(2018, 3, 2, 10, 0, 0, 0, time.UTC), *x.Next)
+	assertEqual(t, true, x.On)
+	assertEqual(t, []bool{false, true}, x.Tags)
+
+	data, _ = Marshal("yesterday")
+	if err = Unmarshal(data, &x.At, opts[0]); err == nil {
+		t.Fatal("expected error")
+	}
+
+	bad := WithCoercion(StringType, 0, func(x interface{}) (interface{}, error) {
+		return x, nil
+	})
+	var n int
+	if err = Unmarshal(data, &n, bad); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+)
+
+// compressedValue wraps the value of a compressed field among the fields of canonical objects
+type compressedValue struct {
+	v reflect.Value
+}
+
+var compressedValueType = reflect.TypeOf(compressedValue{})
+
+func compressedEncoder(e *Encoder, v reflect.Value) error {
+	f := v.Interface().(compressedValue).v
+	return e.encodeCompressed(f, typeEncoder(f.Type()))
+}
+
+// fieldCompressed reports whether the value f of field sf is compressed
+func (e *Encoder) fieldCompressed(sf field, f reflect.Value) bool {
+	if sf.compress {
+		return true
+	}
+	if e.compressThreshold <= 0 {
+		return false
+	}
+	switch {
+	case f.Kind() == reflect.String:
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8:
+	default:
+		return false
+	}
+	return f.Len() > e.compressThreshold
+}
+
+// encodeCompressed encodes v with enc and compresses the result, unless that does not make it shorter
+func (e *Encoder) encodeCompressed(v reflect.Value, enc encoderFunc) error {
+	var buf, z bytes.Buffer
+	if err := enc(e.clone(&buf), v); err != nil {
+		return err
+	}
+	w, _ := flate.NewWriter(&z, flate.DefaultCompression)
+	w.Write(buf.Bytes())
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if z.Len() >= buf.Len() {
+		return e.writeRaw(buf.Bytes())
+	}
+	if err := e.writeLength('P', z.Len()); err != nil {
+		return err
+	}
+	return e.writeRaw(z.Bytes())
+}
+
+// inflate reads n bytes of compressed data and returns them decompressed
+func (d *Decoder) inflate(n int) ([]byte, error) {
+	p, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	r := io.Reader(flate.NewReader(bytes.NewReader(p)))
+	if d.maxTotalBytes > 0 {
+		r = io.LimitReader(r, d.maxTotalBytes-d.total+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, &DecoderError{fmt.Sprintf("invalid compressed value: %v", err)}
+	}
+	if err = d.charge(len(data), 1); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// withData runs fn reading from data at input offset n instead of the input
+func (d *Decoder) withData(data []byte, n int64, fn func() error) error {
+	r := d.r
+	d.r = &peekReader{r: &sliceReader{data}, n: n}
+	err := fn()
+	d.r = r
+	return err
+}
+
+func (d *Decoder) decodeCompressed(v reflect.Value, n int) error {
+	data, err := d.inflate(n)
+	if err != nil {
+		return err
+	}
+	return d.withData(data, d.r.n, func() error {
+		t, err := d.readType()
+		if err != nil {
+			return err
+		}
+		return typeDecoder(v.Type())(d, t, v)
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type testDocument struct {
+	Name string
+	Body string   `godat:",compress"`
+	Tags []string `godat:",compress"`
+	Blob []byte
+}
+
+func TestCompressedFields(t *testing.T) {
+	x := testDocument{
+		Name: strings.Repeat("n", 100),
+		Body: strings.Repeat("lorem ipsum ", 1000),
+		Tags: []string{"a"},
+		Blob: bytes.Repeat([]byte{1}, 1000),
+	}
+	for _, opts := range [][]interface{}{nil, {WithCanonical()}} {
+		data, err := Marshal(x, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 1300 {
+			t.Fatalf("body is not compressed into %d bytes", len(data))
+		}
+		if !bytes.Contains(data, []byte{tArray8, 1, tString8, 1, 'a'}) {
+			t.Fatal("tags are compressed")
+		}
+		var y testDocument
+		if err = Unmarshal(data, &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, x, y)
+
+		var z map[string]interface{}
+		if err = Unmarshal(data, &z); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, x.Body, z["Body"])
+
+		var buf bytes.Buffer
+		if err = CopyValue(NewEncoder(&buf), NewDecoder(bytes.NewReader(data))); err != nil {
+			t.Fatal(err)
+		}
+		if err = Unmarshal(buf.Bytes(), &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, x, y)
+	}
+
+	data, err := Marshal(x, WithCompressThreshold(500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 300 {
+		t.Fatalf("blob is not compressed into %d bytes", len(data))
+	}
+	var y testDocument
+	if err = Unmarshal(data, &y, WithMaxTotalBytes(5000)); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+func CopyValue(dst *Encoder, src *Decoder) error {
+	return src.topLevel(func() error {
+		return copyValue(dst, src)
+	})
+}
+
+func copyValue(dst *Encoder, src *Decoder) error {
+	t, err := src.readType()
+	if err != nil {
+		return err
+	}
+	switch typeOf(t) {
+	case NilType:
+		return dst.EncodeNil()
+	case BoolType:
+		return dst.EncodeBool(t == tTrue)
+	case IntType, UintType, FloatType:
+		n, err := src.readNumber(t)
+		if err != nil {
+			return err
+		}
+		return dst.EncodeNumber(n)
+	case StringType, BinaryType:
+		n, err := src.readLength(t)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			p, err := src.readBinaryStream()
+			if err != nil {
+				return err
+			}
+			return dst.EncodeBinary(p)
+		}
+		p, err := src.next(n)
+		if err != nil {
+			return err
+		}
+		if typeOf(t) == StringType {
+			return dst.EncodeString(string(p))
+		}
+		return dst.EncodeBinary(p)
+	case ArrayType:
+		n, err := src.readSize(t)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			if err = dst.EncodeArrayStart(); err != nil {
+				return err
+			}
+		} else if err = dst.EncodeArrayHeader(n); err != nil {
+			return err
+		}
+		for i := 0; ; i++ {
+			if more, err := src.more(i, n); err != nil || !more {
+				if err == nil && n < 0 {
+					err = dst.EncodeArrayEnd()
+				}
+				return err
+			}
+			if err = copyValue(dst, src); err != nil {
+				return err
+			}
+		}
+	case ObjectType:
+		n, err := src.readSize(t)
+		if err != nil {
+			return err
+		}
+		if dst.canonical {
+			return copyCanonicalObject(dst, src, n)
+		}
+		if err = dst.EncodeObjectHeader(n); err != nil {
+			return err
+		}
+		for i := 0; i < 2*n; i++ {
+			if err = copyValue(dst, src); err != nil {
+				return err
+			}
+		}
+		return nil
+	case SetType:
+		if err = dst.writeType(tSet); err != nil {
+			return err
+		}
+		if !dst.canonical {
+			return copyValue(dst, src)
+		}
+		t, err := src.readType()
+		if err != nil {
+			return err
+		}
+		if typeOf(t) != ArrayType || t == tArrayStream {
+			return &DecoderError{fmt.Sprintf("set of %s", typeOf(t))}
+		}
+		n, err := src.readSize(t)
+		if err != nil {
+			return err
+		}
+		if err = dst.EncodeArrayHeader(n); err != nil {
+			return err
+		}
+		x := make([][]byte, 0, preallocLen(n, bytesType))
+		for i := 0; i < n; i++ {
+			var kb bytes.Buffer
+			if err = copyKey(dst.clone(&kb), src); err != nil {
+				return err
+			}
+			x = append(x, kb.Bytes())
+		}
+		return dst.writeSet(x)
+	case UnionType:
+		if err = dst.writeType(tUnion); err != nil {
+			return err
+		}
+		if err = copyValue(dst, src); err != nil {
+			return err
+		}
+		return copyValue(dst, src)
+	case TensorType:
+		t, err := src.readTensor()
+		if err != nil {
+			return err
+		}
+		return dst.EncodeTensor(t)
+	case TimeType:
+		t, err := src.readTime()
+		if err != nil {
+			return err
+		}
+		return dst.EncodeTime(t)
+	case CompressedType:
+		n, err := src.readLength(t)
+		if err != nil {
+			return err
+		}
+		data, err := src.inflate(n)
+		if err != nil {
+			return err
+		}
+		return src.withData(data, src.r.n, func() error {
+			return copyValue(dst, src)
+		})
+	case RefType:
+		p, n, err := src.readRef(src.r.n - 1)
+		if err != nil {
+			return err
+		}
+		return src.withData(p, n, func() error {
+			return copyValue(dst, src)
+		})
+	case FieldNameType:
+		var h uint32
+		if err = src.read(&h); err != nil {
+			return err
+		}
+		name, err := src.readFieldName(t, h)
+		if err != nil {
+			return err
+		}
+		return src.withData(name, src.r.n, func() error {
+			return copyValue(dst, src)
+		})
+	case ExtType:
+		var x Ext
+		if err = src.decodeType(t, reflect.ValueOf(&x).Elem()); err != nil {
+			return err
+		}
+		return dst.EncodeExt(x)
+	}
+	return &DecoderError{fmt.Sprintf("invalid type %#x", t)}
+}
+
+// copyKey copies a key of a canonical object, narrowing its number like Encoder.encodeKey
+func copyKey(dst *Encoder, src *Decoder) error {
+	p, err := src.r.peek(1)
+	if err != nil {
+		return err
+	}
+	switch typeOf(p[0]) {
+	case IntType, UintType, FloatType:
+		t, err := src.readType()
+		if err != nil {
+			return err
+		}
+		n, err := src.readNumber(t)
+		if err != nil {
+			return err
+		}
+		return dst.encodeNarrowNumber(n)
+	}
+	return copyValue(dst, src)
+}
+
+var encodedEntryType = reflect.TypeOf([2][]byte{})
+
+func copyCanonicalObject(dst *Encoder, src *Decoder, n int) error {
+	x := make(encodedEntries, 0, preallocLen(n, encodedEntryType))
+	for i := 0; i < n; i++ {
+		var kb, vb bytes.Buffer
+		if err := copyKey(dst.clone(&kb), src); err != nil {
+			return err
+		}
+		if err := copyValue(dst.clone(&vb), src); err != nil {
+			return err
+		}
+		x = append(x, [2][]byte{kb.Bytes(), vb.Bytes()})
+	}
+	return dst.writeEntries(x)
+}
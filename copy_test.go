@@ -0,0 +1,107 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCopyValue(t *testing.T) {
+	x := NewTestInput()
+	data, err := Marshal(x, TestInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	dec := NewDecoder(bytes.NewReader(data))
+	for {
+		if err = CopyValue(enc, dec); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertEqual(t, data, buf.Bytes())
+
+	y := &TestInput{}
+	var y2 int
+	err = Unmarshal(buf.Bytes(), &y, &y2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x, y)
+	assertEqual(t, TestInt, y2)
+}
+
+func TestCopyValueReframe(t *testing.T) {
+	x := map[string]interface{}{"b": "x", "a": []byte{1}, "c": []interface{}{true, false, nil}, "d": int16(1)}
+	data, err := Marshal(x, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// oversized length headers and unsorted keys are normalized
+	raw := []byte{tObject32, 0, 0, 0, 2, tString16, 0, 1, 'b', tString32, 0, 0, 0, 1, 'x', tString8, 1, 'a', tBinary16, 0, 1, 1}
+	buf := new(bytes.Buffer)
+	err = CopyValue(NewEncoder(buf, WithCanonical()), NewDecoder(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := Marshal(map[string]interface{}{"b": "x", "a": []byte{1}}, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, expected, buf.Bytes())
+
+	buf.Reset()
+	err = CopyValue(NewEncoder(buf, WithCanonical()), NewDecoder(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data, buf.Bytes())
+}
+
+func TestCopyValueError(t *testing.T) {
+	data, err := Marshal([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CopyValue(NewEncoder(new(bytes.Buffer)), NewDecoder(bytes.NewReader(data[:len(data)-1])))
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	data, err = Marshal([]interface{}{1, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] = 0xff // not a type
+	err = CopyValue(NewEncoder(new(bytes.Buffer)), NewDecoder(bytes.NewReader(data)))
+	if _, ok := err.(*DecoderError); !ok {
+		t.Fatalf("%T: %v", err, err)
+	}
+
+	for _, data := range [][]byte{
+		{tObject32, 0x7f, 0xff, 0xff, 0xff},
+		{tSet, tArray32, 0x7f, 0xff, 0xff, 0xff},
+	} {
+		err = CopyValue(NewEncoder(new(bytes.Buffer), WithCanonical()), NewDecoder(bytes.NewReader(data)))
+		if _, ok := err.(*DecoderLengthError); !ok {
+			t.Fatalf("%T: %v", err, err)
+		}
+		// lengths of unknown input are not preallocated
+		err = CopyValue(NewEncoder(new(bytes.Buffer), WithCanonical()), NewDecoder(bufio.NewReader(bytes.NewReader(data))))
+		if err == nil {
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// EncodeCSV writes a slice of structs with scalar fields as CSV, with a header row of
+// field names that follow the same tags and options as encoding. Nil pointers are written
+// as empty cells.
+func EncodeCSV(w io.Writer, slice interface{}, opts ...Option) error {
+	v := reflect.ValueOf(slice)
+	t, err := columnsElem(v.Type())
+	if err != nil {
+		return err
+	}
+	o := fileOptions(opts)
+	var fields []field
+	var header []string
+	for _, sf := range structInfoOf(t).fields {
+		if !o.fieldSkipped(sf) {
+			fields = append(fields, sf)
+			header = append(header, o.fieldName(sf))
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if err = cw.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(fields))
+	for i := 0; i < v.Len(); i++ {
+		row := reflect.Indirect(v.Index(i))
+		for j, sf := range fields {
+			if !row.IsValid() {
+				record[j] = ""
+				continue
+			}
+			f := row.Field(sf.index)
+			if f.Kind() == reflect.Ptr && f.IsNil() {
+				record[j] = ""
+				continue
+			}
+			f = reflect.Indirect(f)
+			if f.Kind() == reflect.String {
+				record[j] = f.String()
+			} else if s, ok := stringValue(f); ok {
+				record[j] = s.String()
+			} else {
+				return &EncoderError{fmt.Sprintf("unsupported type %s in field %s.%s", f.Type(), t, t.Field(sf.index).Name)}
+			}
+		}
+		if err = cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// DecodeCSV reads CSV with a header row into the slice of structs pointed to by slice,
+// see EncodeCSV. Columns without a matching field are ignored.
+func DecodeCSV(r io.Reader, slice interface{}, opts ...Option) error {
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return &DecoderError{fmt.Sprintf("non-pointer %T", slice)}
+	}
+	v = v.Elem()
+	t, err := columnsElem(v.Type())
+	if err != nil {
+		return err
+	}
+
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	o := fileOptions(opts)
+	si := structInfoOf(t)
+	index := make([]int, len(header))
+	for j, name := range header {
+		index[j] = -1
+		if sf, ok := si.lookup(o, name); ok {
+			index[j] = sf.index
+		}
+	}
+
+	v.SetLen(0)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		row := reflect.New(t)
+		for j, s := range record {
+			if index[j] < 0 {
+				continue
+			}
+			f := row.Elem().Field(index[j])
+			if f.Kind() == reflect.Ptr {
+				if s == "" {
+					continue
+				}
+				f = indirect(f)
+			}
+			if f.Kind() == reflect.String {
+				f.SetString(s)
+			} else if !parseScalar(f, s) {
+				line, _ := cr.FieldPos(j)
+				return &DecoderError{fmt.Sprintf("invalid %s value %q in line %d, column %q", f.Type(), s, line, header[j])}
+			}
+		}
+		if v.Type().Elem().Kind() != reflect.Ptr {
+			row = row.Elem()
+		}
+		v.Set(reflect.Append(v, row))
+	}
+}
+
+func columnsElem(t reflect.Type) (reflect.Type, error) {
+	if t.Kind() == reflect.Slice {
+		e := t.Elem()
+		if e.Kind() == reflect.Ptr {
+			e = e.Elem()
+		}
+		if e.Kind() == reflect.Struct {
+			return e, nil
+		}
+	}
+	return nil, &EncoderError{fmt.Sprintf("unsupported type %s, slice of structs expected", t)}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	one := 1.5
+	type row struct {
+		ID    int    `godat:"id"`
+		Name  string `godat:"name"`
+		Score *float64
+		OK    bool
+	}
+	x := []row{{1, "a, b", &one, true}, {2, "c", nil, false}}
+
+	buf := new(bytes.Buffer)
+	if err := EncodeCSV(buf, x); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "id,name,Score,OK\n1,\"a, b\",1.5,true\n2,c,,false\n", buf.String())
+
+	var y []row
+	if err := DecodeCSV(buf, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+
+	if err := DecodeCSV(strings.NewReader("id\nx\n"), &y); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := EncodeCSV(buf, []struct{ A []int }{{}}); err == nil {
+		t.Fatal("expected error")
+	}
+}
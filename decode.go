@@ -4,14 +4,22 @@
 package godat
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding"
 	"encoding/binary"
 	"fmt"
+	"hash"
 	"io"
+	"math"
 	"reflect"
 	"strconv"
+	"time"
+	"unicode/utf8"
 )
 
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
 type DecoderError struct {
 	ErrorString string
 }
@@ -29,28 +37,419 @@ func (e DecoderTypeError) Error() string {
 	return fmt.Sprintf("godat: cannot unmarshal %s into Go value of type %s", e.Value, e.Type.String())
 }
 
+// DecoderLengthError reports a length prefix that does not fit into int.
+type DecoderLengthError struct {
+	Type   Type
+	Length uint64
+}
+
+func (e DecoderLengthError) Error() string {
+	return fmt.Sprintf("godat: %s length %d out of range", e.Type, e.Length)
+}
+
+// DecoderKeyError reports a decoded map key that could never be looked up, such as NaN.
+type DecoderKeyError struct {
+	Key  string
+	Type reflect.Type
+}
+
+func (e DecoderKeyError) Error() string {
+	return fmt.Sprintf("godat: invalid map key %s of type %s", e.Key, e.Type.String())
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// maxPrealloc bounds the bytes allocated up front for lengths read from the input, so that
+// larger values grow as they are read and lengths beyond the input fail at its end
+const maxPrealloc = 1 << 20
+
+func checkDecodedLength(t byte, n uint64) (int, error) {
+	if n > uint64(maxInt) {
+		return 0, &DecoderLengthError{typeOf(t), n}
+	}
+	return int(n), nil
+}
+
+// remaining returns the number of input bytes left to read, if it is known
+func (d *Decoder) inputLeft() (int, bool) {
+	if r, ok := d.r.r.(interface {
+		Len() int
+	}); ok {
+		return len(d.r.buf) + r.Len(), true
+	}
+	return 0, false
+}
+
+type peekReader struct {
+	r   io.Reader
+	buf []byte // bytes peeked but not consumed yet
+	n   int64  // bytes consumed
+	sum hash.Hash
+	rec []byte // bytes consumed since a checkpoint, if recording
+
+	recording bool
+}
+
+func (r *peekReader) Read(p []byte) (int, error) {
+	if len(r.buf) > 0 {
+		n := copy(p, r.buf)
+		r.buf = r.buf[n:]
+		r.consume(p[:n])
+		return n, nil
+	}
+	n, err := r.r.Read(p)
+	r.consume(p[:n])
+	return n, err
+}
+
+func (r *peekReader) consume(p []byte) {
+	r.n += int64(len(p))
+	if r.recording {
+		r.rec = append(r.rec, p...) // hashed on release
+	} else if r.sum != nil {
+		r.sum.Write(p)
+	}
+}
+
+func (r *peekReader) peek(n int) ([]byte, error) {
+	if m := len(r.buf); m < n {
+		buf := make([]byte, n)
+		copy(buf, r.buf)
+		k, err := io.ReadFull(r.r, buf[m:])
+		r.buf = buf[:m+k]
+		if err != nil {
+			if err == io.EOF && m > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return r.buf, err
+		}
+	}
+	return r.buf[:n], nil
+}
+
 type Decoder struct {
-	r io.Reader
+	r *peekReader
+	options
+
+	depth     int
+	started   bool  // stream header has been inspected
+	herr      error // of reading the stream header
+	le        bool  // values are little-endian
+	version   int   // format version of the stream header, if any
+	counted   bool
+	remaining int
+	total     int64    // bytes allocated for the current top-level value
+	path      []string // location of the current value, tracked for soft errors
+	errs      DecodeErrors
+	cp        *checkpoint
+
+	dedup    bool   // values may hold back-references
+	refs     []byte // current value, when decoding back-references
+	refBase  int64  // input offset of refs
+	replayed int64  // bytes decoded again through back-references
+
+	names   map[uint32][]byte // encoded field names of hashes defined in the stream
+	written map[uint32]bool   // field names copied by readRaw, when defining them on first use
+}
+
+func NewDecoder(r io.Reader, opts ...Option) *Decoder {
+	d := &Decoder{}
+	d.apply(opts)
+	d.Reset(r)
+	return d
+}
+
+type closedReader struct{}
+
+func (closedReader) Read(p []byte) (int, error) {
+	return 0, &DecoderError{"read from closed decoder"}
+}
+
+func (d *Decoder) Reset(r io.Reader) {
+	d.r = &peekReader{r: r}
+	d.depth, d.started, d.counted, d.remaining, d.herr = 0, false, false, 0, nil
+	d.le, d.version, d.dedup = d.littleEndian, 0, d.options.dedup
+	d.cp, d.names = nil, nil
+	if d.checksum {
+		d.r.sum = sha256.New()
+	}
+}
+
+func (d *Decoder) readHeader() error {
+	if d.started {
+		return d.herr
+	}
+	d.started = true
+	d.herr = d.readStreamHeader()
+	return d.herr
+}
+
+func (d *Decoder) readStreamHeader() error {
+	p, err := d.r.peek(1)
+	if err != nil {
+		return nil // reported by the following read
+	}
+	for p[0] == tVersion || p[0] == tLittleEndian || p[0] == tRefs {
+		t, err := d.readType()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case tVersion:
+			if err = d.readVersion(); err != nil {
+				return err
+			}
+		case tLittleEndian:
+			d.le = true
+		case tRefs:
+			d.dedup = true
+		}
+		if p, err = d.r.peek(1); err != nil {
+			return nil
+		}
+	}
+	switch p[0] {
+	case tCount8, tCount16, tCount32:
+		t, err := d.readType()
+		if err != nil {
+			return err
+		}
+		var n uint64
+		switch t {
+		case tCount8:
+			var x uint8
+			err = d.read(&x)
+			n = uint64(x)
+		case tCount16:
+			var x uint16
+			err = d.read(&x)
+			n = uint64(x)
+		default:
+			var x uint32
+			err = d.read(&x)
+			n = uint64(x)
+		}
+		if err != nil {
+			return err
+		}
+		d.counted, d.remaining = true, int(n)
+	}
+	return nil
+}
+
+func (d *Decoder) Remaining() (int, bool) {
+	if err := d.readHeader(); err != nil {
+		return 0, false
+	}
+	return d.remaining, d.counted
+}
+
+// topLevel wraps decoding of a single top-level value with value count accounting
+func (d *Decoder) topLevel(fn func() error) error {
+	if d.depth > 0 {
+		return fn()
+	}
+	if err := d.readHeader(); err != nil {
+		return err
+	}
+	if d.counted && d.remaining == 0 {
+		return io.EOF
+	}
+	err := error(io.EOF)
+	if !d.atFooter() {
+		d.total, d.path, d.errs = 0, d.path[:0], nil
+		d.depth++
+		n := d.r.n
+		run := fn
+		if d.dedup {
+			run = func() error { return d.decodeRefs(fn) }
+		}
+		if d.metrics == nil {
+			err = run()
+		} else {
+			start := time.Now()
+			err = run()
+			d.metrics.Decoded(d.r.n-n, time.Since(start), err)
+		}
+		d.depth--
+		if err == io.EOF && d.r.n > n && !d.counted {
+			err = io.ErrUnexpectedEOF // the stream ends inside the value
+		}
+	}
+	if d.counted && err == nil {
+		d.remaining--
+	}
+	if err == nil && d.errs != nil {
+		err, d.errs = d.errs, nil
+	}
+	return d.truncated(err)
+}
+
+func (d *Decoder) truncated(err error) error {
+	if err == io.EOF && d.counted && d.remaining > 0 {
+		return &DecoderError{fmt.Sprintf("truncated stream: %d values missing", d.remaining)}
+	}
+	return err
+}
+
+// atFooter reports whether the stream continues with an index or checksum footer
+func (d *Decoder) atFooter() bool {
+	p, err := d.r.peek(1)
+	return err == nil && (p[0] == tIndex || p[0] == tChecksum)
+}
+
+// charge accounts for n items of the given size against the MaxTotalBytes budget
+func (d *Decoder) charge(n int, size uintptr) error {
+	if d.maxTotalBytes <= 0 {
+		return nil
+	}
+	d.total += int64(n) * int64(size)
+	if d.total > d.maxTotalBytes {
+		return &DecoderError{fmt.Sprintf("decoded data exceeds budget of %d bytes", d.maxTotalBytes)}
+	}
+	return nil
+}
+
+func (d *Decoder) InputOffset() int64 {
+	return d.r.n
+}
+
+// Buffered returns the data read from the input but not decoded yet, which precedes the rest of
+// the input when handing the stream over, e.g. io.MultiReader(d.Buffered(), r).
+func (d *Decoder) Buffered() io.Reader {
+	return bytes.NewReader(append([]byte(nil), d.r.buf...))
+}
+
+// Close checks that the stream ends after the values decoded so far, with valid index and
+// checksum footers, if any. The checksum is verified if enabled.
+func (d *Decoder) Close() error {
+	if _, ok := d.r.r.(closedReader); ok {
+		return nil
+	}
+	err := d.readFooters()
+	d.r = &peekReader{r: closedReader{}}
+	return err
+}
+
+// readFooters consumes the footers ending the stream
+func (d *Decoder) readFooters() error {
+	if d.r.sum != nil {
+		if p, err := d.r.peek(1); err == nil && p[0] != tIndex && p[0] != tChecksum {
+			return &DecoderError{"unexpected trailing data"}
+		}
+		return d.verifyChecksum()
+	}
+	for {
+		p, err := d.r.peek(1)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return &DecoderError{"unexpected trailing data"}
+			}
+			return err
+		}
+		switch p[0] {
+		case tIndex:
+			err = d.readIndexFooter()
+		case tChecksum:
+			_, err = d.next(1 + sha256.Size)
+		default:
+			return &DecoderError{"unexpected trailing data"}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return &DecoderError{"truncated footer"}
+		} else if err != nil {
+			return err
+		}
+	}
 }
 
-func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r}
+func (d *Decoder) UseNumber() {
+	d.useNumber = true
+}
+
+func (d *Decoder) UseExactKinds() {
+	d.exactKinds = true
+}
+
+func (d *Decoder) byteOrder() binary.ByteOrder {
+	if d.le {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// uintOf returns the unsigned integer stored in p
+func (d *Decoder) uintOf(p []byte) uint64 {
+	var x uint64
+	for i := range p {
+		if d.le {
+			x = x<<8 | uint64(p[len(p)-1-i])
+		} else {
+			x = x<<8 | uint64(p[i])
+		}
+	}
+	return x
 }
 
 func (d *Decoder) read(v ...interface{}) error {
 	for _, vv := range v {
-		if err := binary.Read(d.r, binary.BigEndian, vv); err != nil {
+		if err := binary.Read(d.r, d.byteOrder(), vv); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// nextInto reads n bytes into buf if it has enough capacity, or into a new slice otherwise
+func (d *Decoder) nextInto(buf []byte, n int) ([]byte, error) {
+	if buf == nil || cap(buf) < n {
+		return d.next(n)
+	}
+	buf = buf[:n]
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
 func (d *Decoder) next(n int) ([]byte, error) {
-	buf := make([]byte, n)
-	if _, err := d.r.Read(buf); err != nil {
+	if err := d.charge(n, 1); err != nil {
 		return nil, err
 	}
+	if p, ok := d.slice(n); ok {
+		return p, nil
+	}
+	if n > maxPrealloc {
+		return d.readGrowing(n)
+	}
+	buf := d.alloc(n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readGrowing reads n bytes into a buffer growing as they are read
+func (d *Decoder) readGrowing(n int) ([]byte, error) {
+	buf := make([]byte, 0, maxPrealloc)
+	for len(buf) < n {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		m := cap(buf)
+		if m > n {
+			m = n
+		}
+		k, err := io.ReadFull(d.r, buf[len(buf):m])
+		buf = buf[:len(buf)+k]
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+	}
 	return buf, nil
 }
 
@@ -79,7 +478,11 @@ func (d *Decoder) decodeBool(v reflect.Value, x bool) error {
 	return nil
 }
 
-func (d *Decoder) decodeNumber(v reflect.Value, x interface{}, desc string) error {
+func (d *Decoder) decodeNumber(v reflect.Value, x interface{}, kind reflect.Kind) error {
+	desc := kind.String()
+	if d.strictTypes && !losslessNumber(v, x) {
+		return &DecoderTypeError{fmt.Sprintf("%s(%v)", desc, x), v.Type()}
+	}
 	switch v.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		n, _ := x.(int64) // fast no-panic conversion
@@ -89,7 +492,7 @@ func (d *Decoder) decodeNumber(v reflect.Value, x interface{}, desc string) erro
 		case float64:
 			n = int64(x)
 		}
-		if v.OverflowInt(n) {
+		if !d.trusted && v.OverflowInt(n) {
 			return &DecoderTypeError{
 				Value: fmt.Sprintf("%s(%s)", desc, strconv.FormatInt(n, 10)),
 				Type:  v.Type(),
@@ -104,7 +507,7 @@ func (d *Decoder) decodeNumber(v reflect.Value, x interface{}, desc string) erro
 		case float64:
 			n = uint64(x)
 		}
-		if v.OverflowUint(n) {
+		if !d.trusted && v.OverflowUint(n) {
 			return &DecoderTypeError{
 				Value: fmt.Sprintf("%s(%s)", desc, strconv.FormatUint(n, 10)),
 				Type:  v.Type(),
@@ -119,107 +522,180 @@ func (d *Decoder) decodeNumber(v reflect.Value, x interface{}, desc string) erro
 		case uint64:
 			n = float64(x)
 		}
-		if v.OverflowFloat(n) {
+		if !d.trusted && v.OverflowFloat(n) {
 			return &DecoderTypeError{
 				Value: fmt.Sprintf("%s(%s)", desc, strconv.FormatFloat(n, 'f', -1, 64)),
 				Type:  v.Type(),
 			}
 		}
 		v.SetFloat(n)
+	case reflect.Struct:
+		if v.Type() != numberType {
+			return &DecoderTypeError{desc, v.Type()}
+		}
+		v.Set(reflect.ValueOf(newNumber(kind, x)))
 	case reflect.Interface:
 		if v.NumMethod() != 0 {
 			return &DecoderTypeError{desc, v.Type()}
 		}
-		v.Set(reflect.ValueOf(x))
+		if d.useNumber {
+			v.Set(reflect.ValueOf(newNumber(kind, x)))
+		} else if d.exactKinds {
+			v.Set(reflect.ValueOf(newNumber(kind, x).value()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
 	case reflect.Ptr:
-		return d.decodeNumber(indirect(v), x, desc)
+		return d.decodeNumber(indirect(v), x, kind)
 	default:
 		return &DecoderTypeError{desc, v.Type()}
 	}
 	return nil
 }
 
+// losslessNumber reports whether numeric x converts to the kind of v without losing its value
+func losslessNumber(v reflect.Value, x interface{}) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch x := x.(type) {
+		case uint64:
+			return x <= math.MaxInt64 && !v.OverflowInt(int64(x))
+		case float64:
+			return x == math.Trunc(x) && x >= math.MinInt64 && x < math.MaxInt64 && !v.OverflowInt(int64(x))
+		case int64:
+			return !v.OverflowInt(x)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch x := x.(type) {
+		case int64:
+			return x >= 0 && !v.OverflowUint(uint64(x))
+		case float64:
+			return x == math.Trunc(x) && x >= 0 && x < math.MaxUint64 && !v.OverflowUint(uint64(x))
+		case uint64:
+			return !v.OverflowUint(x)
+		}
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		switch x := x.(type) {
+		case int64:
+			if n = float64(x); n >= math.MaxInt64 || int64(n) != x {
+				return false
+			}
+		case uint64:
+			if n = float64(x); n >= math.MaxUint64 || uint64(n) != x {
+				return false
+			}
+		case float64:
+			n = x
+		}
+		return v.Kind() == reflect.Float64 || math.IsNaN(n) || float64(float32(n)) == n
+	}
+	return true
+}
+
 func (d *Decoder) decodeString(v reflect.Value, n int) error {
+	if e, ok := enumOf(v.Type()); ok {
+		return d.decodeEnum(v, e, n)
+	}
 	switch v.Kind() {
 	case reflect.String:
-		data, err := d.next(n)
+		data, err := d.nextString(n)
 		if err != nil {
 			return err
 		}
-		v.SetString(string(data))
+		v.SetString(d.string(data))
 	case reflect.Slice:
 		if v.Type().Elem().Kind() != reflect.Uint8 {
 			return &DecoderTypeError{"string", v.Type()}
 		}
-		data, err := d.next(n)
+		data, err := d.nextString(n)
 		if err != nil {
 			return err
 		}
 		v.Set(reflect.ValueOf(data))
-	case reflect.Bool:
-		data, err := d.next(n)
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		data, err := d.nextString(n)
 		if err != nil {
 			return err
 		}
-		n, err := strconv.ParseBool(string(data))
-		if err != nil {
+		if d.strictTypes || !parseScalar(v, string(data)) {
 			return &DecoderTypeError{"string", v.Type()}
 		}
-		v.SetBool(n)
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		data, err := d.next(n)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return &DecoderTypeError{"string", v.Type()}
+		}
+		data, err := d.nextString(n)
 		if err != nil {
 			return err
 		}
-		n, err := strconv.ParseInt(string(data), 10, 64)
+		v.Set(reflect.ValueOf(d.string(data)))
+	case reflect.Ptr:
+		return d.decodeString(indirect(v), n)
+	default:
+		return &DecoderTypeError{"string", v.Type()}
+	}
+	return nil
+}
+
+// nextString returns the next n bytes of a string, validating them as UTF-8 if required
+func (d *Decoder) nextString(n int) ([]byte, error) {
+	data, err := d.next(n)
+	if err == nil && d.strictUTF8 && !utf8.Valid(data) {
+		return nil, &DecoderError{"invalid UTF-8 in string"}
+	}
+	return data, err
+}
+
+// parseScalar sets boolean or numeric v from its string form
+func parseScalar(v reflect.Value, s string) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		n, err := strconv.ParseBool(s)
+		if err != nil {
+			return false
+		}
+		v.SetBool(n)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
 		if err != nil || v.OverflowInt(n) {
-			return &DecoderTypeError{"string", v.Type()}
+			return false
 		}
 		v.SetInt(n)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		data, err := d.next(n)
-		if err != nil {
-			return err
-		}
-		n, err := strconv.ParseUint(string(data), 10, 64)
+		n, err := strconv.ParseUint(s, 10, 64)
 		if err != nil || v.OverflowUint(n) {
-			return &DecoderTypeError{"string", v.Type()}
+			return false
 		}
 		v.SetUint(n)
 	case reflect.Float32, reflect.Float64:
-		data, err := d.next(n)
-		if err != nil {
-			return err
-		}
-		n, err := strconv.ParseFloat(string(data), v.Type().Bits())
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
 		if err != nil || v.OverflowFloat(n) {
-			return &DecoderTypeError{"string", v.Type()}
+			return false
 		}
 		v.SetFloat(n)
-	case reflect.Interface:
-		if v.NumMethod() != 0 {
-			return &DecoderTypeError{"string", v.Type()}
-		}
-		data, err := d.next(n)
-		if err != nil {
-			return err
-		}
-		v.Set(reflect.ValueOf(string(data)))
-	case reflect.Ptr:
-		return d.decodeString(indirect(v), n)
 	default:
-		return &DecoderTypeError{"string", v.Type()}
+		return false
 	}
-	return nil
+	return true
 }
 
 func (d *Decoder) decodeBinary(v reflect.Value, n int) error {
+	if n < 0 {
+		return d.decodeBinaryStream(v)
+	}
 	switch v.Kind() {
 	case reflect.Slice:
 		if v.Type().Elem().Kind() != reflect.Uint8 {
 			return &DecoderTypeError{"binary", v.Type()}
 		}
-		data, err := d.next(n)
+		var buf []byte
+		if !v.IsNil() && v.Type() == bytesType {
+			buf = v.Bytes()
+		}
+		data, err := d.nextInto(buf, n)
 		if err != nil {
 			return err
 		}
@@ -232,7 +708,7 @@ func (d *Decoder) decodeBinary(v reflect.Value, n int) error {
 		if err != nil {
 			return err
 		}
-		v.Set(reflect.ValueOf(data))
+		v.Set(reflect.ValueOf(d.binaryInterface(data)))
 	case reflect.Struct:
 		if vb, ok := v.Addr().Interface().(encoding.BinaryUnmarshaler); ok {
 			data, err := d.next(n)
@@ -251,50 +727,193 @@ func (d *Decoder) decodeBinary(v reflect.Value, n int) error {
 }
 
 func (d *Decoder) decodeArrayItems(v reflect.Value, n int) error {
+	elem := typeDecoder(v.Type().Elem())
 	for i := 0; i < n; i++ {
-		if err := d.DecodeValue(v.Index(i).Addr()); err != nil {
+		if err := d.decodeItem(elem, v, i); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (d *Decoder) decodeArray(v reflect.Value, n int) error {
-	switch v.Kind() {
-	case reflect.Array:
-		if n > v.Len() {
-			return &DecoderTypeError{fmt.Sprintf("array(%d)", n), v.Type()}
+// decodeSliceItems decodes n items into addressable slice v, reusing its items within capacity
+// and appending the others
+func (d *Decoder) decodeSliceItems(v reflect.Value, n int) error {
+	elem := typeDecoder(v.Type().Elem())
+	if n < v.Cap() {
+		v.SetLen(n)
+	} else {
+		v.SetLen(v.Cap())
+	}
+	for i := 0; i < n; i++ {
+		if i == v.Len() {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
 		}
-		if err := d.decodeArrayItems(v, n); err != nil {
+		if err := d.decodeItem(elem, v, i); err != nil {
 			return err
 		}
-		if n < v.Len() {
-			z := reflect.Zero(v.Type().Elem())
-			for i := n; i < v.Len(); i++ {
-				v.Index(i).Set(z)
-			}
-		}
-	case reflect.Slice:
-		if n > v.Cap() {
-			nv := reflect.MakeSlice(v.Type(), v.Len(), n)
-			reflect.Copy(nv, v)
-			v.Set(nv)
-		}
-		if n != v.Len() {
-			v.SetLen(n)
+	}
+	return nil
+}
+
+// preallocLen returns the capacity to allocate up front for n items of type t
+func preallocLen(n int, t reflect.Type) int {
+	if size := int(t.Size()); size > 0 && n > maxPrealloc/size {
+		return maxPrealloc / size
+	}
+	return n
+}
+
+// decodeItem decodes the next value into item i of array or slice v
+func (d *Decoder) decodeItem(elem decoderFunc, v reflect.Value, i int) error {
+	if d.soft() {
+		d.pushPath("[" + strconv.Itoa(i) + "]")
+		defer d.popPath()
+	}
+	return d.decodeWith(elem, v.Index(i))
+}
+
+// more reports whether an array of n items, or of unknown length if n < 0,
+// has an item at position i, consuming the end marker of the latter
+func (d *Decoder) more(i, n int) (bool, error) {
+	if n >= 0 {
+		return i < n, nil
+	}
+	p, err := d.r.peek(1)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
 		}
-		if err := d.decodeArrayItems(v, n); err != nil {
-			return err
+		return false, err
+	}
+	if p[0] != tEnd {
+		return true, nil
+	}
+	_, err = d.readType()
+	return false, err
+}
+
+// decodeArrayStream decodes items of an array of unknown length into v
+func (d *Decoder) decodeArrayStream(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Array:
+		elem := typeDecoder(v.Type().Elem())
+		i := 0
+		for ; ; i++ {
+			if more, err := d.more(i, -1); err != nil {
+				return err
+			} else if !more {
+				break
+			}
+			if i == v.Len() {
+				return &DecoderTypeError{fmt.Sprintf("array(%d+)", i+1), v.Type()}
+			}
+			if err := d.decodeItem(elem, v, i); err != nil {
+				return err
+			}
+		}
+		z := reflect.Zero(v.Type().Elem())
+		for ; i < v.Len(); i++ {
+			v.Index(i).Set(z)
+		}
+		return nil
+	case reflect.Slice:
+		if v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		}
+		return d.appendStream(v)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return &DecoderTypeError{"array", v.Type()}
+		}
+		xv := reflect.ValueOf(&[]interface{}{}).Elem()
+		if err := d.appendStream(xv); err != nil {
+			return err
+		}
+		v.Set(xv)
+		return nil
+	}
+	return &DecoderTypeError{"array", v.Type()}
+}
+
+// appendStream decodes items of an array of unknown length into slice v, reusing its capacity
+func (d *Decoder) appendStream(v reflect.Value) error {
+	elem := typeDecoder(v.Type().Elem())
+	v.SetLen(0)
+	for i := 0; ; i++ {
+		if more, err := d.more(i, -1); err != nil || !more {
+			return err
+		}
+		if i == v.Cap() {
+			if err := d.charge(i+1, v.Type().Elem().Size()); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		} else {
+			v.SetLen(i + 1)
+		}
+		if err := d.decodeItem(elem, v, i); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *Decoder) decodeArray(v reflect.Value, n int) error {
+	if n < 0 && v.Kind() != reflect.Chan && v.Kind() != reflect.Ptr {
+		return d.decodeArrayStream(v)
+	}
+	switch v.Kind() {
+	case reflect.Array:
+		if n > v.Len() {
+			return &DecoderTypeError{fmt.Sprintf("array(%d)", n), v.Type()}
+		}
+		if err := d.decodeArrayItems(v, n); err != nil {
+			return err
+		}
+		if n < v.Len() {
+			z := reflect.Zero(v.Type().Elem())
+			for i := n; i < v.Len(); i++ {
+				v.Index(i).Set(z)
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() || n > v.Cap() {
+			if err := d.charge(n, v.Type().Elem().Size()); err != nil {
+				return err
+			}
+		}
+		c := preallocLen(n, v.Type().Elem())
+		if v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 0, c))
+		} else if c > v.Cap() {
+			nv := reflect.MakeSlice(v.Type(), v.Len(), c)
+			reflect.Copy(nv, v)
+			v.Set(nv)
+		}
+		if err := d.decodeSliceItems(v, n); err != nil {
+			return err
 		}
 	case reflect.Interface:
 		if v.NumMethod() != 0 {
 			return &DecoderTypeError{fmt.Sprintf("array(%d)", n), v.Type()}
 		}
-		xv := reflect.ValueOf(make([]interface{}, n))
-		if err := d.decodeArrayItems(xv, n); err != nil {
+		if err := d.charge(n, interfaceType.Size()); err != nil {
+			return err
+		}
+		xv := reflect.ValueOf(&[]interface{}{}).Elem()
+		xv.Set(reflect.ValueOf(make([]interface{}, 0, preallocLen(n, interfaceType))))
+		if err := d.decodeSliceItems(xv, n); err != nil {
 			return err
 		}
 		v.Set(xv)
+	case reflect.Chan:
+		if v.Type().ChanDir()&reflect.SendDir == 0 {
+			return &DecoderTypeError{fmt.Sprintf("array(%d)", n), v.Type()}
+		}
+		if v.IsNil() {
+			return &DecoderError{fmt.Sprintf("nil %s", v.Type().String())}
+		}
+		return d.decodeChan(v, n)
 	case reflect.Ptr:
 		return d.decodeArray(indirect(v), n)
 	default:
@@ -303,17 +922,197 @@ func (d *Decoder) decodeArray(v reflect.Value, n int) error {
 	return nil
 }
 
+// decodeChan sends n decoded items to channel v, closing it afterwards even on error
+func (d *Decoder) decodeChan(v reflect.Value, n int) error {
+	defer v.Close()
+	elem := typeDecoder(v.Type().Elem())
+	for i := 0; ; i++ {
+		if more, err := d.more(i, n); err != nil || !more {
+			return err
+		}
+		x := reflect.New(v.Type().Elem()).Elem()
+		if err := d.decodeWith(elem, x); err != nil {
+			return err
+		}
+		v.Send(x)
+	}
+}
+
 func (d *Decoder) decodeObjectItems(v reflect.Value, n int) error {
+	// existing values are decoded in place, and unless merging maps,
+	// items missing in the input are deleted afterwards
+	var seen reflect.Value
+	if d.inPlace && v.Len() > 0 || d.rejectDuplicates {
+		seen = reflect.MakeMap(reflect.MapOf(v.Type().Key(), reflect.TypeOf(true)))
+	}
+	if err := d.charge(n, v.Type().Key().Size()+v.Type().Elem().Size()); err != nil {
+		return err
+	}
+	elem := typeDecoder(v.Type().Elem())
 	for i := 0; i < n; i++ {
 		vk := reflect.New(v.Type().Key())
-		if err := d.DecodeValue(vk); err != nil {
+		if err := d.decodeValue(vk); err != nil {
+			return err
+		}
+		k, err := hashableKey(vk.Elem())
+		if err != nil {
 			return err
 		}
 		vv := reflect.New(v.Type().Elem())
-		if err := d.DecodeValue(vv); err != nil {
+		if d.inPlace || d.mergeMaps {
+			if x := v.MapIndex(k); x.IsValid() {
+				vv.Elem().Set(x)
+			}
+		}
+		if seen.IsValid() {
+			if d.rejectDuplicates && seen.MapIndex(k).IsValid() {
+				return &DecoderError{fmt.Sprintf("duplicate key %v", k.Interface())}
+			}
+			seen.SetMapIndex(k, reflect.ValueOf(true))
+		}
+		if d.soft() {
+			d.pushPath(fmt.Sprintf("[%v]", k.Interface()))
+		}
+		if err := d.decodeWith(elem, vv.Elem()); err != nil {
 			return err
 		}
-		v.SetMapIndex(vk.Elem(), vv.Elem())
+		if d.soft() {
+			d.popPath()
+		}
+		v.SetMapIndex(k, vv.Elem())
+	}
+	if d.inPlace && !d.mergeMaps && seen.IsValid() {
+		for _, k := range v.MapKeys() {
+			if !seen.MapIndex(k).IsValid() {
+				v.SetMapIndex(k, reflect.Value{})
+			}
+		}
+	}
+	return nil
+}
+
+// decodeInline decodes a value of unknown struct field k into the inline map m
+func (d *Decoder) decodeInline(m reflect.Value, k string) error {
+	if !m.CanSet() {
+		return &DecoderTypeError{"object", m.Type()}
+	}
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	mk := reflect.ValueOf(k).Convert(m.Type().Key())
+	if d.rejectDuplicates && m.MapIndex(mk).IsValid() {
+		return &DecoderError{fmt.Sprintf("duplicate field %q", k)}
+	}
+	vv := reflect.New(m.Type().Elem())
+	if err := d.decodeValue(vv); err != nil {
+		return err
+	}
+	m.SetMapIndex(mk, vv.Elem())
+	return nil
+}
+
+// decodeStruct decodes n object items into struct v, using decoders of its fields if known
+func (d *Decoder) decodeStruct(v reflect.Value, n int, si *structInfo, decs []decoderFunc) error {
+	if d.patch {
+		// fields missing in the input are kept as they are
+		var set []bool
+		if d.rejectDuplicates {
+			set = make([]bool, v.NumField())
+		}
+		return d.decodeFields(v, n, si, decs, set)
+	}
+	if d.inPlace {
+		return d.decodeStructInPlace(v, n, si, decs)
+	}
+	xv := reflect.New(v.Type())
+	if si.defaulter {
+		xv.Interface().(Defaulter).SetDefaults()
+	}
+	xv = xv.Elem()
+	var set []bool
+	if d.rejectDuplicates {
+		set = make([]bool, xv.NumField())
+	}
+	if err := d.decodeFields(xv, n, si, decs, set); err != nil {
+		return err
+	}
+	v.Set(xv)
+	return nil
+}
+
+// decodeStructInPlace decodes into the existing fields of v, so their allocations are reused
+func (d *Decoder) decodeStructInPlace(v reflect.Value, n int, si *structInfo, decs []decoderFunc) error {
+	if si.inline >= 0 {
+		if m := v.Field(si.inline); m.CanSet() {
+			for _, k := range m.MapKeys() {
+				m.SetMapIndex(k, reflect.Value{})
+			}
+		}
+	}
+	set := make([]bool, v.NumField())
+	if err := d.decodeFields(v, n, si, decs, set); err != nil {
+		return err
+	}
+	var dv reflect.Value
+	if si.defaulter {
+		dv = reflect.New(v.Type())
+		dv.Interface().(Defaulter).SetDefaults()
+	}
+	for _, sf := range si.fields {
+		if f := v.Field(sf.index); !set[sf.index] && f.CanSet() {
+			if dv.IsValid() {
+				f.Set(dv.Elem().Field(sf.index))
+			} else {
+				f.Set(reflect.Zero(f.Type()))
+			}
+		}
+	}
+	return nil
+}
+
+// decodeFields decodes n object items into fields of xv, marking them in set if given
+func (d *Decoder) decodeFields(xv reflect.Value, n int, si *structInfo, decs []decoderFunc, set []bool) error {
+	for i := 0; i < n; i++ {
+		var xk string
+		vk := reflect.ValueOf(&xk)
+		if err := d.decodeValue(vk); err != nil {
+			return err
+		}
+		sf, ok := si.lookup(&d.options, xk)
+		if !ok && si.inline >= 0 {
+			if err := d.decodeInline(xv.Field(si.inline), xk); err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok || !xv.Field(sf.index).CanSet() {
+			return &DecoderTypeError{fmt.Sprintf("object(%d)", n), xv.Type()}
+		}
+		if set != nil && set[sf.index] && d.rejectDuplicates {
+			return &DecoderError{fmt.Sprintf("duplicate field %q", xk)}
+		}
+		if sf.deprecated && d.deprecationWarning != nil {
+			d.deprecationWarning(xv.Type(), xk)
+		}
+		f := xv.Field(sf.index)
+		var dec decoderFunc
+		if decs != nil {
+			dec = decs[sf.index]
+		} else {
+			dec = typeDecoder(f.Type())
+		}
+		if d.soft() {
+			d.pushPath("." + xk)
+		}
+		if err := d.decodeWith(dec, f); err != nil {
+			return err
+		}
+		if d.soft() {
+			d.popPath()
+		}
+		if set != nil {
+			set[sf.index] = true
+		}
 	}
 	return nil
 }
@@ -323,7 +1122,7 @@ func (d *Decoder) decodeObject(v reflect.Value, n int) error {
 	case reflect.Map:
 		if v.IsNil() {
 			v.Set(reflect.MakeMap(v.Type()))
-		} else {
+		} else if !d.inPlace && !d.mergeMaps {
 			// delete existing items
 			zeroValue := reflect.Value{}
 			for _, vk := range v.MapKeys() {
@@ -334,29 +1133,7 @@ func (d *Decoder) decodeObject(v reflect.Value, n int) error {
 			return err
 		}
 	case reflect.Struct:
-		vn := v.NumField()
-		xv := reflect.New(v.Type()).Elem()
-		for i := 0; i < n; i++ {
-			var xk string
-			vk := reflect.ValueOf(&xk)
-			if err := d.DecodeValue(vk); err != nil {
-				return err
-			}
-			decoded := false
-			for j := 0; j < vn; j++ {
-				f := xv.Field(j)
-				if xv.Type().Field(j).Name == xk && f.CanSet() {
-					if err := d.DecodeValue(f.Addr()); err != nil {
-						return err
-					}
-					decoded = true
-				}
-			}
-			if !decoded {
-				return &DecoderTypeError{fmt.Sprintf("object(%d)", n), v.Type()}
-			}
-		}
-		v.Set(xv)
+		return d.decodeStruct(v, n, structInfoOf(v.Type()), nil)
 	case reflect.Interface:
 		if v.NumMethod() != 0 {
 			return &DecoderTypeError{fmt.Sprintf("object(%d)", n), v.Type()}
@@ -375,6 +1152,12 @@ func (d *Decoder) decodeObject(v reflect.Value, n int) error {
 }
 
 func (d *Decoder) DecodeValue(v reflect.Value) error {
+	return d.topLevel(func() error {
+		return d.decodeValue(v)
+	})
+}
+
+func (d *Decoder) decodeValue(v reflect.Value) error {
 	if v.Kind() != reflect.Ptr {
 		return &DecoderError{fmt.Sprintf("non-pointer %s", v.Type().String())}
 	}
@@ -382,167 +1165,580 @@ func (d *Decoder) DecodeValue(v reflect.Value) error {
 		return &DecoderError{fmt.Sprintf("nil %s", v.Type().String())}
 	}
 
-	p := make([]byte, 1)
-	if _, err := d.r.Read(p); err != nil {
+	t, err := d.readType()
+	if err != nil {
 		return err
 	}
+	return typeDecoder(v.Type().Elem())(d, t, v.Elem())
+}
 
-	v = v.Elem()
-	switch p[0] {
-	case tNil:
-		return d.decodeNil(v)
+// decodeWith decodes the next value into addressable v using dec
+func (d *Decoder) decodeWith(dec decoderFunc, v reflect.Value) error {
+	if d.soft() {
+		return d.decodeSoft(dec, v)
+	}
+	t, err := d.readType()
+	if err != nil {
+		return err
+	}
+	return dec(d, t, v)
+}
 
-	case tTrue:
-		return d.decodeBool(v, true)
-	case tFalse:
-		return d.decodeBool(v, false)
+func (d *Decoder) readSize(t byte) (int, error) {
+	n, err := d.readLength(t)
+	if err != nil {
+		return 0, err
+	}
+	if d.limit > 0 && n > d.limit {
+		return 0, &DecoderError{fmt.Sprintf("%s length %d exceeds limit %d", typeOf(t), n, d.limit)}
+	}
+	// every byte or item takes at least one byte of the input
+	if m, ok := d.inputLeft(); ok && n > m {
+		return 0, &DecoderLengthError{typeOf(t), uint64(n)}
+	}
+	return n, nil
+}
 
-	case tInt8:
-		var x int8
-		if err := d.read(&x); err != nil {
+// decodeType decodes the value of type t into v
+func (d *Decoder) decodeType(t byte, v reflect.Value) error {
+	switch tt := typeOf(t); tt {
+	case NilType:
+		return d.decodeNil(v)
+	case BoolType:
+		return d.decodeBool(v, t == tTrue)
+	case IntType, UintType, FloatType:
+		x, err := d.readNumber(t)
+		if err != nil {
 			return err
 		}
-		return d.decodeNumber(v, int64(x), "int8")
-	case tInt16:
-		var x int16
-		if err := d.read(&x); err != nil {
+		return d.decodeNumber(v, x.raw(), x.Kind)
+	case StringType, BinaryType, ArrayType, ObjectType:
+		n, err := d.readSize(t)
+		if err != nil {
 			return err
 		}
-		return d.decodeNumber(v, int64(x), "int16")
-	case tInt32:
-		var x int32
-		if err := d.read(&x); err != nil {
+		switch tt {
+		case StringType:
+			return d.decodeString(v, n)
+		case BinaryType:
+			return d.decodeBinary(v, n)
+		case ArrayType:
+			return d.decodeArray(v, n)
+		}
+		return d.decodeObject(v, n)
+	case UnionType:
+		return d.decodeUnion(v)
+	case TensorType:
+		return d.decodeTensor(v)
+	case TimeType:
+		x, err := d.readTime()
+		if err != nil {
 			return err
 		}
-		return d.decodeNumber(v, int64(x), "int32")
-	case tInt64:
-		var x int64
-		if err := d.read(&x); err != nil {
+		return d.decodeTime(v, x)
+	case ExtType:
+		n, err := d.readSize(t)
+		if err != nil {
+			return err
+		}
+		return d.decodeExt(v, n)
+	case CompressedType:
+		n, err := d.readSize(t)
+		if err != nil {
 			return err
 		}
-		return d.decodeNumber(v, x, "int64")
+		return d.decodeCompressed(v, n)
+	case RefType:
+		return d.decodeRef(v)
+	case FieldNameType:
+		return d.decodeFieldName(t, v)
+	case SetType:
+		return d.decodeSet(v)
+	}
+	return nil
+}
 
+func (d *Decoder) readType() (byte, error) {
+	if !d.started {
+		if err := d.readHeader(); err != nil {
+			return 0, err
+		}
+	}
+	var t byte
+	if err := d.read(&t); err != nil {
+		return 0, err
+	}
+	return t, nil
+}
+
+func (d *Decoder) readLength(t byte) (int, error) {
+	switch t {
+	case tString8, tBinary8, tArray8, tObject8, tExt8, tDeflate8:
+		var n uint8
+		err := d.read(&n)
+		return int(n), err
+	case tString16, tBinary16, tArray16, tObject16, tExt16, tDeflate16:
+		var n uint16
+		err := d.read(&n)
+		return int(n), err
+	case tString32, tBinary32, tArray32, tObject32, tExt32, tDeflate32:
+		var n uint32
+		if err := d.read(&n); err != nil {
+			return 0, err
+		}
+		return checkDecodedLength(t, uint64(n))
+	case tString64, tBinary64, tArray64, tObject64, tExt64, tDeflate64:
+		var n uint64
+		if err := d.read(&n); err != nil {
+			return 0, err
+		}
+		return checkDecodedLength(t, n)
+	case tArrayStream, tBinaryStream:
+		return -1, nil
+	}
+	return 0, nil
+}
+
+func (d *Decoder) readNumber(t byte) (Number, error) {
+	switch t {
+	case tInt8:
+		var x int8
+		err := d.read(&x)
+		return newNumber(reflect.Int8, int64(x)), err
+	case tInt16:
+		var x int16
+		err := d.read(&x)
+		return newNumber(reflect.Int16, int64(x)), err
+	case tInt32:
+		var x int32
+		err := d.read(&x)
+		return newNumber(reflect.Int32, int64(x)), err
+	case tInt64:
+		var x int64
+		err := d.read(&x)
+		return newNumber(reflect.Int64, x), err
 	case tUint8:
 		var x uint8
-		if err := d.read(&x); err != nil {
-			return err
-		}
-		return d.decodeNumber(v, uint64(x), "uint8")
+		err := d.read(&x)
+		return newNumber(reflect.Uint8, uint64(x)), err
 	case tUint16:
 		var x uint16
-		if err := d.read(&x); err != nil {
-			return err
-		}
-		return d.decodeNumber(v, uint64(x), "uint16")
+		err := d.read(&x)
+		return newNumber(reflect.Uint16, uint64(x)), err
 	case tUint32:
 		var x uint32
-		if err := d.read(&x); err != nil {
-			return err
-		}
-		return d.decodeNumber(v, uint64(x), "uint32")
+		err := d.read(&x)
+		return newNumber(reflect.Uint32, uint64(x)), err
 	case tUint64:
 		var x uint64
-		if err := d.read(&x); err != nil {
-			return err
-		}
-		return d.decodeNumber(v, x, "uint64")
-
+		err := d.read(&x)
+		return newNumber(reflect.Uint64, x), err
 	case tFloat32:
 		var x float32
-		if err := d.read(&x); err != nil {
-			return err
-		}
-		return d.decodeNumber(v, float64(x), "float32")
+		err := d.read(&x)
+		return newNumber(reflect.Float32, float64(x)), err
 	case tFloat64:
 		var x float64
-		if err := d.read(&x); err != nil {
-			return err
-		}
-		return d.decodeNumber(v, float64(x), "float64")
+		err := d.read(&x)
+		return newNumber(reflect.Float64, x), err
+	case tVarint:
+		x, err := d.readUvarint()
+		return newNumber(reflect.Int64, int64(x>>1)^-int64(x&1)), err
+	case tUvarint:
+		x, err := d.readUvarint()
+		return newNumber(reflect.Uint64, x), err
+	}
+	return Number{}, &DecoderTypeError{typeOf(t).String(), numberType}
+}
 
-	case tString8:
-		var n uint8
-		if err := d.read(&n); err != nil {
-			return err
+func (d *Decoder) expect(typ Type, target reflect.Type) (byte, int, error) {
+	t, err := d.readType()
+	if err != nil {
+		return 0, 0, err
+	}
+	if tt := typeOf(t); tt != typ {
+		return 0, 0, &DecoderTypeError{tt.String(), target}
+	}
+	n, err := d.readLength(t)
+	return t, n, err
+}
+
+func sizeOf(t byte) int {
+	switch t {
+	case tInt8, tUint8, tString8, tBinary8, tArray8, tObject8, tExt8, tDeflate8:
+		return 1
+	case tInt16, tUint16, tString16, tBinary16, tArray16, tObject16, tExt16, tDeflate16:
+		return 2
+	case tInt32, tUint32, tFloat32, tString32, tBinary32, tArray32, tObject32, tExt32, tDeflate32, tFieldHash, tFieldName:
+		return 4
+	case tInt64, tUint64, tFloat64, tString64, tBinary64, tArray64, tObject64, tExt64, tDeflate64:
+		return 8
+	case tTime:
+		return timeSize
+	}
+	return 0
+}
+
+// readRaw appends the next encoded value to buf without decoding it
+func (d *Decoder) readRaw(buf []byte) ([]byte, error) {
+	t, err := d.readType()
+	if err != nil {
+		return buf, err
+	}
+	if typeOf(t) == InvalidType {
+		return buf, &DecoderError{fmt.Sprintf("invalid type %#x", t)}
+	}
+	buf = append(buf, t)
+	p, err := d.next(sizeOf(t))
+	if err != nil {
+		return buf, err
+	}
+	buf = append(buf, p...)
+
+	if t == tVarint || t == tUvarint {
+		return d.readVarint(buf)
+	}
+	if t == tRef {
+		if buf, err = d.readVarint(buf); err != nil {
+			return buf, err
 		}
-		return d.decodeString(v, int(n))
-	case tString16:
-		var n uint16
-		if err := d.read(&n); err != nil {
-			return err
+		return d.readVarint(buf)
+	}
+	if t == tBinaryStream {
+		for i := 0; ; i++ {
+			if more, err := d.more(i, -1); err != nil {
+				return buf, err
+			} else if !more {
+				return append(buf, tEnd), nil
+			}
+			if buf, err = d.readChunk(buf); err != nil {
+				return buf, err
+			}
 		}
-		return d.decodeString(v, int(n))
-	case tString32:
-		var n uint32
-		if err := d.read(&n); err != nil {
-			return err
+	}
+	if t == tFieldHash || t == tFieldName {
+		h := uint32(d.uintOf(p))
+		name, err := d.readFieldName(t, h)
+		if err != nil {
+			return buf, err
+		}
+		if d.written != nil {
+			if t = tFieldName; d.written[h] {
+				t = tFieldHash
+			}
+			buf[len(buf)-1-len(p)] = t
+			d.written[h] = true
+		}
+		if t == tFieldName {
+			buf = append(buf, name...)
 		}
-		return d.decodeString(v, int(n))
+		return buf, nil
+	}
 
-	case tBinary8:
-		var n uint8
-		if err := d.read(&n); err != nil {
-			return err
+	x := d.uintOf(p)
+	switch typeOf(t) {
+	case StringType, BinaryType, ArrayType, ObjectType, ExtType, CompressedType:
+		if _, err = checkDecodedLength(t, x); err != nil {
+			return buf, err
 		}
-		return d.decodeBinary(v, int(n))
-	case tBinary16:
-		var n uint16
-		if err := d.read(&n); err != nil {
-			return err
+		if typeOf(t) == ObjectType {
+			x *= 2 // keys and values
+		} else if typeOf(t) == ExtType {
+			x++ // type code
 		}
-		return d.decodeBinary(v, int(n))
-	case tBinary32:
-		var n uint32
-		if err := d.read(&n); err != nil {
-			return err
+		if _, err = checkDecodedLength(t, x); err != nil {
+			return buf, err
 		}
-		return d.decodeBinary(v, int(n))
-
-	case tArray8:
-		var n uint8
-		if err := d.read(&n); err != nil {
-			return err
+	}
+	n := int(x)
+	switch typeOf(t) {
+	case StringType, BinaryType, ExtType, CompressedType:
+		if p, err = d.next(n); err != nil {
+			return buf, err
+		}
+		buf = append(buf, p...)
+	case ArrayType, ObjectType:
+		if t == tArrayStream {
+			n = -1
+		}
+		for i := 0; ; i++ {
+			if more, err := d.more(i, n); err != nil {
+				return buf, err
+			} else if !more {
+				break
+			}
+			if buf, err = d.readRaw(buf); err != nil {
+				return buf, err
+			}
 		}
-		return d.decodeArray(v, int(n))
-	case tArray16:
-		var n uint16
-		if err := d.read(&n); err != nil {
-			return err
+		if t == tArrayStream {
+			buf = append(buf, tEnd)
 		}
-		return d.decodeArray(v, int(n))
-	case tArray32:
-		var n uint32
-		if err := d.read(&n); err != nil {
-			return err
+	case SetType:
+		return d.readRaw(buf)
+	case UnionType:
+		// variant name and payload
+		for i := 0; i < 2; i++ {
+			if buf, err = d.readRaw(buf); err != nil {
+				return buf, err
+			}
+		}
+	case TensorType:
+		_, _, h, size, err := d.readTensorHeader()
+		if err != nil {
+			return buf, err
 		}
-		return d.decodeArray(v, int(n))
+		if p, err = d.next(size); err != nil {
+			return buf, err
+		}
+		buf = append(append(buf, h...), p...)
+	}
+	return buf, nil
+}
 
-	case tObject8:
-		var n uint8
-		if err := d.read(&n); err != nil {
-			return err
+func (d *Decoder) nextRaw() ([]byte, error) {
+	var raw []byte
+	err := d.topLevel(func() (err error) {
+		raw, err = d.readRaw(nil)
+		return err
+	})
+	return raw, err
+}
+
+func (d *Decoder) Skip() error {
+	_, err := d.nextRaw()
+	return err
+}
+
+func (d *Decoder) clone(r io.Reader) *Decoder {
+	x := &Decoder{r: &peekReader{r: r}, options: d.options, le: d.le, dedup: d.dedup}
+	if d.names != nil {
+		// values may use field names defined earlier in the stream
+		x.names = make(map[uint32][]byte, len(d.names))
+		for h, name := range d.names {
+			x.names[h] = name
 		}
-		return d.decodeObject(v, int(n))
-	case tObject16:
-		var n uint16
-		if err := d.read(&n); err != nil {
-			return err
+	}
+	return x
+}
+
+// headerDecoder returns a decoder of the stream header of r, to clone for values read from
+// their offsets in the stream
+func headerDecoder(r io.ReadSeeker, opts []Option) (*Decoder, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	d := NewDecoder(r, opts...)
+	return d, d.readHeader()
+}
+
+func (d *Decoder) peekType() ([]byte, error) {
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	if d.depth == 0 {
+		if d.counted && d.remaining == 0 {
+			return nil, io.EOF
+		} else if d.atFooter() {
+			return nil, d.truncated(io.EOF)
 		}
-		return d.decodeObject(v, int(n))
-	case tObject32:
-		var n uint32
-		if err := d.read(&n); err != nil {
-			return err
+	}
+	return d.r.peek(1)
+}
+
+func (d *Decoder) PeekType() (Type, error) {
+	p, err := d.peekType()
+	if err != nil {
+		return InvalidType, err
+	}
+	return typeOf(p[0]), nil
+}
+
+func (d *Decoder) PeekHeader() (Type, int, error) {
+	p, err := d.peekType()
+	if err != nil {
+		return InvalidType, 0, err
+	}
+	t := p[0]
+	var w int
+	switch typeOf(t) {
+	case StringType, BinaryType, ArrayType, ObjectType, ExtType, CompressedType:
+		w = sizeOf(t)
+	}
+	if p, err = d.r.peek(1 + w); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
 		}
-		return d.decodeObject(v, int(n))
+		return InvalidType, 0, err
 	}
-	return nil
+	if t == tArrayStream || t == tBinaryStream {
+		return typeOf(t), -1, nil
+	}
+	n, err := checkDecodedLength(t, d.uintOf(p[1:]))
+	return typeOf(t), n, err
+}
+
+func (d *Decoder) DecodeNil() error {
+	_, _, err := d.expect(NilType, reflect.TypeOf((*interface{})(nil)).Elem())
+	return err
+}
+
+func (d *Decoder) DecodeBool() (bool, error) {
+	t, err := d.readType()
+	if err != nil {
+		return false, err
+	}
+	switch t {
+	case tTrue:
+		return true, nil
+	case tFalse:
+		return false, nil
+	}
+	return false, &DecoderTypeError{typeOf(t).String(), reflect.TypeOf(false)}
+}
+
+func (d *Decoder) DecodeNumber() (Number, error) {
+	t, err := d.readType()
+	if err != nil {
+		return Number{}, err
+	}
+	return d.readNumber(t)
+}
+
+func (d *Decoder) DecodeInt64() (int64, error) {
+	n, err := d.DecodeNumber()
+	if err != nil {
+		return 0, err
+	}
+	return n.Int64()
+}
+
+func (d *Decoder) DecodeUint64() (uint64, error) {
+	n, err := d.DecodeNumber()
+	if err != nil {
+		return 0, err
+	}
+	return n.Uint64()
+}
+
+func (d *Decoder) DecodeFloat64() (float64, error) {
+	n, err := d.DecodeNumber()
+	if err != nil {
+		return 0, err
+	}
+	return n.Float64(), nil
+}
+
+func (d *Decoder) decodeBytes(target reflect.Type) ([]byte, error) {
+	return d.decodeBytesInto(nil, target)
+}
+
+func (d *Decoder) decodeBytesInto(buf []byte, target reflect.Type) ([]byte, error) {
+	t, err := d.readType()
+	if err != nil {
+		return nil, err
+	}
+	if tt := typeOf(t); tt != StringType && tt != BinaryType {
+		return nil, &DecoderTypeError{tt.String(), target}
+	}
+	n, err := d.readLength(t)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return d.readBinaryStream()
+	}
+	return d.nextInto(buf, n)
+}
+
+func (d *Decoder) DecodeString() (string, error) {
+	data, err := d.decodeBytes(reflect.TypeOf(""))
+	if err == nil && d.strictUTF8 && !utf8.Valid(data) {
+		return "", &DecoderError{"invalid UTF-8 in string"}
+	}
+	return d.string(data), err
+}
+
+func (d *Decoder) DecodeBinary() ([]byte, error) {
+	return d.decodeBytes(reflect.TypeOf([]byte(nil)))
+}
+
+// DecodeBinaryInto decodes binary or string data into buf, reusing its capacity when possible.
+func (d *Decoder) DecodeBinaryInto(buf []byte) ([]byte, error) {
+	return d.decodeBytesInto(buf, reflect.TypeOf([]byte(nil)))
+}
+
+// DecodeArrayHeader returns the number of array items, or -1 for an array of unknown length,
+// whose items follow while DecodeArrayEnd reports false.
+func (d *Decoder) DecodeArrayHeader() (int, error) {
+	_, n, err := d.expect(ArrayType, reflect.TypeOf([]interface{}(nil)))
+	return n, err
+}
+
+// DecodeArrayEnd reports whether an array of unknown length ends, consuming its end marker.
+func (d *Decoder) DecodeArrayEnd() (bool, error) {
+	more, err := d.more(0, -1)
+	return !more, err
+}
+
+func (d *Decoder) DecodeObjectHeader() (int, error) {
+	_, n, err := d.expect(ObjectType, reflect.TypeOf(map[interface{}]interface{}(nil)))
+	return n, err
 }
 
 func (d *Decoder) Decode(v interface{}) error {
 	return d.DecodeValue(reflect.ValueOf(v))
 }
 
+// DecodeAll decodes the next values into targets like Unmarshal, verifying the checksum footer if
+// enabled. Failures of values are reported as *LoadError, so decoding can be resumed from them.
+func (d *Decoder) DecodeAll(targets ...interface{}) error {
+	return decode(d, targets)
+}
+
+// hashableKey converts arrays decoded into interface{} keys to Go arrays and
+// rejects keys that cannot be stored in a map
+func hashableKey(v reflect.Value) (reflect.Value, error) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, nil
+		}
+		k, err := hashableKey(v.Elem())
+		if err != nil {
+			return v, err
+		}
+		x := reflect.New(v.Type()).Elem()
+		x.Set(k)
+		return x, nil
+	case reflect.Slice:
+		x := reflect.New(reflect.ArrayOf(v.Len(), v.Type().Elem())).Elem()
+		for i := 0; i < v.Len(); i++ {
+			k, err := hashableKey(v.Index(i))
+			if err != nil {
+				return v, err
+			}
+			x.Index(i).Set(k)
+		}
+		return x, nil
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			k, err := hashableKey(v.Index(i))
+			if err != nil {
+				return v, err
+			}
+			v.Index(i).Set(k)
+		}
+	case reflect.Map, reflect.Func:
+		return v, &DecoderError{fmt.Sprintf("unhashable map key of type %s", v.Type().String())}
+	case reflect.Float32, reflect.Float64:
+		if x := v.Float(); x != x {
+			return v, &DecoderKeyError{"NaN", v.Type()}
+		}
+	}
+	return v, nil
+}
+
 func indirect(v reflect.Value) reflect.Value {
 	if v := v.Elem(); v.IsValid() {
 		return v
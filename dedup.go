@@ -0,0 +1,146 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+const (
+	minDedupSize   = 8       // of encoded subtrees replaced with back-references
+	maxReplayBytes = 1 << 28 // replayed through back-references per value, unless WithMaxTotalBytes
+)
+
+// deduper rewrites an encoded value, replacing subtrees equal to earlier ones with back-references
+type deduper struct {
+	le   bool
+	out  []byte
+	seen map[string][2]int // offset and length in out of written subtrees
+}
+
+func (e *Encoder) encodeDedup(v reflect.Value) error {
+	var buf bytes.Buffer
+	if err := e.clone(&buf).EncodeValue(v); err != nil {
+		return err
+	}
+	x := &deduper{le: e.littleEndian, seen: make(map[string][2]int)}
+	if err := x.value(buf.Bytes(), true); err != nil {
+		return err
+	}
+	return e.writeRaw(x.out)
+}
+
+func (x *deduper) value(raw []byte, dedup bool) error {
+	t := raw[0]
+	tt := typeOf(t)
+	switch tt {
+	case StringType, BinaryType, ArrayType, ObjectType:
+	default:
+		x.out = append(x.out, raw...)
+		return nil
+	}
+	if r, ok := x.seen[string(raw)]; ok && dedup {
+		ref := appendUvarint(appendUvarint([]byte{tRef}, uint64(r[0])), uint64(r[1]))
+		if len(ref) < len(raw) {
+			x.out = append(x.out, ref...)
+			return nil
+		}
+	}
+
+	start := len(x.out)
+	if tt == StringType || tt == BinaryType {
+		x.out = append(x.out, raw...)
+	} else {
+		d := NewDecoder(&sliceReader{raw[1:]})
+		d.started, d.le = true, x.le
+		n, err := d.readLength(t)
+		if err != nil {
+			return err
+		}
+		x.out = append(x.out, raw[:1+sizeOf(t)]...)
+		if tt == ObjectType {
+			n *= 2
+		}
+		for i := 0; ; i++ {
+			if more, err := d.more(i, n); err != nil {
+				return err
+			} else if !more {
+				break
+			}
+			p, err := d.readRaw(nil)
+			if err != nil {
+				return err
+			}
+			// object keys are kept, as they are not decoded through type decoders
+			if err = x.value(p, tt == ArrayType || i%2 == 1); err != nil {
+				return err
+			}
+		}
+		if t == tArrayStream {
+			x.out = append(x.out, tEnd)
+		}
+	}
+	if len(raw) > minDedupSize {
+		if _, ok := x.seen[string(raw)]; !ok {
+			x.seen[string(raw)] = [2]int{start, len(x.out) - start}
+		}
+	}
+	return nil
+}
+
+// decodeRefs runs fn over the buffered next value, so its back-references can be resolved
+func (d *Decoder) decodeRefs(fn func() error) error {
+	n := d.r.n
+	raw, err := d.readRaw(nil)
+	if err != nil {
+		return err
+	}
+	d.refs, d.refBase, d.replayed = raw, n, 0
+	err = d.withData(raw, n, fn)
+	d.refs = nil
+	return err
+}
+
+// readRef returns the subtree of the current value referenced by the back-reference at offset pos
+func (d *Decoder) readRef(pos int64) ([]byte, int64, error) {
+	off, err := d.readUvarint()
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := d.readUvarint()
+	if err != nil {
+		return nil, 0, err
+	}
+	if d.refs == nil {
+		return nil, 0, &DecoderError{"back-reference outside of a stream with back-references"}
+	}
+	pos -= d.refBase
+	if n == 0 || off >= uint64(pos) || n > uint64(pos)-off {
+		return nil, 0, &DecoderError{fmt.Sprintf("invalid back-reference to %d bytes at offset %d", n, off)}
+	}
+	limit := int64(maxReplayBytes)
+	if d.maxTotalBytes > 0 {
+		limit = d.maxTotalBytes
+	}
+	if d.replayed += int64(n); d.replayed > limit {
+		return nil, 0, &DecoderError{fmt.Sprintf("back-references replay more than %d bytes", limit)}
+	}
+	return d.refs[off : off+n], d.refBase + int64(off), nil
+}
+
+func (d *Decoder) decodeRef(v reflect.Value) error {
+	p, n, err := d.readRef(d.r.n - 1)
+	if err != nil {
+		return err
+	}
+	return d.withData(p, n, func() error {
+		t, err := d.readType()
+		if err != nil {
+			return err
+		}
+		return typeDecoder(v.Type())(d, t, v)
+	})
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+type testTenantConfig struct {
+	Region   string
+	Features []string
+	Limits   map[string]int
+}
+
+func TestMarshalDedup(t *testing.T) {
+	x := map[string]testTenantConfig{}
+	for i := 0; i < 50; i++ {
+		x[fmt.Sprintf("tenant-%d", i)] = testTenantConfig{
+			Region:   "eu-west-1",
+			Features: []string{"billing", "reports", "audit-log"},
+			Limits:   map[string]int{"users": 100, "projects": 10},
+		}
+	}
+	plain, err := Marshal(x, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(x, WithCanonical(), WithDedup())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > len(plain)/3 {
+		t.Fatalf("dedup does not shrink %d bytes: %d", len(plain), len(data))
+	}
+
+	var y map[string]testTenantConfig
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+
+	var buf bytes.Buffer
+	dec := NewDecoder(bytes.NewReader(data))
+	if err = CopyValue(NewEncoder(&buf, WithCanonical()), dec); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, plain, buf.Bytes())
+
+	data, err = Marshal([]interface{}{"short", "short"}, WithDedup())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []byte{tRefs, tArray8, 2, tString8, 5, 's', 'h', 'o', 'r', 't', tString8, 5, 's', 'h', 'o', 'r', 't'}, data)
+}
+
+func TestUnmarshalDedupInvalid(t *testing.T) {
+	for _, data := range [][]byte{
+		{tRefs, tArray8, 1, tRef, 0, 3},                   // self
+		{tRefs, tArray8, 2, tRef, 5, 1, tTrue},            // forward
+		{tRefs, tArray8, 2, tString8, 1, 'a', tRef, 1, 0}, // empty
+		{tArray8, 2, tString8, 1, 'a', tRef, 2, 3},        // no header
+	} {
+		var v interface{}
+		if err := Unmarshal(data, &v); err == nil {
+			t.Fatalf("% x should not unmarshal", data)
+		}
+	}
+
+	var v []string
+	data := []byte{tRefs, tArray8, 2, tString8, 1, 'a', tRef, 2, 3}
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []string{"a", "a"}, v)
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Dictionary is a preset DEFLATE dictionary, referenced by its ID in compressed frames.
+// Only the last 32 KB of data are used, as DEFLATE matches no further back. Frames are not
+// zstd frames, so only godat can read them.
+type Dictionary struct {
+	ID   uint32
+	Data []byte
+}
+
+const (
+	dictGram    = 8  // length of substrings counted when training
+	dictSegment = 32 // length of sample segments copied into dictionaries
+)
+
+// TrainDictionary builds a dictionary of up to size bytes from samples of typical payloads,
+// picking their segments that hold the most substrings common to other samples.
+func TrainDictionary(id uint32, samples [][]byte, size int) *Dictionary {
+	freq := make(map[string]int)
+	for _, s := range samples {
+		seen := make(map[string]bool)
+		for i := 0; i+dictGram <= len(s); i++ {
+			if g := string(s[i : i+dictGram]); !seen[g] {
+				seen[g] = true
+				freq[g]++
+			}
+		}
+	}
+
+	var segments [][]byte
+	for _, s := range samples {
+		for i := 0; i < len(s); i += dictSegment / 2 {
+			end := i + dictSegment
+			if end > len(s) {
+				end = len(s)
+			}
+			segments = append(segments, s[i:end])
+		}
+	}
+
+	var picked [][]byte
+	covered := make(map[string]bool)
+	for n := 0; n < size; {
+		best, score := -1, 0
+		for i, seg := range segments {
+			if seg == nil {
+				continue
+			}
+			x := 0
+			for j := 0; j+dictGram <= len(seg); j++ {
+				if g := string(seg[j : j+dictGram]); !covered[g] && freq[g] > 1 {
+					x += freq[g]
+				}
+			}
+			if x > score {
+				best, score = i, x
+			}
+		}
+		if best < 0 {
+			break
+		}
+		seg := segments[best]
+		if n+len(seg) > size {
+			seg = seg[:size-n]
+		}
+		for j := 0; j+dictGram <= len(seg); j++ {
+			covered[string(seg[j:j+dictGram])] = true
+		}
+		picked = append(picked, seg)
+		segments[best] = nil
+		n += len(seg)
+	}
+
+	// flate finds matches closer to the data cheaper, so the best segments go last
+	data := make([]byte, 0, size)
+	for i := len(picked) - 1; i >= 0; i-- {
+		data = append(data, picked[i]...)
+	}
+	return &Dictionary{id, data}
+}
+
+// compressFrame returns data compressed with dict, after the frame header holding its ID
+func compressFrame(data []byte, dict *Dictionary) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(tCompressed)
+	buf.Write(appendUvarint(nil, uint64(dict.ID)))
+	w, err := flate.NewWriterDict(&buf, flate.BestCompression, dict.Data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressFrame returns the data of a compressed frame, using the dictionary of its ID,
+// within the MaxTotalBytes budget, or the length limit, of o
+func decompressFrame(data []byte, o *options) ([]byte, error) {
+	id, n := binary.Uvarint(data[1:])
+	if n <= 0 || id > 0xFFFFFFFF {
+		return nil, &DecoderError{"invalid compressed frame header"}
+	}
+	dict, ok := o.dicts[uint32(id)]
+	if !ok {
+		return nil, &DecoderError{fmt.Sprintf("unknown compression dictionary %d", id)}
+	}
+	fr := flate.NewReaderDict(bytes.NewReader(data[1+n:]), dict.Data)
+	defer fr.Close()
+	r, budget := io.Reader(fr), o.maxTotalBytes
+	if budget <= 0 {
+		budget = int64(o.limit)
+	}
+	if budget > 0 {
+		r = io.LimitReader(r, budget+1)
+	}
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, &DecoderError{fmt.Sprintf("invalid compressed frame: %v", err)}
+	}
+	if budget > 0 && int64(len(p)) > budget {
+		return nil, &DecoderError{fmt.Sprintf("compressed frame exceeds budget of %d bytes", budget)}
+	}
+	return p, nil
+}
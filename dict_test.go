@@ -0,0 +1,83 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testEvent struct {
+	Kind    string
+	User    string
+	Agent   string
+	Retries int
+}
+
+func TestDictionary(t *testing.T) {
+	event := func(i int) testEvent {
+		return testEvent{"page_view", fmt.Sprintf("user-%04d@example.com", i), "Mozilla/5.0 (X11; Linux x86_64)", i % 3}
+	}
+	var samples [][]byte
+	for i := 0; i < 50; i++ {
+		data, err := Marshal(event(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, data)
+	}
+	dict := TrainDictionary(7, samples, 1024)
+	if len(dict.Data) == 0 || len(dict.Data) > 1024 {
+		t.Fatalf("unexpected dictionary size %d", len(dict.Data))
+	}
+	assertEqual(t, dict, TrainDictionary(7, samples, 1024))
+
+	x := event(1000)
+	plain, _ := Marshal(x)
+	data, err := Marshal(x, WithDictionary(dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(plain)/2 {
+		t.Fatalf("compressed %d bytes into %d", len(plain), len(data))
+	}
+
+	var y testEvent
+	other := &Dictionary{ID: 8}
+	if err = Unmarshal(data, &y, WithDictionary(other), WithDictionary(dict)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+	if err = Unmarshal(data, &y, WithDictionary(other)); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = Unmarshal(data[:len(data)/2], &y, WithDictionary(dict)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDictionaryBudget(t *testing.T) {
+	dict := &Dictionary{ID: 1}
+	data, err := Marshal(strings.Repeat("x", 1<<20), WithDictionary(dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 1<<12 {
+		t.Fatalf("compressed into %d bytes", len(data))
+	}
+
+	var y string
+	for _, opt := range []Option{WithMaxTotalBytes(1 << 16), WithLimit(1 << 16)} {
+		// decompression stops at the budget, before decoding the value
+		err = Unmarshal(data, &y, WithDictionary(dict), opt)
+		if err == nil || !strings.Contains(err.Error(), "compressed frame exceeds") {
+			t.Fatal(err)
+		}
+	}
+	if err = Unmarshal(data, &y, WithDictionary(dict), WithMaxTotalBytes(2<<20)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 1<<20, len(y))
+}
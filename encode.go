@@ -4,15 +4,22 @@
 package godat
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding"
 	"encoding/binary"
 	"fmt"
+	"hash"
 	"io"
 	"math"
 	"reflect"
 	"strconv"
+	"time"
+	"unicode/utf8"
 )
 
+var bytesType = reflect.TypeOf([]byte(nil))
+
 type EncoderError struct {
 	ErrorString string
 }
@@ -22,128 +29,457 @@ func (e EncoderError) Error() string {
 }
 
 type Encoder struct {
-	w io.Writer
+	w   io.Writer
+	n   int64
+	sum hash.Hash
+	buf [9]byte // scratch space for type and header bytes
+	options
+
+	started bool        // stream header has been written
+	footed  bool        // index and checksum footers have been written
+	offsets []int64     // of top-level values, when writing an index
+	names   *fieldNames // defined in the stream WithFieldHashes
+	depth   int         // of nested values being encoded
 }
 
-func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w}
+func NewEncoder(w io.Writer, opts ...Option) *Encoder {
+	e := &Encoder{w: w}
+	e.apply(opts)
+	e.Reset(w)
+	return e
 }
 
-func (e *Encoder) write(t byte, v ...interface{}) error {
-	if _, err := e.w.Write([]byte{t}); err != nil {
-		return err
+func (e *Encoder) SetExactKinds(on bool) {
+	e.exactKinds = on
+}
+
+func (e *Encoder) SetCanonical(on bool) {
+	e.canonical = on
+}
+
+func (e *Encoder) SetErrorOnUnsupported(on bool) {
+	e.errorOnUnsupported = on
+}
+
+func (e *Encoder) SetPreserveEmpty(on bool) {
+	e.preserveEmpty = on
+}
+
+type closedWriter struct{}
+
+func (closedWriter) Write(p []byte) (int, error) {
+	return 0, &EncoderError{"write to closed encoder"}
+}
+
+func (e *Encoder) Reset(w io.Writer) {
+	e.w, e.n, e.offsets, e.sum = w, 0, nil, nil
+	e.started, e.footed, e.names = false, false, nil
+	if e.index {
+		e.offsets = []int64{}
+	}
+	if e.checksum {
+		e.sum = sha256.New()
+	}
+}
+
+func (e *Encoder) OutputOffset() int64 {
+	return e.n
+}
+
+// Close writes the index and checksum footers, if enabled and not written yet, and flushes
+// the underlying writer. No values may be encoded after Close.
+func (e *Encoder) Close() error {
+	if _, ok := e.w.(closedWriter); ok {
+		return nil
+	}
+	if e.started && !e.footed {
+		if err := e.writeFooters(); err != nil {
+			return err
+		}
+	}
+	w := e.w
+	e.w = closedWriter{}
+	if f, ok := w.(interface {
+		Flush() error
+	}); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (e *Encoder) clone(w io.Writer) *Encoder {
+	x := *e
+	x.w, x.n, x.offsets, x.sum = w, 0, nil, nil
+	x.footed = true // footers belong to the stream of e
+	x.started = true // values are appended to the stream of e
+	if e.names != nil {
+		x.names = &fieldNames{parent: e.names}
 	}
-	for _, vv := range v {
-		if err := binary.Write(e.w, binary.BigEndian, vv); err != nil {
+	return &x
+}
+
+// start writes the stream header before the first value
+func (e *Encoder) start() error {
+	e.started = true
+	switch e.formatVersion {
+	case 0, 1:
+	case 2:
+		if err := e.writeRaw([]byte{tVersion, 2}); err != nil {
 			return err
 		}
+	default:
+		return &EncoderError{fmt.Sprintf("unsupported format version %d", e.formatVersion)}
+	}
+	if e.littleEndian {
+		if err := e.writeRaw([]byte{tLittleEndian}); err != nil {
+			return err
+		}
+	}
+	if e.dedup {
+		return e.writeRaw([]byte{tRefs})
 	}
 	return nil
 }
 
-func (e *Encoder) encodeNil() error {
-	return e.write(tNil)
+func (e *Encoder) byteOrder() binary.ByteOrder {
+	if e.littleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
 }
 
-func (e *Encoder) encodeBool(v bool) error {
+func (e *Encoder) writeRaw(p []byte) error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	n, err := e.w.Write(p)
+	e.n += int64(n)
+	if e.sum != nil {
+		e.sum.Write(p[:n])
+	}
+	return err
+}
+
+func (e *Encoder) writeString(v string) error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	n, err := io.WriteString(e.w, v)
+	e.n += int64(n)
+	if e.sum != nil {
+		io.WriteString(e.sum, v[:n])
+	}
+	return err
+}
+
+func (e *Encoder) writeType(t byte) error {
+	e.buf[0] = t
+	return e.writeRaw(e.buf[:1])
+}
+
+// writeHeader writes type t followed by w bytes of x
+func (e *Encoder) writeHeader(t byte, w int, x uint64) error {
+	e.buf[0] = t
+	if e.littleEndian {
+		for i := 1; i <= w; i++ {
+			e.buf[i] = byte(x)
+			x >>= 8
+		}
+	} else {
+		for i := w; i > 0; i-- {
+			e.buf[i] = byte(x)
+			x >>= 8
+		}
+	}
+	return e.writeRaw(e.buf[:1+w])
+}
+
+// writeLength writes type t8, t16, t32 or, since format version 2, t64 of c followed by length n
+func (e *Encoder) writeLength(c byte, n int) error {
+	if n > 0 && uint64(n) > math.MaxUint32 && e.formatVersion >= 2 {
+		return e.writeHeader(c+t64, 8, uint64(n))
+	}
+	if err := checkLength(n); err != nil {
+		return err
+	}
+	if n <= 255 {
+		return e.writeHeader(c+t8, 1, uint64(n))
+	} else if n <= 65535 {
+		return e.writeHeader(c+t16, 2, uint64(n))
+	} else {
+		return e.writeHeader(c+t32, 4, uint64(n))
+	}
+}
+
+func (e *Encoder) EncodeNil() error {
+	return e.writeType(tNil)
+}
+
+func (e *Encoder) EncodeBool(v bool) error {
 	if v {
-		return e.write(tTrue)
+		return e.writeType(tTrue)
 	} else {
-		return e.write(tFalse)
+		return e.writeType(tFalse)
 	}
 }
 
-func (e *Encoder) encodeInt(v int64) error {
+func (e *Encoder) EncodeInt(v int64) error {
+	if e.formatVersion >= 2 && (v < -2147483648 || v > 2147483647) {
+		if x := uint64(v<<1 ^ v>>63); uvarintLen(x) < 8 {
+			return e.writeVarint(tVarint, x)
+		}
+	}
 	if v >= -128 && v <= 127 {
-		return e.write(tInt8, int8(v))
+		return e.writeHeader(tInt8, 1, uint64(v))
 	} else if v >= -32768 && v <= 32767 {
-		return e.write(tInt16, int16(v))
+		return e.writeHeader(tInt16, 2, uint64(v))
 	} else if v >= -2147483648 && v <= 2147483647 {
-		return e.write(tInt32, int32(v))
+		return e.writeHeader(tInt32, 4, uint64(v))
 	} else {
-		return e.write(tInt64, v)
+		return e.writeHeader(tInt64, 8, uint64(v))
 	}
 }
 
-func (e *Encoder) encodeUint(v uint64) error {
+func (e *Encoder) EncodeUint(v uint64) error {
+	if e.formatVersion >= 2 && v > 4294967295 && uvarintLen(v) < 8 {
+		return e.writeVarint(tUvarint, v)
+	}
 	if v <= 255 {
-		return e.write(tUint8, uint8(v))
+		return e.writeHeader(tUint8, 1, v)
 	} else if v <= 65535 {
-		return e.write(tUint16, uint16(v))
+		return e.writeHeader(tUint16, 2, v)
 	} else if v <= 4294967295 {
-		return e.write(tUint32, uint32(v))
+		return e.writeHeader(tUint32, 4, v)
 	} else {
-		return e.write(tUint64, v)
+		return e.writeHeader(tUint64, 8, v)
 	}
 }
 
-func (e *Encoder) encodeFloat(v float64) error {
+func checkFloat(v float64) error {
 	if math.IsInf(v, 0) || math.IsNaN(v) {
 		return &EncoderError{fmt.Sprintf("unsupported value %s", strconv.FormatFloat(v, 'g', -1, 64))}
 	}
-	if abs := math.Abs(v); abs >= math.SmallestNonzeroFloat32 && abs <= math.MaxFloat32 {
-		return e.write(tFloat32, float32(v))
+	return nil
+}
+
+func (e *Encoder) EncodeFloat(v float64) error {
+	if err := checkFloat(v); err != nil {
+		return err
+	}
+	if float64(float32(v)) == v {
+		return e.writeHeader(tFloat32, 4, uint64(math.Float32bits(float32(v))))
 	} else {
-		return e.write(tFloat64, v)
+		return e.writeHeader(tFloat64, 8, math.Float64bits(v))
 	}
 }
 
-func (e *Encoder) encodeString(v string) error {
-	if n := len(v); n <= 255 {
-		return e.write(tString8, uint8(n), []byte(v))
-	} else if n <= 65535 {
-		return e.write(tString16, uint16(n), []byte(v))
-	} else {
-		return e.write(tString32, uint32(n), []byte(v))
+func (e *Encoder) EncodeNumber(v Number) error {
+	switch v.Kind {
+	case reflect.Int8:
+		return e.writeHeader(tInt8, 1, v.bits)
+	case reflect.Int16:
+		return e.writeHeader(tInt16, 2, v.bits)
+	case reflect.Int32:
+		return e.writeHeader(tInt32, 4, v.bits)
+	case reflect.Int64:
+		return e.writeHeader(tInt64, 8, v.bits)
+	case reflect.Uint8:
+		return e.writeHeader(tUint8, 1, v.bits)
+	case reflect.Uint16:
+		return e.writeHeader(tUint16, 2, v.bits)
+	case reflect.Uint32:
+		return e.writeHeader(tUint32, 4, v.bits)
+	case reflect.Uint64:
+		return e.writeHeader(tUint64, 8, v.bits)
+	case reflect.Float32:
+		return e.writeHeader(tFloat32, 4, uint64(math.Float32bits(float32(math.Float64frombits(v.bits)))))
+	case reflect.Float64:
+		return e.writeHeader(tFloat64, 8, v.bits)
 	}
+	return &EncoderError{fmt.Sprintf("unsupported number kind %s", v.Kind)}
 }
 
-func (e *Encoder) encodeBinary(v []byte) error {
-	if n := len(v); n <= 255 {
-		return e.write(tBinary8, uint8(n), []byte(v))
-	} else if n <= 65535 {
-		return e.write(tBinary16, uint16(n), []byte(v))
-	} else {
-		return e.write(tBinary32, uint32(n), []byte(v))
+func checkLength(n int) error {
+	if n < 0 || uint64(n) > math.MaxUint32 {
+		return &EncoderError{fmt.Sprintf("unsupported length %d", n)}
 	}
+	return nil
 }
 
-func (e *Encoder) writeArrayType(n int) error {
-	if n <= 255 {
-		return e.write(tArray8, uint8(n))
-	} else if n <= 65535 {
-		return e.write(tArray16, uint16(n))
-	} else {
-		return e.write(tArray32, uint32(n))
+func (e *Encoder) EncodeString(v string) error {
+	if e.strictUTF8 && !utf8.ValidString(v) {
+		return &EncoderError{"invalid UTF-8 in string"}
+	}
+	if err := e.writeLength('S', len(v)); err != nil {
+		return err
+	}
+	return e.writeString(v)
+}
+
+func (e *Encoder) EncodeBinary(v []byte) error {
+	if err := e.writeLength('B', len(v)); err != nil {
+		return err
 	}
+	return e.writeRaw(v)
+}
+
+func (e *Encoder) EncodeArrayHeader(n int) error {
+	return e.writeLength('A', n)
+}
+
+// EncodeArrayStart begins an array of unknown length, its items are followed by EncodeArrayEnd.
+func (e *Encoder) EncodeArrayStart() error {
+	return e.writeType(tArrayStream)
+}
+
+func (e *Encoder) EncodeArrayEnd() error {
+	return e.writeType(tEnd)
 }
 
-func (e *Encoder) encodeArray(v reflect.Value) error {
+// EncodeChan encodes values received from channel ch as an array of unknown length,
+// which ends when the channel is closed.
+func (e *Encoder) EncodeChan(ch interface{}) error {
+	v := reflect.ValueOf(ch)
+	if v.Kind() != reflect.Chan || v.Type().ChanDir()&reflect.RecvDir == 0 {
+		return &EncoderError{fmt.Sprintf("unsupported channel type %T", ch)}
+	}
+	if err := e.EncodeArrayStart(); err != nil {
+		return err
+	}
+	elem := typeEncoder(v.Type().Elem())
+	for {
+		x, ok := v.Recv()
+		if !ok {
+			break
+		}
+		if err := elem(e, x); err != nil {
+			return err
+		}
+	}
+	return e.EncodeArrayEnd()
+}
+
+func (e *Encoder) EncodeCount(n int) error {
+	if err := checkLength(n); err != nil {
+		return err
+	}
+	return e.writeLength('N', n)
+}
+
+func (e *Encoder) encodeArray(v reflect.Value, elem encoderFunc) error {
 	n := v.Len()
-	if err := e.writeArrayType(n); err != nil {
+	if err := e.EncodeArrayHeader(n); err != nil {
 		return err
 	}
 	for i := 0; i < n; i++ {
-		if err := e.EncodeValue(v.Index(i)); err != nil {
+		if err := elem(e, v.Index(i)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (e *Encoder) writeObjectType(n int) error {
-	if n <= 255 {
-		return e.write(tObject8, uint8(n))
-	} else if n <= 65535 {
-		return e.write(tObject16, uint16(n))
-	} else {
-		return e.write(tObject32, uint32(n))
+func (e *Encoder) EncodeObjectHeader(n int) error {
+	return e.writeLength('O', n)
+}
+
+type encodedEntries [][2][]byte
+
+func (x encodedEntries) Len() int           { return len(x) }
+func (x encodedEntries) Less(i, j int) bool { return bytes.Compare(x[i][0], x[j][0]) < 0 }
+func (x encodedEntries) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+
+func (e *Encoder) encodeEntry(k, v reflect.Value) ([2][]byte, error) {
+	var kb, vb bytes.Buffer
+	if err := e.encodeKey(&kb, k); err != nil {
+		return [2][]byte{}, err
+	}
+	if err := e.clone(&vb).EncodeValue(v); err != nil {
+		return [2][]byte{}, err
+	}
+	return [2][]byte{kb.Bytes(), vb.Bytes()}, nil
+}
+
+// encodeKey encodes key k of a canonical object into w, writing numbers at the narrowest width of
+// their sign, so that equal keys of different kinds, e.g. in map[interface{}]interface{}, are equal
+func (e *Encoder) encodeKey(w io.Writer, k reflect.Value) error {
+	ke := e.clone(w)
+	ke.exactKinds = false
+	if k.Kind() == reflect.Interface && !k.IsNil() {
+		k = k.Elem()
 	}
+	if k.IsValid() && k.Type() == numberType {
+		return ke.encodeNarrowNumber(k.Interface().(Number))
+	}
+	return ke.EncodeValue(k)
+}
+
+func (e *Encoder) encodeNarrowNumber(n Number) error {
+	switch {
+	case n.isInt():
+		return e.EncodeInt(int64(n.bits))
+	case n.isUint():
+		return e.EncodeUint(n.bits)
+	}
+	return e.EncodeFloat(math.Float64frombits(n.bits))
+}
+
+// writeEntries writes entries ordered by the bytes of their keys, which is the total order of keys
+// in canonical objects: by type, then by length of strings and binaries, and by their bytes
+func (e *Encoder) writeEntries(x encodedEntries) error {
+	if err := sortEntries(x); err != nil {
+		return err
+	}
+	if err := e.EncodeObjectHeader(len(x)); err != nil {
+		return err
+	}
+	for _, kv := range x {
+		if err := e.writeRaw(kv[0]); err != nil {
+			return err
+		}
+		if err := e.writeRaw(kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func duplicateKeyError(k []byte) error {
+	return &EncoderError{fmt.Sprintf("duplicate canonical key % x", k)}
 }
 
 func (e *Encoder) encodeMap(v reflect.Value) error {
-	k := v.MapKeys()
-	if err := e.writeObjectType(len(k)); err != nil {
+	if e.canonical {
+		return e.encodeCanonicalMap(v)
+	}
+	if err := e.EncodeObjectHeader(v.Len()); err != nil {
+		return err
+	}
+	return rangeMap(v, func(k, v reflect.Value) error {
+		if err := e.EncodeValue(k); err != nil {
+			return err
+		}
+		return e.EncodeValue(v)
+	})
+}
+
+func (e *Encoder) encodeMapKeys(v reflect.Value, k []reflect.Value) error {
+	if e.canonical {
+		x := make(encodedEntries, len(k))
+		for i, kk := range k {
+			kv, err := e.encodeEntry(kk, v.MapIndex(kk))
+			if err != nil {
+				return err
+			}
+			x[i] = kv
+		}
+		return e.writeEntries(x)
+	}
+	if err := e.EncodeObjectHeader(len(k)); err != nil {
 		return err
 	}
 	for _, kk := range k {
@@ -157,26 +493,66 @@ func (e *Encoder) encodeMap(v reflect.Value) error {
 	return nil
 }
 
-func (e *Encoder) encodeObject(v reflect.Value) error {
-	if vb, ok := v.Interface().(encoding.BinaryMarshaler); ok {
-		data, err := vb.MarshalBinary()
+func (e *Encoder) encodeObject(v reflect.Value, si *structInfo, encs []encoderFunc) error {
+	if si.marshaler {
+		data, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
 		if err != nil {
 			return err
 		}
-		return e.encodeBinary(data)
+		return e.EncodeBinary(data)
+	}
+	if !e.canonical && si.inline < 0 {
+		return e.encodeFields(v, si, encs)
 	}
 
 	x := make(map[string]reflect.Value)
-	for i := 0; i < v.NumField(); i++ {
-		if f := v.Field(i); !skipValue(f) {
-			x[v.Type().Field(i).Name] = f
+	for _, sf := range si.fields {
+		if e.fieldSkipped(sf) {
+			continue
+		}
+		f := v.Field(sf.index)
+		if e.errorOnUnsupported && !isSupported(f) {
+			return &EncoderError{fmt.Sprintf("unsupported type %s in field %s.%s", f.Type(), v.Type(), v.Type().Field(sf.index).Name)}
+		}
+		if skipValue(f, e.preserveEmpty) {
+			continue
+		}
+		if sf.prec != noPrec {
+			f = quantized(f, sf.prec)
+		}
+		if e.fieldAsString(sf) {
+			f, _ = stringValue(f)
+		}
+		if e.fieldCompressed(sf, f) {
+			f = reflect.ValueOf(compressedValue{f})
+		}
+		x[e.fieldName(sf)] = f
+	}
+	if si.inline >= 0 {
+		// known fields take precedence over inlined keys
+		m := v.Field(si.inline)
+		for _, k := range m.MapKeys() {
+			if _, ok := x[k.String()]; !ok {
+				x[k.String()] = m.MapIndex(k)
+			}
 		}
 	}
-	if err := e.writeObjectType(len(x)); err != nil {
+	if e.canonical {
+		xe := make(encodedEntries, 0, len(x))
+		for k, v := range x {
+			kv, err := e.encodeEntry(reflect.ValueOf(k), v)
+			if err != nil {
+				return err
+			}
+			xe = append(xe, kv)
+		}
+		return e.writeEntries(xe)
+	}
+	if err := e.EncodeObjectHeader(len(x)); err != nil {
 		return err
 	}
 	for k, v := range x {
-		if err := e.encodeString(k); err != nil {
+		if err := e.encodeFieldName(k); err != nil {
 			return err
 		}
 		if err := e.EncodeValue(v); err != nil {
@@ -186,52 +562,102 @@ func (e *Encoder) encodeObject(v reflect.Value) error {
 	return nil
 }
 
-func (e *Encoder) EncodeValue(v reflect.Value) error {
-	switch v.Kind() {
-	case reflect.Bool:
-		return e.encodeBool(v.Bool())
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return e.encodeInt(v.Int())
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		return e.encodeUint(v.Uint())
-	case reflect.Float32, reflect.Float64:
-		return e.encodeFloat(v.Float())
-	case reflect.String:
-		return e.encodeString(v.String())
-	case reflect.Array, reflect.Slice:
-		iv := v.Interface()
-		switch iv := iv.(type) {
-		case []byte:
-			return e.encodeBinary(iv)
-		}
-		return e.encodeArray(v)
-	case reflect.Map:
-		return e.encodeMap(v)
-	case reflect.Struct:
-		return e.encodeObject(v)
-	case reflect.Interface, reflect.Ptr:
-		if v.IsNil() {
-			return e.encodeNil()
+// encodeFields writes struct fields in declaration order without intermediate allocations
+func (e *Encoder) encodeFields(v reflect.Value, si *structInfo, encs []encoderFunc) error {
+	n := 0
+	for _, sf := range si.fields {
+		f := v.Field(sf.index)
+		if e.errorOnUnsupported && !isSupported(f) {
+			return &EncoderError{fmt.Sprintf("unsupported type %s in field %s.%s", f.Type(), v.Type(), v.Type().Field(sf.index).Name)}
 		}
-		return e.EncodeValue(v.Elem())
+		if !e.fieldSkipped(sf) && !skipValue(f, e.preserveEmpty) {
+			n++
+		}
+	}
+	if err := e.EncodeObjectHeader(n); err != nil {
+		return err
 	}
-	return e.encodeNil()
+	for i, sf := range si.fields {
+		f := v.Field(sf.index)
+		if e.fieldSkipped(sf) || skipValue(f, e.preserveEmpty) {
+			continue
+		}
+		if err := e.encodeFieldName(e.fieldName(sf)); err != nil {
+			return err
+		}
+		if sf.prec != noPrec {
+			f = quantized(f, sf.prec)
+		}
+		var err error
+		if e.fieldAsString(sf) {
+			f, _ = stringValue(f)
+			err = e.EncodeValue(f)
+		} else if e.fieldCompressed(sf, f) {
+			err = e.encodeCompressed(f, encs[i])
+		} else {
+			err = encs[i](e, f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) EncodeValue(v reflect.Value) error {
+	if !v.IsValid() {
+		return e.EncodeNil()
+	}
+	return typeEncoder(v.Type())(e, v)
+}
+
+// EncodeAll encodes values like Marshal, including the count header and the footers if enabled,
+// which end the stream, so no values may be encoded after them.
+func (e *Encoder) EncodeAll(vv []interface{}) error {
+	return encode(e, vv)
 }
 
 func (e *Encoder) Encode(v interface{}) error {
-	return e.EncodeValue(reflect.ValueOf(v))
+	e.markValue()
+	encode := e.EncodeValue
+	if e.dedup {
+		encode = e.encodeDedup
+	}
+	if e.metrics == nil {
+		return encode(reflect.ValueOf(v))
+	}
+	n, start := e.n, time.Now()
+	err := encode(reflect.ValueOf(v))
+	e.metrics.Encoded(e.n-n, time.Since(start), err)
+	return err
+}
+
+// isSupported reports false for non-zero values that would be silently encoded as nil
+func isSupported(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return v.IsNil()
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex() == 0
+	}
+	return true
 }
 
-func skipValue(v reflect.Value) bool {
+func skipValue(v reflect.Value, preserveEmpty bool) bool {
 	switch v.Kind() {
 	case reflect.Array:
 		for i := 0; i < v.Len(); i++ {
-			if !skipValue(v.Index(i)) {
+			if !skipValue(v.Index(i), preserveEmpty) {
 				return false
 			}
 		}
 		return true
-	case reflect.Map, reflect.Slice, reflect.String:
+	case reflect.Map, reflect.Slice:
+		if preserveEmpty {
+			return v.IsNil()
+		}
+		return v.Len() == 0
+	case reflect.String:
 		return v.Len() == 0
 	case reflect.Bool:
 		return !v.Bool()
@@ -245,7 +671,7 @@ func skipValue(v reflect.Value) bool {
 		return v.IsNil()
 	case reflect.Struct:
 		for i := 0; i < v.NumField(); i++ {
-			if !skipValue(v.Field(i)) {
+			if !skipValue(v.Field(i), preserveEmpty) {
 				return false
 			}
 		}
@@ -0,0 +1,46 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package godat
+
+import (
+	"fmt"
+	"iter"
+	"reflect"
+)
+
+// EncodeSeq encodes the values of seq as an array of n items, or of unknown length if n < 0.
+// It fails if seq yields a different number of values than n.
+func EncodeSeq[T any](e *Encoder, seq iter.Seq[T], n int) error {
+	var err error
+	if n < 0 {
+		err = e.EncodeArrayStart()
+	} else {
+		err = e.EncodeArrayHeader(n)
+	}
+	if err != nil {
+		return err
+	}
+
+	enc := typeEncoder(reflect.TypeOf((*T)(nil)).Elem())
+	i := 0
+	for v := range seq {
+		if n >= 0 && i == n {
+			return &EncoderError{fmt.Sprintf("sequence longer than %d", n)}
+		}
+		if err = enc(e, reflect.ValueOf(&v).Elem()); err != nil {
+			return err
+		}
+		i++
+	}
+	if n < 0 {
+		return e.EncodeArrayEnd()
+	}
+	if i < n {
+		return &EncoderError{fmt.Sprintf("sequence of %d values shorter than %d", i, n)}
+	}
+	return nil
+}
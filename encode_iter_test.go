@@ -0,0 +1,33 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package godat
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestEncodeSeq(t *testing.T) {
+	for _, n := range []int{-1, 3} {
+		buf := new(bytes.Buffer)
+		if err := EncodeSeq(NewEncoder(buf), slices.Values([]int{1, 2, 3}), n); err != nil {
+			t.Fatal(err)
+		}
+		var y []int
+		if err := Unmarshal(buf.Bytes(), &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, []int{1, 2, 3}, y)
+	}
+
+	for _, n := range []int{2, 4} {
+		if err := EncodeSeq(NewEncoder(new(bytes.Buffer)), slices.Values([]int{1, 2, 3}), n); err == nil {
+			t.Fatal(n)
+		}
+	}
+}
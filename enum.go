@@ -0,0 +1,95 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type enum struct {
+	names  map[uint64]string
+	values map[string]uint64
+}
+
+var enums = struct {
+	sync.RWMutex
+	m map[reflect.Type]*enum
+}{m: make(map[reflect.Type]*enum)}
+
+// RegisterEnum makes values of an integer type encode as their String() names.
+// Decoding accepts both names and plain numbers; unnamed values are encoded as numbers.
+func RegisterEnum(values ...fmt.Stringer) {
+	if len(values) == 0 {
+		return
+	}
+	t := reflect.TypeOf(values[0])
+	if !isInteger(t.Kind()) {
+		panic(fmt.Sprintf("godat: RegisterEnum of non-integer type %s", t))
+	}
+
+	e := &enum{make(map[uint64]string), make(map[string]uint64)}
+	for _, x := range values {
+		v := reflect.ValueOf(x)
+		if v.Type() != t {
+			panic(fmt.Sprintf("godat: RegisterEnum of mixed types %s and %s", t, v.Type()))
+		}
+		bits, name := enumBits(v), x.String()
+		if _, ok := e.values[name]; ok {
+			panic(fmt.Sprintf("godat: RegisterEnum duplicate name %q", name))
+		}
+		e.names[bits] = name
+		e.values[name] = bits
+	}
+
+	enums.Lock()
+	enums.m[t] = e
+	enums.Unlock()
+}
+
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func enumBits(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int())
+	}
+	return v.Uint()
+}
+
+func enumOf(t reflect.Type) (*enum, bool) {
+	if t.PkgPath() == "" || !isInteger(t.Kind()) {
+		return nil, false
+	}
+	enums.RLock()
+	e, ok := enums.m[t]
+	enums.RUnlock()
+	return e, ok
+}
+
+func (d *Decoder) decodeEnum(v reflect.Value, e *enum, n int) error {
+	data, err := d.next(n)
+	if err != nil {
+		return err
+	}
+	bits, ok := e.values[string(data)]
+	if !ok {
+		return &DecoderError{fmt.Sprintf("unknown %s name %q", v.Type(), data)}
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(bits))
+	default:
+		v.SetUint(bits)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import "testing"
+
+type testColor uint8
+
+const (
+	testRed testColor = iota + 1
+	testGreen
+	testBlue
+)
+
+func (c testColor) String() string {
+	switch c {
+	case testRed:
+		return "red"
+	case testGreen:
+		return "green"
+	case testBlue:
+		return "blue"
+	}
+	return "unknown"
+}
+
+type testLevel int
+
+func (l testLevel) String() string {
+	if l < 0 {
+		return "low"
+	}
+	return "high"
+}
+
+func init() {
+	RegisterEnum(testRed, testGreen, testBlue)
+	RegisterEnum(testLevel(-1), testLevel(1))
+}
+
+func TestEnum(t *testing.T) {
+	x := map[testColor][]testLevel{
+		testRed:      {-1, 1},
+		testBlue:     {1},
+		testColor(9): {5},
+	}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y map[testColor][]testLevel
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+
+	var z map[interface{}][]interface{}
+	if err = Unmarshal(data, &z); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []interface{}{"low", "high"}, z["red"])
+	assertEqual(t, []interface{}{"high"}, z["blue"])
+}
+
+func TestEnumError(t *testing.T) {
+	data, err := Marshal("purple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y testColor
+	err = Unmarshal(data, &y)
+	if _, ok := err.(*DecoderError); !ok {
+		t.Fatal(err)
+	}
+	_ = err.Error()
+
+	data, err = Marshal(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, testGreen, y)
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// Envelope wraps a record with metadata, which readers may filter by before decoding the payload.
+// Envelopes are encoded as arrays of the metadata followed by the payload. When decoding, a non-nil
+// pointer in Payload receives the payload, otherwise it is decoded into interface{}.
+type Envelope struct {
+	Time     time.Time
+	Source   string
+	Schema   string
+	Metadata map[string]string
+	Payload  interface{}
+}
+
+const envelopeSize = 5
+
+var envelopeType = reflect.TypeOf(Envelope{})
+
+func envelopeEncoder(e *Encoder, v reflect.Value) error {
+	env := v.Interface().(Envelope)
+	if err := e.EncodeArrayHeader(envelopeSize); err != nil {
+		return err
+	}
+	if err := e.EncodeTime(env.Time); err != nil {
+		return err
+	}
+	if err := e.EncodeString(env.Source); err != nil {
+		return err
+	}
+	if err := e.EncodeString(env.Schema); err != nil {
+		return err
+	}
+	if err := e.EncodeValue(reflect.ValueOf(env.Metadata)); err != nil {
+		return err
+	}
+	return e.EncodeValue(reflect.ValueOf(env.Payload))
+}
+
+func envelopeDecoder(d *Decoder, t byte, v reflect.Value) error {
+	if typeOf(t) != ArrayType || !v.CanAddr() {
+		return d.decodeType(t, v)
+	}
+	env := v.Addr().Interface().(*Envelope)
+	if err := d.decodeEnvelopeHeader(t, env); err != nil {
+		return err
+	}
+	return d.decodeEnvelopePayload(env)
+}
+
+func (d *Decoder) decodeEnvelopeHeader(t byte, env *Envelope) error {
+	n, err := d.readLength(t)
+	if err != nil {
+		return err
+	}
+	if n != envelopeSize {
+		return &DecoderError{fmt.Sprintf("invalid envelope of %d values", n)}
+	}
+	env.Metadata = nil
+	for _, x := range []interface{}{&env.Time, &env.Source, &env.Schema, &env.Metadata} {
+		if err = d.decodeValue(reflect.ValueOf(x)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) decodeEnvelopePayload(env *Envelope) error {
+	if v := reflect.ValueOf(env.Payload); v.Kind() == reflect.Ptr && !v.IsNil() {
+		return d.decodeValue(v)
+	}
+	var x interface{}
+	if err := d.decodeValue(reflect.ValueOf(&x)); err != nil {
+		return err
+	}
+	env.Payload = x
+	return nil
+}
+
+// DecodeEnvelope decodes the metadata of the next envelope into env and reports whether match
+// accepts it. Payloads of accepted envelopes are decoded like Decode, others are skipped.
+// A nil match accepts every envelope.
+func (d *Decoder) DecodeEnvelope(env *Envelope, match func(env *Envelope) bool) (bool, error) {
+	return d.decodeEnvelope(env, match, func() error {
+		return d.decodeEnvelopePayload(env)
+	})
+}
+
+// decodeEnvelope decodes the next envelope into env and calls payload to consume the payload
+// of accepted envelopes
+func (d *Decoder) decodeEnvelope(env *Envelope, match func(env *Envelope) bool, payload func() error) (bool, error) {
+	ok := false
+	err := d.topLevel(func() error {
+		t, err := d.readType()
+		if err != nil {
+			return err
+		}
+		if tt := typeOf(t); tt != ArrayType {
+			return &DecoderTypeError{tt.String(), envelopeType}
+		}
+		if err = d.decodeEnvelopeHeader(t, env); err != nil {
+			return err
+		}
+		if match != nil && !match(env) {
+			_, err = d.readRaw(nil)
+			return err
+		}
+		ok = true
+		return payload()
+	})
+	return ok, err
+}
+
+// ReplayFilter selects envelopes by time range, source and schema. Zero bounds and empty lists
+// match every envelope.
+type ReplayFilter struct {
+	From    time.Time // inclusive
+	To      time.Time // inclusive
+	Sources []string
+	Schemas []string
+}
+
+// Match reports whether env is selected by the filter.
+func (f *ReplayFilter) Match(env *Envelope) bool {
+	if !f.From.IsZero() && env.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && env.Time.After(f.To) {
+		return false
+	}
+	return matchAny(f.Sources, env.Source) && matchAny(f.Schemas, env.Schema)
+}
+
+func matchAny(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return len(list) == 0
+}
+
+// Replay reads envelopes from r and calls fn for those matching filter with the Decoder positioned
+// at the payload, which fn may decode with a single Decode call. Payloads left unread by fn and of
+// envelopes not matching filter are skipped without being decoded.
+func Replay(r io.Reader, filter ReplayFilter, fn func(env *Envelope, dec *Decoder) error, opts ...Option) error {
+	dec := NewDecoder(r, opts...)
+	for {
+		var env Envelope
+		_, err := dec.decodeEnvelope(&env, filter.Match, func() error {
+			offset := dec.InputOffset()
+			if err := fn(&env, dec); err != nil {
+				return err
+			}
+			if dec.InputOffset() == offset {
+				_, err := dec.readRaw(nil)
+				return err
+			}
+			return nil
+		})
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestMarshalEnvelope(t *testing.T) {
+	x := Envelope{
+		Time:     time.Unix(1500000000, 42).UTC(),
+		Source:   "billing",
+		Schema:   "invoice.v2",
+		Metadata: map[string]string{"tenant": "acme"},
+		Payload:  NewTestInputObject(),
+	}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := &TestInputObject{}
+	y := Envelope{Payload: payload}
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x.Payload, payload)
+	y.Payload = x.Payload
+	assertEqual(t, x, y)
+
+	var z Envelope
+	if err = Unmarshal(data, &z); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "acme", z.Metadata["tenant"])
+	if _, ok := z.Payload.(map[interface{}]interface{}); !ok {
+		t.Fatal("payload should decode into interface{}")
+	}
+}
+
+func TestDecoderDecodeEnvelope(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for i, source := range []string{"billing", "auth", "billing", "auth"} {
+		env := &Envelope{Time: time.Unix(int64(i), 0), Source: source, Payload: i}
+		if err := enc.Encode(env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Encode(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var y []int
+	dec := NewDecoder(&buf)
+	for i := 0; i < 4; i++ {
+		var n int
+		env := Envelope{Payload: &n}
+		ok, err := dec.DecodeEnvelope(&env, func(env *Envelope) bool {
+			return env.Source == "auth"
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			y = append(y, n)
+		}
+	}
+	assertEqual(t, []int{1, 3}, y)
+
+	var env Envelope
+	if _, err := dec.DecodeEnvelope(&env, nil); err == nil {
+		t.Fatal("nil should not decode into envelope")
+	}
+	if _, err := dec.DecodeEnvelope(&env, nil); err != io.EOF {
+		t.Fatal(err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	start := time.Unix(1500000000, 0)
+	for i := 0; i < 100; i++ {
+		env := &Envelope{Time: start.Add(time.Duration(i) * time.Second), Source: "billing", Schema: "count", Payload: i}
+		if i%2 == 1 {
+			env.Source, env.Schema, env.Payload = "auth", "login", "user"
+		}
+		if err := enc.Encode(env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := buf.Bytes()
+
+	var y []int
+	filter := ReplayFilter{From: start.Add(10 * time.Second), To: start.Add(20 * time.Second), Schemas: []string{"count"}}
+	err := Replay(bytes.NewReader(data), filter, func(env *Envelope, dec *Decoder) error {
+		var n int
+		if err := dec.Decode(&n); err != nil {
+			return err
+		}
+		assertEqual(t, start.Add(time.Duration(n)*time.Second).Unix(), env.Time.Unix())
+		y = append(y, n)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []int{10, 12, 14, 16, 18, 20}, y)
+
+	// payloads left unread are skipped
+	n := 0
+	err = Replay(bytes.NewReader(data), ReplayFilter{Sources: []string{"auth", "other"}}, func(env *Envelope, dec *Decoder) error {
+		assertEqual(t, "login", env.Schema)
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 50, n)
+
+	err = Replay(bytes.NewReader(data), ReplayFilter{}, func(*Envelope, *Decoder) error {
+		return io.ErrClosedPipe
+	})
+	if err != io.ErrClosedPipe {
+		t.Fatal("error of fn should stop replay")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const (
+	eventMagic         = "GDEV"
+	eventTrailerSize   = 8 + len(eventMagic)
+	eventIndexInterval = 64
+)
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+type EventWriter struct {
+	w     *countingWriter
+	enc   *Encoder
+	n     int
+	last  int64
+	index []int64 // pairs of timestamp and offset
+}
+
+func NewEventWriter(w io.Writer, opts ...Option) *EventWriter {
+	cw := &countingWriter{w: w}
+	enc := NewEncoder(cw, opts...)
+	enc.footed = true // the event index ends the stream
+	return &EventWriter{w: cw, enc: enc}
+}
+
+func (w *EventWriter) Write(v interface{}) error {
+	return w.WriteAt(time.Now(), v)
+}
+
+func (w *EventWriter) WriteAt(t time.Time, v interface{}) error {
+	ts := t.UnixNano()
+	if w.n > 0 && ts < w.last {
+		return &EncoderError{fmt.Sprintf("event at %s is older than the previous one", t)}
+	}
+	if w.n%eventIndexInterval == 0 {
+		w.index = append(w.index, ts, w.w.n)
+		w.enc.names = nil // indexed events are decoded on their own
+	}
+	if err := w.enc.EncodeNumber(Number{Kind: reflect.Int64, bits: uint64(ts)}); err != nil {
+		return err
+	}
+	if err := w.enc.Encode(v); err != nil {
+		return err
+	}
+	w.n++
+	w.last = ts
+	return nil
+}
+
+func (w *EventWriter) Close() error {
+	offset := w.w.n
+	if err := w.enc.Encode(w.index); err != nil {
+		return err
+	}
+	trailer := make([]byte, eventTrailerSize)
+	binary.BigEndian.PutUint64(trailer, uint64(offset))
+	copy(trailer[8:], eventMagic)
+	if _, err := w.w.Write(trailer); err != nil {
+		return err
+	}
+	return w.enc.Close()
+}
+
+type EventReader struct {
+	r     io.ReadSeeker
+	hdr   *Decoder // of the stream header
+	end   int64
+	index []int64
+}
+
+func NewEventReader(r io.ReadSeeker, opts ...Option) (*EventReader, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size < int64(eventTrailerSize) {
+		return nil, &DecoderError{"missing event index"}
+	}
+	if _, err = r.Seek(size-int64(eventTrailerSize), io.SeekStart); err != nil {
+		return nil, err
+	}
+	trailer := make([]byte, eventTrailerSize)
+	if _, err = io.ReadFull(r, trailer); err != nil {
+		return nil, err
+	}
+	if string(trailer[8:]) != eventMagic {
+		return nil, &DecoderError{"missing event index"}
+	}
+	er := &EventReader{r: r, end: int64(binary.BigEndian.Uint64(trailer))}
+	if er.end < 0 || er.end > size-int64(eventTrailerSize) {
+		return nil, &DecoderError{fmt.Sprintf("invalid event index offset %d", er.end)}
+	}
+	if er.hdr, err = headerDecoder(r, opts); err != nil {
+		return nil, err
+	}
+	if _, err = r.Seek(er.end, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err = er.hdr.clone(r).Decode(&er.index); err != nil {
+		return nil, err
+	}
+	if len(er.index)%2 != 0 {
+		return nil, &DecoderError{"invalid event index"}
+	}
+	return er, nil
+}
+
+func (r *EventReader) ReadBetween(t1, t2 time.Time, fn func(t time.Time, dec *Decoder) error) error {
+	from, to := t1.UnixNano(), t2.UnixNano()
+
+	// start from the last indexed event that is strictly older than t1
+	n := len(r.index) / 2
+	i := sort.Search(n, func(i int) bool { return r.index[2*i] >= from })
+	offset := int64(0)
+	if i > 0 {
+		offset = r.index[2*(i-1)+1]
+	}
+	if _, err := r.r.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	dec := r.hdr.clone(io.LimitReader(r.r, r.end-offset))
+	for {
+		ts, err := dec.DecodeInt64()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if ts > to {
+			return nil
+		}
+		raw, err := dec.readRaw(nil)
+		if err != nil {
+			return err
+		}
+		if ts < from {
+			continue
+		}
+		if err = fn(time.Unix(0, ts), dec.clone(bytes.NewReader(raw))); err != nil {
+			return err
+		}
+	}
+}
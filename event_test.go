@@ -0,0 +1,136 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventReadBetween(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	start := time.Unix(1500000000, 0)
+	w := NewEventWriter(f)
+	for i := 0; i < 1000; i++ {
+		err = w.WriteAt(start.Add(time.Duration(i)*time.Second), i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewEventReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y []int
+	err = r.ReadBetween(start.Add(500*time.Second), start.Add(509*time.Second), func(ts time.Time, dec *Decoder) error {
+		var i int
+		if err := dec.Decode(&i); err != nil {
+			return err
+		}
+		assertEqual(t, start.Add(time.Duration(i)*time.Second).UnixNano(), ts.UnixNano())
+		y = append(y, i)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, []int{500, 501, 502, 503, 504, 505, 506, 507, 508, 509}, y)
+
+	n := 0
+	err = r.ReadBetween(start.Add(-time.Hour), start.Add(time.Hour), func(time.Time, *Decoder) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 1000, n)
+}
+
+func TestEventWriterOrderError(t *testing.T) {
+	w := NewEventWriter(new(bytes.Buffer))
+	err := w.WriteAt(time.Unix(10, 0), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.WriteAt(time.Unix(9, 0), 2)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestEventReaderIndexError(t *testing.T) {
+	data, err := Marshal(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewEventReader(bytes.NewReader(data))
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestEventReadBetweenHeader(t *testing.T) {
+	type event struct {
+		ID   int
+		Tags []string
+	}
+
+	buf := new(bytes.Buffer)
+	start := time.Unix(1500000000, 0)
+	w := NewEventWriter(buf, WithLittleEndian(), WithFieldHashes(), WithDedup())
+	for i := 0; i < 200; i++ {
+		tag := strings.Repeat("t", 16)
+		err := w.WriteAt(start.Add(time.Duration(i)*time.Second), event{i, []string{tag, tag}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewEventReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y []int
+	err = r.ReadBetween(start.Add(130*time.Second), start.Add(132*time.Second), func(ts time.Time, dec *Decoder) error {
+		var x event
+		if err := dec.Decode(&x); err != nil {
+			return err
+		}
+		assertEqual(t, start.Add(time.Duration(x.ID)*time.Second).UnixNano(), ts.UnixNano())
+		assertEqual(t, []string{strings.Repeat("t", 16), strings.Repeat("t", 16)}, x.Tags)
+		y = append(y, x.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []int{130, 131, 132}, y)
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+)
+
+// fieldNames maps hashes to field names defined in the stream of an Encoder, or of its parents
+type fieldNames struct {
+	parent *fieldNames
+	m      map[uint32]string
+}
+
+func (t *fieldNames) lookup(h uint32) (string, bool) {
+	for ; t != nil; t = t.parent {
+		if name, ok := t.m[h]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func fieldHash(name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return h.Sum32()
+}
+
+// encodeFieldName encodes name of a struct field, which is defined once per stream WithFieldHashes
+func (e *Encoder) encodeFieldName(name string) error {
+	if !e.fieldHashes || e.canonical {
+		return e.EncodeString(name)
+	}
+	if e.names == nil {
+		e.names = &fieldNames{}
+	}
+	h := fieldHash(name)
+	s, ok := e.names.lookup(h)
+	if ok && s != name {
+		return e.EncodeString(name) // colliding names are not hashed
+	}
+	var p [5]byte
+	e.byteOrder().PutUint32(p[1:], h)
+	if ok {
+		p[0] = tFieldHash
+		return e.writeRaw(p[:])
+	}
+	if e.names.m == nil {
+		e.names.m = make(map[uint32]string)
+	}
+	e.names.m[h] = name
+	p[0] = tFieldName
+	if err := e.writeRaw(p[:]); err != nil {
+		return err
+	}
+	return e.EncodeString(name)
+}
+
+// readFieldName returns the encoded name of hash h, reading its definition following tFieldName
+func (d *Decoder) readFieldName(t byte, h uint32) ([]byte, error) {
+	if t == tFieldHash {
+		name, ok := d.names[h]
+		if !ok {
+			return nil, &DecoderError{fmt.Sprintf("unknown field name hash %#08x", h)}
+		}
+		return name, nil
+	}
+	name, err := d.readRaw(nil)
+	if err != nil {
+		return nil, err
+	}
+	if typeOf(name[0]) != StringType {
+		return nil, &DecoderError{fmt.Sprintf("field name of hash %#08x is %s", h, typeOf(name[0]))}
+	}
+	if old, ok := d.names[h]; ok && !bytes.Equal(old, name) {
+		return nil, &DecoderError{fmt.Sprintf("conflicting field names of hash %#08x", h)}
+	}
+	if d.names == nil {
+		d.names = make(map[uint32][]byte)
+	}
+	d.names[h] = name
+	return name, nil
+}
+
+func (d *Decoder) decodeFieldName(t byte, v reflect.Value) error {
+	var h uint32
+	if err := d.read(&h); err != nil {
+		return err
+	}
+	name, err := d.readFieldName(t, h)
+	if err != nil {
+		return err
+	}
+	return d.withData(name, d.r.n, func() error {
+		t, err := d.readType()
+		if err != nil {
+			return err
+		}
+		return d.decodeType(t, v)
+	})
+}
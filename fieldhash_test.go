@@ -0,0 +1,75 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testTreeNode struct {
+	Identifier  int
+	Description string
+	Children    []testTreeNode
+}
+
+func TestMarshalFieldHashes(t *testing.T) {
+	x := testTreeNode{1, "root", []testTreeNode{{2, "a", nil}, {3, "b", nil}, {4, "c", nil}}}
+	plain, err := Marshal(x, x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(x, x, WithFieldHashes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(plain)*3/4 {
+		t.Fatalf("hashed names do not shrink %d bytes: %d", len(plain), len(data))
+	}
+	assertEqual(t, 3, bytes.Count(data, []byte{tFieldName}))
+
+	var y1, y2 testTreeNode
+	if err = Unmarshal(data, &y1, &y2); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y1)
+	assertEqual(t, x, y2)
+
+	// names are resolved for untyped values, copies and parallel decoders
+	var m map[string]interface{}
+	if err = Unmarshal(data[bytes.Index(data, []byte("Children"))+len("Children"):], &m); err == nil {
+		t.Fatal("undefined hashes should not unmarshal")
+	}
+	dec := NewDecoder(bytes.NewReader(data))
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		if err = CopyValue(NewEncoder(&buf), dec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertEqual(t, plain, buf.Bytes())
+	if err = Unmarshal(data, &y1, &m, WithParallel()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "root", m["Description"])
+
+	data, err = Marshal(x, WithFieldHashes(), WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 0, bytes.Count(data, []byte{tFieldName}))
+}
+
+func TestDumpFieldHashesIndex(t *testing.T) {
+	b := NewMemoryBackend()
+	x := testTreeNode{Identifier: 1}
+	if err := Dump("a.dat", x, x, WithBackend(b), WithIndex(), WithFieldHashes()); err != nil {
+		t.Fatal(err)
+	}
+	var y testTreeNode
+	if err := LoadNth("a.dat", 1, &y, WithBackend(b)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+}
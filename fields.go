@@ -0,0 +1,198 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"encoding"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+
+// Defaulter is implemented by structs that set defaults of fields absent in the decoded object.
+type Defaulter interface {
+	SetDefaults()
+}
+
+var defaulterType = reflect.TypeOf((*Defaulter)(nil)).Elem()
+
+// field describes a struct field as configured by its `godat:"name,opts"` tag
+type field struct {
+	name       string
+	tagged     bool // name is set by the tag
+	index      int
+	deprecated bool
+	asString   bool
+	compress   bool
+	prec       int // decimal digits floats are rounded to by `prec=N`, or noPrec
+
+	// `json:"name,opts"` tag, used WithJSONTags when there is no godat tag
+	json       string
+	jsonSkip   bool
+	jsonString bool
+}
+
+const noPrec = math.MinInt32
+
+type structInfo struct {
+	fields []field
+	byName map[string]int
+	inline int // index of the `godat:",inline"` map field or -1
+
+	marshaler bool // implements encoding.BinaryMarshaler
+	defaulter bool // pointer implements Defaulter
+}
+
+var structCache = struct {
+	sync.RWMutex
+	m map[reflect.Type]*structInfo
+}{m: make(map[reflect.Type]*structInfo)}
+
+func parseTag(tag string) (string, []string) {
+	opts := strings.Split(tag, ",")
+	return opts[0], opts[1:]
+}
+
+func structInfoOf(t reflect.Type) *structInfo {
+	structCache.RLock()
+	si, ok := structCache.m[t]
+	structCache.RUnlock()
+	if ok {
+		return si
+	}
+
+	si = &structInfo{byName: make(map[string]int), inline: -1}
+	si.marshaler = t.Implements(binaryMarshalerType)
+	si.defaulter = reflect.PtrTo(t).Implements(defaulterType)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("godat")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+		f := field{name: sf.Name, index: i, prec: noPrec}
+		if tag, hasJSON := sf.Tag.Lookup("json"); !ok && hasJSON {
+			f.jsonSkip = tag == "-"
+			f.json, opts = parseTag(tag)
+			for _, opt := range opts {
+				f.jsonString = f.jsonString || opt == "string"
+			}
+			opts = nil
+		}
+		if name != "" {
+			f.name, f.tagged = name, true
+		}
+		for _, opt := range opts {
+			if strings.HasPrefix(opt, "prec=") {
+				if n, err := strconv.Atoi(opt[len("prec="):]); err == nil {
+					f.prec = n
+				}
+				continue
+			}
+			switch opt {
+			case "deprecated":
+				f.deprecated = true
+			case "string":
+				f.asString = true
+			case "compress":
+				f.compress = true
+			case "inline":
+				if sf.Type.Kind() == reflect.Map && sf.Type.Key().Kind() == reflect.String {
+					si.inline = i
+				}
+			}
+		}
+		if si.inline == i {
+			continue
+		}
+		si.byName[f.name] = len(si.fields)
+		si.fields = append(si.fields, f)
+	}
+
+	structCache.Lock()
+	structCache.m[t] = si
+	structCache.Unlock()
+	return si
+}
+
+func (o *options) fieldName(f field) string {
+	switch {
+	case f.tagged:
+		return f.name
+	case o.jsonTags && f.json != "":
+		return f.json
+	case o.fieldNamer != nil:
+		return o.fieldNamer(f.name)
+	}
+	return f.name
+}
+
+func (o *options) fieldSkipped(f field) bool {
+	return o.jsonTags && f.jsonSkip
+}
+
+func (o *options) fieldAsString(f field) bool {
+	return f.asString || o.jsonTags && f.jsonString
+}
+
+func (si *structInfo) lookup(o *options, name string) (field, bool) {
+	if o.fieldNamer == nil && !o.jsonTags {
+		i, ok := si.byName[name]
+		if !ok {
+			return field{}, false
+		}
+		return si.fields[i], true
+	}
+	for _, f := range si.fields {
+		if !o.fieldSkipped(f) && o.fieldName(f) == name {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// SnakeCase maps Go field names like "UserID" to "user_id", for use WithFieldNamer.
+func SnakeCase(name string) string {
+	rs := []rune(name)
+	buf := make([]rune, 0, len(rs)+4)
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			if i > 0 && (!unicode.IsUpper(rs[i-1]) || i+1 < len(rs) && unicode.IsLower(rs[i+1])) && rs[i-1] != '_' {
+				buf = append(buf, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		buf = append(buf, r)
+	}
+	return string(buf)
+}
+
+// stringValue formats numbers and booleans for fields tagged `godat:",string"`
+func stringValue(v reflect.Value) (reflect.Value, bool) {
+	var s string
+	switch v.Kind() {
+	case reflect.Bool:
+		s = strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		s = strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v, false
+		}
+		return stringValue(v.Elem())
+	default:
+		return v, false
+	}
+	return reflect.ValueOf(s), true
+}
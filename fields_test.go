@@ -0,0 +1,217 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testTagged struct {
+	ID      int    `godat:"id"`
+	Name    string `godat:",deprecated"`
+	Title   string `godat:"title,deprecated"`
+	Ignored string `godat:"-"`
+}
+
+func TestStructTags(t *testing.T) {
+	x := testTagged{ID: 1, Name: "a", Title: "b", Ignored: "c"}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]interface{}
+	if err = Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]interface{}{"id": int64(1), "Name": "a", "title": "b"}, m)
+
+	var y testTagged
+	var warnings []string
+	err = Unmarshal(data, &y, WithDeprecationWarning(func(typ reflect.Type, field string) {
+		assertEqual(t, reflect.TypeOf(y), typ)
+		warnings = append(warnings, field)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.Ignored = ""
+	assertEqual(t, x, y)
+	assertEqual(t, 2, len(warnings))
+
+	data, err = Marshal(map[string]string{"Ignored": "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Unmarshal(data, &y)
+	if _, ok := err.(*DecoderTypeError); !ok {
+		t.Fatal(err)
+	}
+}
+
+type testStringTagged struct {
+	A int64   `godat:",string"`
+	B uint64  `godat:"b,string"`
+	C float32 `godat:",string"`
+	D *bool   `godat:",string"`
+	E []int   `godat:",string"`
+}
+
+func TestStructTagString(t *testing.T) {
+	d := true
+	x := testStringTagged{A: -1 << 62, B: 1<<64 - 1, C: 1.5, D: &d, E: []int{1}}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]interface{}
+	if err = Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "-4611686018427387904", m["A"])
+	assertEqual(t, "18446744073709551615", m["b"])
+	assertEqual(t, "1.5", m["C"])
+	assertEqual(t, "true", m["D"])
+
+	var y testStringTagged
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"A":          "a",
+		"UserID":     "user_id",
+		"HTTPServer": "http_server",
+		"Field2Name": "field2_name",
+		"Snake_Case": "snake_case",
+		"lower":      "lower",
+	} {
+		assertEqual(t, expected, SnakeCase(name))
+	}
+}
+
+func TestFieldNamer(t *testing.T) {
+	type testNamed struct {
+		UserID   int
+		UserName string `godat:"Name"`
+	}
+
+	x := testNamed{1, "a"}
+	data, err := Marshal(x, WithFieldNamer(SnakeCase))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]interface{}
+	if err = Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]interface{}{"user_id": int64(1), "Name": "a"}, m)
+
+	var y testNamed
+	if err = Unmarshal(data, &y, WithFieldNamer(SnakeCase)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+
+	err = Unmarshal(data, &y)
+	if _, ok := err.(*DecoderTypeError); !ok {
+		t.Fatal(err)
+	}
+}
+
+func TestJSONTags(t *testing.T) {
+	type testJSONTagged struct {
+		ID      int64  `json:"id,string"`
+		Name    string `json:"name,omitempty"`
+		Title   string `json:"title" godat:"Title"`
+		Skipped string `json:"-"`
+		Other   int    `json:",omitempty"`
+	}
+
+	x := testJSONTagged{1, "a", "b", "c", 2}
+	data, err := Marshal(x, WithJSONTags())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]interface{}
+	if err = Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]interface{}{"id": "1", "name": "a", "Title": "b", "Other": int64(2)}, m)
+
+	var y testJSONTagged
+	if err = Unmarshal(data, &y, WithJSONTags()); err != nil {
+		t.Fatal(err)
+	}
+	x.Skipped = ""
+	assertEqual(t, x, y)
+
+	data, err = Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]interface{}{"ID": int64(1), "Name": "a", "Title": "b", "Other": int64(2)}, m)
+}
+
+func TestStructTagInline(t *testing.T) {
+	type testInline struct {
+		Name  string
+		Extra map[string]interface{} `godat:",inline"`
+	}
+
+	x := testInline{"a", map[string]interface{}{"Name": "ignored", "b": true}}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]interface{}
+	if err = Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]interface{}{"Name": "a", "b": true}, m)
+
+	var y testInline
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, testInline{"a", map[string]interface{}{"b": true}}, y)
+}
+
+type testDefaults struct {
+	Host string
+	Port int
+}
+
+func (x *testDefaults) SetDefaults() {
+	x.Host, x.Port = "localhost", 80
+}
+
+func TestDefaulter(t *testing.T) {
+	data, err := Marshal(map[string]interface{}{"Port": 8080})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x testDefaults
+	if err = Unmarshal(data, &x); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, testDefaults{"localhost", 8080}, x)
+
+	x = testDefaults{"example.com", 1}
+	if err = Unmarshal(data, &x, WithInPlace()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, testDefaults{"localhost", 8080}, x)
+}
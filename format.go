@@ -0,0 +1,141 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Ext is an extension value of format version 2, which holds data of an application-defined type code.
+type Ext struct {
+	Code byte
+	Data []byte
+}
+
+var extType = reflect.TypeOf(Ext{})
+
+func uvarintLen(x uint64) int {
+	n := 1
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
+
+func (e *Encoder) writeVarint(t byte, x uint64) error {
+	var p [1 + binary.MaxVarintLen64]byte
+	p[0] = t
+	return e.writeRaw(p[:1+binary.PutUvarint(p[1:], x)])
+}
+
+// EncodeExt encodes x as an extension value, which requires format version 2.
+func (e *Encoder) EncodeExt(x Ext) error {
+	if e.formatVersion < 2 {
+		return &EncoderError{"extension values require format version 2"}
+	}
+	if err := e.writeLength('X', len(x.Data)); err != nil {
+		return err
+	}
+	if err := e.writeType(x.Code); err != nil {
+		return err
+	}
+	return e.writeRaw(x.Data)
+}
+
+func extEncoder(e *Encoder, v reflect.Value) error {
+	return e.EncodeExt(v.Interface().(Ext))
+}
+
+// FormatVersion returns the format version recorded in the stream header.
+func (d *Decoder) FormatVersion() (int, error) {
+	if err := d.readHeader(); err != nil {
+		return 0, err
+	}
+	if d.version == 0 {
+		return 1, nil
+	}
+	return d.version, nil
+}
+
+// readVersion reads the format version following its stream header type
+func (d *Decoder) readVersion() error {
+	var v uint8
+	if err := d.read(&v); err != nil {
+		return err
+	}
+	if v < 1 || v > 2 {
+		return &DecoderError{fmt.Sprintf("unsupported format version %d", v)}
+	}
+	d.version = int(v)
+	return nil
+}
+
+// readVarint appends the bytes of the next varint to buf
+func (d *Decoder) readVarint(buf []byte) ([]byte, error) {
+	var b [1]byte
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		if _, err := io.ReadFull(d.r, b[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return buf, err
+		}
+		if buf = append(buf, b[0]); b[0] < 0x80 {
+			return buf, nil
+		}
+	}
+	return buf, &DecoderError{"varint overflows 64 bits"}
+}
+
+func (d *Decoder) readUvarint() (uint64, error) {
+	var a [binary.MaxVarintLen64]byte
+	p, err := d.readVarint(a[:0])
+	if err != nil {
+		return 0, err
+	}
+	x, n := binary.Uvarint(p)
+	if n <= 0 {
+		return 0, &DecoderError{"varint overflows 64 bits"}
+	}
+	return x, nil
+}
+
+func (d *Decoder) decodeExt(v reflect.Value, n int) error {
+	var code uint8
+	if err := d.read(&code); err != nil {
+		return err
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return err
+	}
+	x := Ext{code, data}
+	for v.Kind() == reflect.Ptr {
+		v = indirect(v)
+	}
+	switch {
+	case v.Type() == extType:
+		v.Set(reflect.ValueOf(x))
+	case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		switch code {
+		case ExtJSON:
+			v.Set(reflect.ValueOf(json.RawMessage(data)))
+		case ExtIP, ExtIPNet:
+			ip, err := networkInterface(code, data)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(ip))
+		default:
+			v.Set(reflect.ValueOf(x))
+		}
+	default:
+		return &DecoderTypeError{"ext", v.Type()}
+	}
+	return nil
+}
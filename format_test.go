@@ -0,0 +1,133 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFormatVersion2(t *testing.T) {
+	at := time.Date(2018, 3, 1, 10, 30, 0, 5, time.FixedZone("", -5*60*60))
+	x := []interface{}{
+		int64(1) << 40, -(int64(1) << 40), uint64(1) << 48, int64(1) << 62, 7,
+		at, at.UTC(),
+		Ext{Code: 3, Data: []byte{1, 2}},
+	}
+	for _, le := range []bool{false, true} {
+		opts := []interface{}{WithFormatVersion(2)}
+		if le {
+			opts = append(opts, WithLittleEndian())
+		}
+		data, err := Marshal(x, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data, []byte{tVarint}) || !bytes.Contains(data, []byte{tUvarint}) {
+			t.Fatalf("no varints in %x", data)
+		}
+
+		var y []interface{}
+		if err = Unmarshal(data, &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, []interface{}{x[0], x[1], x[2], x[3], int64(7)}, y[:5])
+		if !y[5].(time.Time).Equal(at) || y[6].(time.Time).Location() != time.UTC {
+			t.Fatalf("unexpected times %v", y[5:7])
+		}
+		_, offset := y[5].(time.Time).Zone()
+		assertEqual(t, -5*60*60, offset)
+		assertEqual(t, x[7], y[7])
+
+		dec := NewDecoder(bytes.NewReader(data))
+		v, err := dec.FormatVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, 2, v)
+
+		// copy into version 1
+		var buf bytes.Buffer
+		var z []interface{}
+		if err = CopyValue(NewEncoder(&buf), NewDecoder(bytes.NewReader(data))); err == nil {
+			t.Fatal("expected error")
+		}
+		data, _ = Marshal(x[:7], opts...)
+		buf.Reset()
+		if err = CopyValue(NewEncoder(&buf), NewDecoder(bytes.NewReader(data))); err != nil {
+			t.Fatal(err)
+		}
+		if err = Unmarshal(buf.Bytes(), &z); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, y[:5], z[:5])
+	}
+}
+
+func TestFormatVersion1(t *testing.T) {
+	data, err := Marshal(uint64(1)<<40, WithFormatVersion(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, tUint64, data[0])
+	v, _ := NewDecoder(bytes.NewReader(data)).FormatVersion()
+	assertEqual(t, 1, v)
+
+	if _, err = Marshal(Ext{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = Marshal(1, WithFormatVersion(3)); err == nil {
+		t.Fatal("expected error")
+	}
+	var x interface{}
+	if err = Unmarshal([]byte{tVersion, 3, tNil}, &x); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecodeLength64(t *testing.T) {
+	data := []byte{tVersion, 2, tString64, 0, 0, 0, 0, 0, 0, 0, 3, 'a', 'b', 'c'}
+	var s string
+	if err := Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "abc", s)
+
+	data = []byte{tArray64, 0xFF, 0, 0, 0, 0, 0, 0, 0}
+	var x interface{}
+	if _, ok := Unmarshal(data, &x).(*DecoderLengthError); !ok {
+		t.Fatal("expected length error")
+	}
+}
+
+func TestDecodeLength64BeyondInput(t *testing.T) {
+	str := []byte{tVersion, 2, tString64, 0x40, 0, 0, 0, 0, 0, 0, 0}
+	arr := []byte{tVersion, 2, tArray64, 0x40, 0, 0, 0, 0, 0, 0, 0}
+
+	var s string
+	if _, ok := Unmarshal(str, &s).(*DecoderLengthError); !ok {
+		t.Fatal("expected length error")
+	}
+	var x []int
+	if _, ok := Unmarshal(arr, &x).(*DecoderLengthError); !ok {
+		t.Fatal("expected length error")
+	}
+	var y interface{}
+	if _, ok := Unmarshal(arr, &y).(*DecoderLengthError); !ok {
+		t.Fatal("expected length error")
+	}
+
+	// streams of unknown length allocate as values are read
+	if err := NewDecoder(io.MultiReader(bytes.NewReader(str))).Decode(&s); err != io.ErrUnexpectedEOF {
+		t.Fatal(err)
+	}
+	if err := NewDecoder(io.MultiReader(bytes.NewReader(arr))).Decode(&x); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := NewDecoder(io.MultiReader(bytes.NewReader(arr))).Decode(&y); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -4,8 +4,13 @@
 package godat
 
 import (
+	"bufio"
 	"bytes"
-	"os"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
 )
 
 const (
@@ -31,6 +36,9 @@ const (
 	tUint32 = 'U' + t32 // 0x89
 	tUint64 = 'U' + t64 // 0xA3
 
+	tVarint  = 'J' + t8 // 0x4A, zigzag-encoded, since format version 2
+	tUvarint = 'G' + t8 // 0x47, since format version 2
+
 	_        = 'D' + t8  // 0x44
 	_        = 'D' + t16 // 0x5E
 	tFloat32 = 'D' + t32 // 0x78
@@ -39,25 +47,206 @@ const (
 	tString8  = 'S' + t8  // 0x53
 	tString16 = 'S' + t16 // 0x6D
 	tString32 = 'S' + t32 // 0x87
-	_         = 'S' + t64 // 0xA1
+	tString64 = 'S' + t64 // 0xA1, since format version 2
 
 	tArray8  = 'A' + t8  // 0x41
 	tArray16 = 'A' + t16 // 0x5B
 	tArray32 = 'A' + t32 // 0x75
-	_        = 'A' + t64 // 0x8F
+	tArray64 = 'A' + t64 // 0x8F, since format version 2
+
+	tArrayStream  = 'L' + t8  // 0x4C, items until tEnd
+	tBinaryStream = 'L' + t16 // 0x66, binary chunks until tEnd
+	tEnd          = 'E' + t8  // 0x45
 
 	tObject8  = 'O' + t8  // 0x4F
 	tObject16 = 'O' + t16 // 0x69
 	tObject32 = 'O' + t32 // 0x83
-	_         = 'O' + t64 // 0x9D
+	tObject64 = 'O' + t64 // 0x9D, since format version 2
 
 	tBinary8  = 'B' + t8  // 0x42
 	tBinary16 = 'B' + t16 // 0x5C
 	tBinary32 = 'B' + t32 // 0x76
-	_         = 'B' + t64 // 0x90
+	tBinary64 = 'B' + t64 // 0x90, since format version 2
+
+	// since format version 2
+	tExt8  = 'X' + t8  // 0x58
+	tExt16 = 'X' + t16 // 0x72
+	tExt32 = 'X' + t32 // 0x8C
+	tExt64 = 'X' + t64 // 0xA6
+
+	tTime = 'Y' + t8 // 0x59, since format version 2
+
+	tDeflate8  = 'P' + t8  // 0x50, value compressed with DEFLATE
+	tDeflate16 = 'P' + t16 // 0x6A
+	tDeflate32 = 'P' + t32 // 0x84
+	tDeflate64 = 'P' + t64 // 0x9E, since format version 2
+
+	tRef = 'R' + t8 // 0x52, back-reference to an earlier subtree of the value
+
+	tCount8  = 'N' + t8  // 0x4E
+	tCount16 = 'N' + t16 // 0x68
+	tCount32 = 'N' + t32 // 0x82
+	_        = 'N' + t64 // 0x9C
+
+	tIndex    = 'Q' + t8  // 0x51
+	tChecksum = 'K' + t8  // 0x4B
+	tSet      = 'K' + t16 // 0x65, keys of a set following as an array
+
+	tUnion = 'V' + t8 // 0x56
+
+	tTensor = 'M' + t8 // 0x4D
+
+	tLittleEndian = 'W' + t8  // 0x57, stream header of little-endian values
+	tVersion      = 'H' + t8  // 0x48, stream header of the format version
+	tFieldHash    = 'H' + t16 // 0x62, hash of a defined field name
+	tFieldName    = 'H' + t32 // 0x7C, hash of a field name followed by its definition
+	tCompressed   = 'C' + t8  // 0x43, frame of values compressed with a dictionary
+	tRefs         = 'R' + t16 // 0x6C, stream header of values with back-references
 )
 
+type Type byte
+
+const (
+	InvalidType Type = iota
+	NilType
+	BoolType
+	IntType
+	UintType
+	FloatType
+	StringType
+	BinaryType
+	ArrayType
+	ObjectType
+	UnionType
+	TensorType
+	TimeType
+	ExtType
+	CompressedType
+	RefType
+	FieldNameType
+	SetType
+)
+
+var typeNames = [...]string{
+	InvalidType: "invalid",
+	NilType:     "nil",
+	BoolType:    "bool",
+	IntType:     "int",
+	UintType:    "uint",
+	FloatType:   "float",
+	StringType:  "string",
+	BinaryType:  "binary",
+	ArrayType:   "array",
+	ObjectType:  "object",
+	UnionType:   "union",
+	TensorType:  "tensor",
+	TimeType:    "time",
+	ExtType:     "ext",
+
+	CompressedType: "compressed",
+	RefType:        "ref",
+	FieldNameType:  "fieldname",
+	SetType:        "set",
+}
+
+func (t Type) String() string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return typeNames[InvalidType]
+}
+
+func typeOf(t byte) Type {
+	switch t {
+	case tNil:
+		return NilType
+	case tTrue, tFalse:
+		return BoolType
+	case tInt8, tInt16, tInt32, tInt64, tVarint:
+		return IntType
+	case tUint8, tUint16, tUint32, tUint64, tUvarint:
+		return UintType
+	case tFloat32, tFloat64:
+		return FloatType
+	case tString8, tString16, tString32, tString64:
+		return StringType
+	case tBinary8, tBinary16, tBinary32, tBinary64, tBinaryStream:
+		return BinaryType
+	case tArray8, tArray16, tArray32, tArray64, tArrayStream:
+		return ArrayType
+	case tObject8, tObject16, tObject32, tObject64:
+		return ObjectType
+	case tUnion:
+		return UnionType
+	case tTensor:
+		return TensorType
+	case tTime:
+		return TimeType
+	case tExt8, tExt16, tExt32, tExt64:
+		return ExtType
+	case tDeflate8, tDeflate16, tDeflate32, tDeflate64:
+		return CompressedType
+	case tRef:
+		return RefType
+	case tFieldHash, tFieldName:
+		return FieldNameType
+	case tSet:
+		return SetType
+	}
+	return InvalidType
+}
+
+func encodeParallel(enc *Encoder, vv []interface{}) error {
+	type result struct {
+		buf *bytes.Buffer
+		err error
+	}
+	// goroutines clone a snapshot of enc, whose offsets change while their results are written
+	tmpl := *enc
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	results := make([]chan result, len(vv))
+	for i, v := range vv {
+		results[i] = make(chan result, 1)
+		go func(v interface{}, res chan<- result) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			buf := new(bytes.Buffer)
+			res <- result{buf, tmpl.clone(buf).Encode(v)}
+		}(v, results[i])
+	}
+
+	var err error
+	for _, res := range results {
+		r := <-res
+		if err == nil {
+			if err = r.err; err == nil {
+				enc.markValue()
+				err = enc.writeRaw(r.buf.Bytes())
+			}
+		}
+	}
+	return err
+}
+
 func encode(enc *Encoder, vv []interface{}) error {
+	if enc.valueCount {
+		if err := enc.EncodeCount(len(vv)); err != nil {
+			return err
+		}
+	}
+	var err error
+	if enc.parallel && len(vv) > 1 {
+		err = encodeParallel(enc, vv)
+	} else {
+		err = encodeSerial(enc, vv)
+	}
+	if err != nil {
+		return err
+	}
+	return enc.writeFooters()
+}
+
+func encodeSerial(enc *Encoder, vv []interface{}) error {
 	for _, v := range vv {
 		if err := enc.Encode(v); err != nil {
 			return err
@@ -67,49 +256,341 @@ func encode(enc *Encoder, vv []interface{}) error {
 }
 
 func Marshal(v interface{}, vv ...interface{}) ([]byte, error) {
-	vv = append([]interface{}{v}, vv...)
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+	return marshal(vv, opts)
+}
 
+func marshal(vv []interface{}, opts []Option) ([]byte, error) {
 	buf := new(bytes.Buffer)
-	if err := encode(NewEncoder(buf), vv); err != nil {
+	enc := NewEncoder(buf, opts...)
+	if err := encode(enc, vv); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
 		return nil, err
 	}
 
+	if enc.dict != nil {
+		return compressFrame(buf.Bytes(), enc.dict)
+	}
 	return buf.Bytes(), nil
 }
 
 func Dump(filename string, v interface{}, vv ...interface{}) error {
-	vv = append([]interface{}{v}, vv...)
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+
+	return dumpFunc(filename, opts, func(enc *Encoder) error {
+		return encode(enc, vv)
+	})
+}
+
+func dumpWriter(w io.Writer, opts []Option, fn func(enc *Encoder) error) error {
+	if o := fileOptions(opts); o.encryptionKey != nil {
+		var buf bytes.Buffer
+		if err := fn(NewEncoder(&buf, opts...)); err != nil {
+			return err
+		}
+		data, err := sealEnvelope(o.encryptionKey, o.keyID, o.aad, buf.Bytes())
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
 
-	f, err := os.Create(filename)
+	if o := fileOptions(opts); o.asyncWrite {
+		a := newAsyncWriter(w, o.asyncSize)
+		err := fn(NewEncoder(a, opts...))
+		if cerr := a.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	enc := NewEncoder(bufio.NewWriter(w), opts...)
+	if err := fn(enc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// dumpFile writes into f and closes it, flushing it to stable storage WithSync
+func dumpFile(f io.WriteCloser, opts []Option, fn func(enc *Encoder) error) error {
+	err := dumpWriter(f, opts, fn)
+	if err == nil && fileOptions(opts).sync {
+		err = syncFile(f)
+	}
 	if err != nil {
+		f.Close()
 		return err
 	}
-	defer f.Close()
+	return f.Close()
+}
+
+func dumpFunc(filename string, opts []Option, fn func(enc *Encoder) error) error {
+	o := fileOptions(opts)
+	b := backendOf(o)
+	f, err := b.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = dumpFile(f, opts, fn); err != nil {
+		return err
+	}
+	if o.sync {
+		return syncParent(b, filename)
+	}
+	return nil
+}
+
+// dumpTemp writes into a temporary file next to filename and returns its name
+func dumpTemp(filename string, opts []Option, fn func(enc *Encoder) error) (string, error) {
+	b := backendOf(fileOptions(opts))
+	tmp := tempName(filename)
+	f, err := b.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	if err = dumpFile(f, opts, fn); err != nil {
+		b.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+func renameTemp(tmp, filename string, opts []Option) error {
+	o := fileOptions(opts)
+	b := backendOf(o)
+	if err := b.Rename(tmp, filename); err != nil {
+		b.Remove(tmp)
+		return err
+	}
+	if o.sync {
+		return syncParent(b, filename)
+	}
+	return nil
+}
+
+func DumpAtomic(filename string, v interface{}, vv ...interface{}) error {
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+
+	tmp, err := dumpTemp(filename, opts, func(enc *Encoder) error {
+		return encode(enc, vv)
+	})
+	if err != nil {
+		return err
+	}
+	return renameTemp(tmp, filename, opts)
+}
+
+func decodeParallel(dec *Decoder, vv []interface{}) error {
+	raws := make([][]byte, len(vv))
+	offsets := make([]int64, len(vv))
+	for i := range vv {
+		offsets[i] = dec.InputOffset()
+		raw, err := dec.nextRaw()
+		if err != nil {
+			return &LoadError{i, offsets[i], err}
+		}
+		raws[i] = raw
+	}
+
+	errs := make([]error, len(vv))
+	arenas := make([]*Arena, len(vv))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i, v := range vv {
+		wg.Add(1)
+		go func(i int, v interface{}) {
+			sem <- struct{}{}
+			defer func() { <-sem; wg.Done() }()
+			x := dec.clone(bytes.NewReader(raws[i]))
+			if dec.arena != nil {
+				// arenas are not safe for concurrent use, so each value gets its own
+				x.arena = NewArena(dec.arena.chunk)
+				arenas[i] = x.arena
+			}
+			errs[i] = x.Decode(v)
+		}(i, v)
+	}
+	wg.Wait()
+	for _, a := range arenas {
+		if a != nil {
+			dec.arena.adopt(a)
+		}
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			return &LoadError{i, offsets[i], err}
+		}
+	}
+	return nil
+}
+
+// LoadError reports a value that failed to decode, after Values values decoded successfully.
+// The failing value starts at Offset, from which ResumeLoad can continue once it is fixed.
+type LoadError struct {
+	Values int
+	Offset int64
+	Err    error
+}
 
-	return encode(NewEncoder(f), vv)
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("%v (value %d at offset %d)", e.Err, e.Values, e.Offset)
 }
 
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// decode decodes values of vv in order, reporting a failing value as LoadError
 func decode(dec *Decoder, vv []interface{}) error {
-	for _, v := range vv {
-		if err := dec.Decode(v); err != nil {
+	if n, ok := dec.Remaining(); ok && n < len(vv) {
+		return &DecoderError{fmt.Sprintf("stream holds %d values, %d requested", n, len(vv))}
+	}
+	if dec.parallel && len(vv) > 1 {
+		if err := decodeParallel(dec, vv); err != nil {
 			return err
 		}
+		return dec.verifyChecksum()
+	}
+	var errs DecodeErrors
+	for i, v := range vv {
+		offset := dec.InputOffset()
+		if err := dec.Decode(v); err != nil {
+			if e, ok := err.(DecodeErrors); ok {
+				errs = append(errs, e...) // values of lenient decoders are complete
+				continue
+			}
+			return &LoadError{i, offset, err}
+		}
+	}
+	if err := dec.verifyChecksum(); err != nil {
+		return err
+	}
+	if errs != nil {
+		return errs
 	}
 	return nil
 }
 
 func Unmarshal(data []byte, v interface{}, vv ...interface{}) error {
-	return decode(NewDecoder(bytes.NewReader(data)), append([]interface{}{v}, vv...))
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+	return unmarshal(data, vv, opts)
+}
+
+func unmarshal(data []byte, vv []interface{}, opts []Option) error {
+	if len(data) > 0 && data[0] == tCompressed {
+		var err error
+		if data, err = decompressFrame(data, fileOptions(opts)); err != nil {
+			return err
+		}
+	}
+	err := decode(NewDecoder(&sliceReader{data}, opts...), vv)
+	if e, ok := err.(*LoadError); ok {
+		return e.Err
+	}
+	return err
 }
 
 func Load(filename string, v interface{}, vv ...interface{}) error {
-	vv = append([]interface{}{v}, vv...)
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+
+	return load(filename, vv, opts)
+}
 
-	f, err := os.Open(filename)
+// ResumeLoad decodes values from the file starting at offset, such as that of a LoadError.
+// Checksums of the file are not verified.
+func ResumeLoad(filename string, offset int64, v interface{}, vv ...interface{}) error {
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+
+	f, err := open(filename, opts)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	return decode(NewDecoder(f), vv)
+	if s, ok := f.(io.Seeker); ok {
+		_, err = s.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, f, offset)
+	}
+	if err != nil {
+		return err
+	}
+	dec := NewDecoder(f, append(opts, func(o *options) { o.checksum = false })...)
+	if err = decode(dec, vv); err != nil {
+		if e, ok := err.(*LoadError); ok {
+			e.Offset += offset
+		}
+		return err
+	}
+	return nil
+}
+
+func open(filename string, opts []Option) (io.ReadCloser, error) {
+	o := fileOptions(opts)
+	f, err := backendOf(o).Open(filename)
+	if err != nil || o.encryptionKey == nil && o.keyring == nil {
+		return f, err
+	}
+
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if data, err = openEnvelope(o.encryptionKey, data, o); err != nil {
+		return nil, err
+	}
+	return memoryReader{bytes.NewReader(data)}, nil
+}
+
+func load(filename string, vv []interface{}, opts []Option) error {
+	f, err := open(filename, opts)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if fileOptions(opts).trusted {
+		// trusted decoders reference the input instead of copying it
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		return decode(NewDecoder(&sliceReader{data}, opts...), vv)
+	}
+	return decode(NewDecoder(f, opts...), vv)
+}
+
+// LoadFunc calls fn for every top-level value in the file; values left unread by fn are skipped.
+func LoadFunc(filename string, fn func(dec *Decoder) error, opts ...Option) error {
+	f, err := open(filename, opts)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return decodeFunc(NewDecoder(bufio.NewReader(f), opts...), fn)
+}
+
+func decodeFunc(dec *Decoder, fn func(dec *Decoder) error) error {
+	for {
+		if _, err := dec.PeekType(); err == io.EOF {
+			return dec.verifyChecksum()
+		} else if err != nil {
+			return err
+		}
+		offset := dec.InputOffset()
+		if err := fn(dec); err != nil {
+			return err
+		}
+		if dec.InputOffset() == offset {
+			if err := dec.Skip(); err != nil {
+				return err
+			}
+		}
+	}
 }
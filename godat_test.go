@@ -4,16 +4,23 @@
 package godat
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -602,6 +609,171 @@ func TestUnmarshalFloatOverflowError(t *testing.T) {
 	_ = err.Error()
 }
 
+func TestUnmarshalNumber(t *testing.T) {
+	x := []interface{}{int8(-1), int16(300), uint32(70000), float32(0.5), 1e300}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y interface{}
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err = dec.Decode(&y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yv := y.([]interface{})
+	assertEqual(t, reflect.Int8, yv[0].(Number).Kind)
+	assertEqual(t, reflect.Int16, yv[1].(Number).Kind)
+	assertEqual(t, reflect.Uint32, yv[2].(Number).Kind)
+	assertEqual(t, reflect.Float32, yv[3].(Number).Kind)
+	assertEqual(t, reflect.Float64, yv[4].(Number).Kind)
+	assertEqual(t, "300", yv[1].(Number).String())
+
+	n, err := yv[0].(Number).Int64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, int64(-1), n)
+	_, err = yv[0].(Number).Uint64()
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+	assertEqual(t, 0.5, yv[3].(Number).Float64())
+
+	data2, err := Marshal(y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, data, data2)
+}
+
+func TestUnmarshalNumberStruct(t *testing.T) {
+	x := int16(-300)
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y Number
+	err = Unmarshal(data, &y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, reflect.Int16, y.Kind)
+	n, err := y.Int64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, int64(x), n)
+}
+
+func TestMarshalExactKinds(t *testing.T) {
+	x := map[string]interface{}{
+		"a": int8(1), "b": int32(1), "c": 1, "d": uint16(1), "e": float32(1), "f": 1.0,
+		"g": map[uint8]int16{1: 2, 3: 4, 5: 6},
+	}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.SetExactKinds(true)
+	enc.SetCanonical(true)
+	err := enc.Encode(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte(nil), buf.Bytes()...)
+
+	var y interface{}
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.UseExactKinds()
+	err = dec.Decode(&y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ym := y.(map[interface{}]interface{})
+	assertEqual(t, int8(1), ym["a"])
+	assertEqual(t, int32(1), ym["b"])
+	assertEqual(t, int64(1), ym["c"])
+	assertEqual(t, uint16(1), ym["d"])
+	assertEqual(t, float32(1), ym["e"])
+	assertEqual(t, 1.0, ym["f"])
+	assertEqual(t, int16(4), ym["g"].(map[interface{}]interface{})[uint8(3)])
+
+	buf.Reset()
+	err = enc.Encode(y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, data, buf.Bytes())
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	type T struct {
+		A, B, C, D int
+	}
+	x := T{1, 2, 3, 4}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.SetCanonical(true)
+	err := enc.Encode(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte(nil), buf.Bytes()...)
+
+	for i := 0; i < 10; i++ {
+		buf.Reset()
+		err = enc.Encode(map[string]int{"D": 4, "C": 3, "B": 2, "A": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, data, buf.Bytes())
+	}
+
+	var y T
+	err = Unmarshal(data, &y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x, y)
+}
+
+func TestMarshalExactKindsNaNError(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer))
+	enc.SetExactKinds(true)
+	err := enc.Encode(math.NaN())
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestMarshalFloatPrecision(t *testing.T) {
+	for _, x := range []float64{0.1, 1.0 / 3, math.SmallestNonzeroFloat64, 0.5, 0, math.Copysign(0, -1)} {
+		data, err := Marshal(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var y float64
+		err = Unmarshal(data, &y)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertEqual(t, math.Float64bits(x), math.Float64bits(y))
+		assertEqual(t, float64(float32(x)) == x, data[0] == tFloat32)
+	}
+}
+
 func TestMarshalString(t *testing.T) {
 	x := NewTestInputString()
 	data, err := Marshal(x)
@@ -1086,6 +1258,54 @@ func TestUnmarshalArrayIncompatibleError(t *testing.T) {
 	_ = err.Error()
 }
 
+func TestMarshalPreserveEmpty(t *testing.T) {
+	type T struct {
+		A []int
+		B []int
+		C map[string]int
+		D map[string]int
+		E []byte
+		F []byte
+	}
+	x := T{B: []int{}, D: map[string]int{}, F: []byte{}}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.SetPreserveEmpty(true)
+	err := enc.Encode(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = enc.Encode([]int(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = enc.Encode(map[int]int(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewDecoder(buf)
+	y := T{A: []int{1}, C: map[string]int{"a": 1}}
+	err = dec.Decode(&y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y2 := []int{1}
+	err = dec.Decode(&y2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y3 := map[int]int{1: 1}
+	err = dec.Decode(&y3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x, y)
+	assertEqual(t, []int(nil), y2)
+	assertEqual(t, map[int]int(nil), y3)
+}
+
 func TestMarshalObject(t *testing.T) {
 	x := NewTestInputObject()
 	data, err := Marshal(x)
@@ -1213,6 +1433,125 @@ func TestUnmarshalObjectIncompatibleError(t *testing.T) {
 	_ = err.Error()
 }
 
+func TestMarshalObjectCompositeKeys(t *testing.T) {
+	type P struct {
+		X, Y int
+	}
+	x1 := map[[2]int]string{{0, 0}: "a", {1, -1}: "b", {300, 2}: "c"}
+	x2 := map[P]bool{{0, 0}: true, {1, 2}: false, {-3, 4}: true}
+	data, err := Marshal(x1, x2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y1 map[[2]int]string
+	var y2 map[P]bool
+	err = Unmarshal(data, &y1, &y2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x1, y1)
+	assertEqual(t, x2, y2)
+
+	var y3 interface{}
+	err = Unmarshal(data, &y3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, "c", y3.(map[interface{}]interface{})[[2]interface{}{int64(300), int64(2)}])
+}
+
+func TestMarshalObjectCompositeKeysCanonical(t *testing.T) {
+	x := map[[2]int]int{}
+	for i := 0; i < 100; i++ {
+		x[[2]int{i % 10, i / 10}] = i
+	}
+	var prev []byte
+	for i := 0; i < 10; i++ {
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(buf)
+		enc.SetCanonical(true)
+		err := enc.Encode(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prev != nil {
+			assertEqual(t, prev, buf.Bytes())
+		}
+		prev = buf.Bytes()
+	}
+}
+
+func TestMarshalInterfaceKeysCanonical(t *testing.T) {
+	x := map[interface{}]interface{}{
+		"b": 1, "a": 2, int8(-1): 3, uint64(7): 4, 2.5: 5, true: 6, nil: 7, Number{reflect.Int64, 300}: 8,
+	}
+	data, err := Marshal(x, WithCanonical(), WithExactKinds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		y := make(map[interface{}]interface{})
+		for k, v := range x {
+			y[k] = v
+		}
+		p, err := Marshal(y, WithCanonical(), WithExactKinds())
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, data, p)
+	}
+
+	// keys are ordered by their narrowest encodings, and values keep their exact kinds
+	var want bytes.Buffer
+	enc := NewEncoder(&want, WithExactKinds())
+	enc.EncodeObjectHeader(8)
+	for _, kv := range [][2]interface{}{
+		{int8(-1), 3}, {"a", 2}, {"b", 1}, {true, 6}, {uint8(7), 4}, {nil, 7}, {int16(300), 8}, {float32(2.5), 5},
+	} {
+		enc.Encode(kv[0])
+		enc.Encode(kv[1])
+	}
+	assertEqual(t, want.Bytes(), data)
+
+	var buf bytes.Buffer
+	err = CopyValue(NewEncoder(&buf, WithCanonical()), NewDecoder(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y interface{}
+	if err = Unmarshal(buf.Bytes(), &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, int64(8), y.(map[interface{}]interface{})[int64(300)])
+
+	_, err = Marshal(map[interface{}]int{1: 1, int64(1): 2}, WithCanonical(), WithExactKinds())
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestUnmarshalObjectUnhashableKeyError(t *testing.T) {
+	type P struct {
+		X, Y int
+	}
+	x := map[P]bool{{1, 2}: true}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ye interface{}
+	err = Unmarshal(data, &ye)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
 func TestMarshalMarshaler(t *testing.T) {
 	x := NewTestInputMarshaler()
 	data, err := Marshal(x)
@@ -1269,149 +1608,1507 @@ func TestMarshalIncompatible(t *testing.T) {
 	assertEqual(t, x, y)
 }
 
-func TestUnmarshalValueError(t *testing.T) {
-	x := TestInt
-	data, err := Marshal(x)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	var y1 int
-	err = Unmarshal(data, y1)
-	if err == nil {
-		t.FailNow()
-	}
-	_ = err.Error()
+func TestMarshalIncompatibleError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.SetErrorOnUnsupported(true)
 
-	var y2 *int
-	err = Unmarshal(data, y2)
+	x1 := make(chan int)
+	err := enc.Encode(x1)
 	if err == nil {
 		t.FailNow()
 	}
 	_ = err.Error()
-}
 
-func TestUnmarshalEmptyError(t *testing.T) {
-	var y int
-	err := Unmarshal([]byte{}, &y)
+	x2 := struct{ A func() }{func() {}}
+	err = enc.Encode(x2)
 	if err == nil {
 		t.FailNow()
 	}
 	_ = err.Error()
-}
-
-func TestUnmarshalFormatError(t *testing.T) {
-	var err error
-	types := []byte{
-		tInt8, tInt16, tInt32, tInt64, tUint8, tUint16, tUint32, tUint64, tFloat32, tFloat64,
-		tString8, tString16, tString32, tBinary8, tBinary16, tBinary32,
-		tArray8, tArray16, tArray32, tObject8, tObject16, tObject32}
 
-	var y int
-	for _, typ := range types {
-		err = Unmarshal([]byte{typ}, &y)
-		if err == nil {
-			t.FailNow()
-		}
-		_ = err.Error()
+	// nil values are encoded as nil, both at the top level and in fields
+	var x3 chan int
+	err = enc.Encode(x3)
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	// unknown typ should unmarshal to nil
-	err = Unmarshal([]byte{0xFF}, &y)
+	x4 := &TestInputNil{}
+	err = enc.Encode(x4)
 	if err != nil {
 		t.Fatal(err)
 	}
-}
-
-func TestDump(t *testing.T) {
-	fn := randomFilename()
-	defer os.Remove(fn)
-
-	x := NewTestInput()
-	err := Dump(fn, x)
+	x5 := []func(){nil}
+	err = enc.Encode(x5)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	y := &TestInput{}
-	err = Load(fn, &y)
+	err = enc.Encode(nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	assertEqual(t, x, y)
 }
 
-func TestDumpMultiple(t *testing.T) {
-	fn := randomFilename()
-	defer os.Remove(fn)
-
-	x1 := NewTestInputBool()
-	x2 := NewTestInputString()
-	x3 := NewTestInputObject()
-	err := Dump(fn, x1, x2, x3)
+func TestEncoderPrimitives(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	err := enc.EncodeObjectHeader(2)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	y1 := &TestInputBool{}
-	y2 := &TestInputString{}
-	y3 := &TestInputObject{}
-	err = Load(fn, &y1, &y2, &y3)
+	enc.EncodeString("a")
+	enc.EncodeArrayHeader(6)
+	enc.EncodeNil()
+	enc.EncodeBool(true)
+	enc.EncodeInt(-1000)
+	enc.EncodeUint(1000)
+	enc.EncodeFloat(0.5)
+	enc.EncodeBinary([]byte{1, 2})
+	enc.EncodeString("b")
+	err = enc.EncodeString("c")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	assertEqual(t, x1, y1)
-	assertEqual(t, x2, y2)
-	assertEqual(t, x3, y3)
-}
-
-func TestDumpCreateError(t *testing.T) {
-	fn := randomFilename()
-	err := os.Mkdir(fn, os.ModePerm)
+	x := map[string]interface{}{
+		"a": []interface{}{nil, true, int16(-1000), uint16(1000), float32(0.5), []byte{1, 2}},
+		"b": "c",
+	}
+	buf2 := new(bytes.Buffer)
+	enc2 := NewEncoder(buf2)
+	enc2.SetExactKinds(true)
+	enc2.SetCanonical(true)
+	err = enc2.Encode(x)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.Remove(fn)
 
-	x := NewTestInputBool()
-	err = Dump(fn, x)
+	assertEqual(t, buf2.Bytes(), buf.Bytes())
+
+	err = enc.EncodeArrayHeader(-1)
 	if err == nil {
 		t.FailNow()
 	}
 	_ = err.Error()
 }
 
-func TestDumpWriteError(t *testing.T) {
-	fn := randomFilename()
-	f, err := os.Create(fn)
+func TestDecoderPrimitives(t *testing.T) {
+	x := []interface{}{nil, true, -1000, uint(1000), 0.5, "a", []byte{1, 2}, map[string]int{"b": 1}}
+	data, err := Marshal(x)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer f.Close()
-	defer os.Remove(fn)
 
-	x := NewTestInputBool()
-	enc := NewEncoder(f)
-	err = enc.Encode(x)
+	dec := NewDecoder(bytes.NewReader(data))
+	typ, err := dec.PeekType()
 	if err != nil {
 		t.Fatal(err)
 	}
-	f.Close()
-	err = enc.Encode(x)
+	assertEqual(t, ArrayType, typ)
+	n, err := dec.DecodeArrayHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(x), n)
+	typ, _ = dec.PeekType()
+	assertEqual(t, "nil", typ.String())
+	if err = dec.DecodeNil(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := dec.DecodeBool(); err != nil || !b {
+		t.FailNow()
+	}
+	if i, err := dec.DecodeInt64(); err != nil || i != -1000 {
+		t.FailNow()
+	}
+	if u, err := dec.DecodeUint64(); err != nil || u != 1000 {
+		t.FailNow()
+	}
+	if f, err := dec.DecodeFloat64(); err != nil || f != 0.5 {
+		t.FailNow()
+	}
+	if s, err := dec.DecodeString(); err != nil || s != "a" {
+		t.FailNow()
+	}
+	if b, err := dec.DecodeBinary(); err != nil || !bytes.Equal(b, []byte{1, 2}) {
+		t.FailNow()
+	}
+	if n, err := dec.DecodeObjectHeader(); err != nil || n != 1 {
+		t.FailNow()
+	}
+	if s, err := dec.DecodeString(); err != nil || s != "b" {
+		t.FailNow()
+	}
+	if i, err := dec.DecodeInt64(); err != nil || i != 1 {
+		t.FailNow()
+	}
+	_, err = dec.PeekType()
+	assertEqual(t, io.EOF, err)
+}
+
+func TestDecoderPrimitivesError(t *testing.T) {
+	data, err := Marshal(-1, "a", 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewDecoder(bytes.NewReader(data))
+	_, err = dec.DecodeUint64()
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+	_, err = dec.DecodeBool()
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+	_, err = dec.DecodeInt64()
 	if err == nil {
 		t.FailNow()
 	}
 	_ = err.Error()
 }
 
-func TestLoadOpenError(t *testing.T) {
+func TestDecoderBuffered(t *testing.T) {
+	data, err := Marshal("preamble")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(append(data, "payload"...))
+	dec := NewDecoder(r)
+	var s string
+	if err = dec.Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "preamble", s)
+	if _, err = dec.PeekType(); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(io.MultiReader(dec.Buffered(), r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "payload", string(rest))
+}
+
+func TestDecoderPeekHeader(t *testing.T) {
+	data, err := Marshal(TestString16, TestArray8, TestMap32, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewDecoder(bytes.NewReader(data))
+	for _, x := range []struct {
+		typ Type
+		n   int
+	}{{StringType, len(TestString16)}, {ArrayType, len(TestArray8)}, {ObjectType, len(TestMap32)}, {IntType, 0}} {
+		for i := 0; i < 2; i++ {
+			typ, n, err := dec.PeekHeader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, x.typ, typ)
+			assertEqual(t, x.n, n)
+		}
+		var y interface{}
+		err = dec.Decode(&y)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, _, err = dec.PeekHeader()
+	assertEqual(t, io.EOF, err)
+
+	dec = NewDecoder(bytes.NewReader(data[:2]))
+	_, _, err = dec.PeekHeader()
+	assertEqual(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestUnmarshalValueError(t *testing.T) {
+	x := TestInt
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y1 int
+	err = Unmarshal(data, y1)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	var y2 *int
+	err = Unmarshal(data, y2)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestUnmarshalEmptyError(t *testing.T) {
+	var y int
+	err := Unmarshal([]byte{}, &y)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestUnmarshalFormatError(t *testing.T) {
+	var err error
+	types := []byte{
+		tInt8, tInt16, tInt32, tInt64, tUint8, tUint16, tUint32, tUint64, tFloat32, tFloat64,
+		tString8, tString16, tString32, tBinary8, tBinary16, tBinary32,
+		tArray8, tArray16, tArray32, tObject8, tObject16, tObject32}
+
 	var y int
+	for _, typ := range types {
+		err = Unmarshal([]byte{typ}, &y)
+		if err == nil {
+			t.FailNow()
+		}
+		_ = err.Error()
+	}
+
+	// unknown typ should unmarshal to nil
+	err = Unmarshal([]byte{0xFF}, &y)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDump(t *testing.T) {
 	fn := randomFilename()
-	err := Load(fn, &y)
+	defer os.Remove(fn)
+
+	x := NewTestInput()
+	err := Dump(fn, x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y := &TestInput{}
+	err = Load(fn, &y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x, y)
+}
+
+func TestDumpMultiple(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	x1 := NewTestInputBool()
+	x2 := NewTestInputString()
+	x3 := NewTestInputObject()
+	err := Dump(fn, x1, x2, x3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y1 := &TestInputBool{}
+	y2 := &TestInputString{}
+	y3 := &TestInputObject{}
+	err = Load(fn, &y1, &y2, &y3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x1, y1)
+	assertEqual(t, x2, y2)
+	assertEqual(t, x3, y3)
+}
+
+func TestEncoderClose(t *testing.T) {
+	buf := new(bytes.Buffer)
+	bw := bufio.NewWriter(buf)
+	enc := NewEncoder(bw)
+	err := enc.Encode(TestInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 0, buf.Len())
+
+	err = enc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 9, buf.Len())
+	err = enc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = enc.Encode(TestInt)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestDecoderClose(t *testing.T) {
+	data, err := Marshal(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y int
+	dec := NewDecoder(bytes.NewReader(data))
+	err = dec.Decode(&y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dec.Close()
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	dec = NewDecoder(bytes.NewReader(data))
+	err = dec.Decode(&y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dec.Decode(&y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dec.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dec.Decode(&y)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestCloseFooters(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf, WithIndex(), WithChecksum())
+	if err := enc.Encode(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(1, WithIndex(), WithChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data, buf.Bytes())
+
+	var y int
+	dec := NewDecoder(bytes.NewReader(data), WithChecksum())
+	if err = dec.Decode(&y); err != nil {
+		t.Fatal(err)
+	}
+	if err = dec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// tampered value
+	data[1] = 2
+	dec = NewDecoder(bytes.NewReader(data), WithChecksum())
+	if err = dec.Decode(&y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 2, y)
+	if err = dec.Close(); err == nil {
+		t.FailNow()
+	}
+
+	// tampered index trailer
+	data[1] = 1
+	data[len(data)-1-sha256.Size-1]++
+	dec = NewDecoder(bytes.NewReader(data))
+	if err = dec.Decode(&y); err != nil {
+		t.Fatal(err)
+	}
+	if err = dec.Close(); err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestMarshalOptions(t *testing.T) {
+	x := map[string]interface{}{"a": int32(1), "b": uint16(2), "c": []int{}}
+	data1, err := Marshal(x, WithCanonical(), WithExactKinds(), WithPreserveEmpty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data2, err := Marshal(x, WithCanonical(), WithExactKinds(), WithPreserveEmpty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data1, data2)
+
+	var y1 interface{}
+	var y2 interface{}
+	err = Unmarshal(data1, &y1, WithExactKinds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Unmarshal(data1, &y2, WithNumbers())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, int32(1), y1.(map[interface{}]interface{})["a"])
+	assertEqual(t, []interface{}{}, y1.(map[interface{}]interface{})["c"])
+	assertEqual(t, reflect.Uint16, y2.(map[interface{}]interface{})["b"].(Number).Kind)
+
+	_, err = Marshal(make(chan int), WithErrorOnUnsupported())
 	if err == nil {
 		t.FailNow()
 	}
 	_ = err.Error()
 }
+
+func TestUnmarshalLimitError(t *testing.T) {
+	data, err := Marshal(TestString16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y string
+	err = Unmarshal(data, &y, WithLimit(len(TestString16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Unmarshal(data, &y, WithLimit(len(TestString16)-1))
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestDumpOptions(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	x := int8(1)
+	err := Dump(fn, WithExactKinds(), x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y interface{}
+	err = Load(fn, &y, WithExactKinds())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x, y)
+}
+
+func TestDumpParallel(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	x1 := NewTestInputBool()
+	x2 := NewTestInputString()
+	x3 := NewTestInputObject()
+	err := Dump(fn, x1, x2, x3, WithParallel(), WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Marshal(x1, x2, x3, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fdata := new(bytes.Buffer)
+	fdata.ReadFrom(f)
+	assertEqual(t, data, fdata.Bytes())
+
+	y1 := &TestInputBool{}
+	y2 := &TestInputString{}
+	y3 := &TestInputObject{}
+	err = Load(fn, &y1, &y2, &y3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x1, y1)
+	assertEqual(t, x2, y2)
+	assertEqual(t, x3, y3)
+}
+
+func TestMarshalParallelError(t *testing.T) {
+	_, err := Marshal(1, math.NaN(), 2, WithParallel())
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestLoadParallel(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	x1 := NewTestInputBool()
+	x2 := NewTestInputString()
+	x3 := NewTestInputObject()
+	x4 := NewTestInputArray()
+	err := Dump(fn, x1, x2, x3, x4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y1 := &TestInputBool{}
+	y2 := &TestInputString{}
+	y3 := &TestInputObject{}
+	y4 := &TestInputArray{}
+	err = Load(fn, &y1, &y2, &y3, &y4, WithParallel())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x1, y1)
+	assertEqual(t, x2, y2)
+	assertEqual(t, x3, y3)
+	assertEqual(t, x4, y4)
+
+	var ye string
+	err = Load(fn, &y1, &ye, WithParallel())
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestDecoderSkip(t *testing.T) {
+	data, err := Marshal(NewTestInput(), TestInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y int
+	dec := NewDecoder(bytes.NewReader(data))
+	err = dec.Skip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dec.Decode(&y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, TestInt, y)
+}
+
+func TestDumpCreateError(t *testing.T) {
+	fn := randomFilename()
+	err := os.Mkdir(fn, os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fn)
+
+	x := NewTestInputBool()
+	err = Dump(fn, x)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestDumpWriteError(t *testing.T) {
+	fn := randomFilename()
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	defer os.Remove(fn)
+
+	x := NewTestInputBool()
+	enc := NewEncoder(f)
+	err = enc.Encode(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	err = enc.Encode(x)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestLoadFunc(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	err := Dump(fn, 1, "skip", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y []int
+	err = LoadFunc(fn, func(dec *Decoder) error {
+		if typ, _ := dec.PeekType(); typ == StringType {
+			return nil
+		}
+		var i int
+		err := dec.Decode(&i)
+		y = append(y, i)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, []int{1, 3}, y)
+
+	err = LoadFunc(fn, func(dec *Decoder) error {
+		var i int
+		return dec.Decode(&i)
+	})
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	err = LoadFunc(randomFilename(), nil)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestLoadOpenError(t *testing.T) {
+	var y int
+	fn := randomFilename()
+	err := Load(fn, &y)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestDumpValueCount(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	err := Dump(fn, WithValueCount(), 1, "a", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y1 int
+	var y2 string
+	err = Load(fn, &y1, &y2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 1, y1)
+	assertEqual(t, "a", y2)
+
+	var y3 bool
+	var y4 interface{}
+	err = Load(fn, &y1, &y2, &y3, &y4)
+	if _, ok := err.(*DecoderError); !ok {
+		t.Fatal(err)
+	}
+	_ = err.Error()
+}
+
+func TestDecoderRemaining(t *testing.T) {
+	data, err := Marshal(WithValueCount(), 1, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewDecoder(bytes.NewReader(data))
+	if n, ok := dec.Remaining(); !ok || n != 2 {
+		t.Fatalf("remaining %d %v", n, ok)
+	}
+	if err = dec.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := dec.Remaining(); n != 1 {
+		t.Fatalf("remaining %d", n)
+	}
+	if err = dec.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dec.PeekType(); err != io.EOF {
+		t.Fatal(err)
+	}
+
+	dec = NewDecoder(bytes.NewReader(data[:len(data)-2]))
+	var y int
+	if err = dec.Decode(&y); err != nil {
+		t.Fatal(err)
+	}
+	err = dec.Decode(&y)
+	if _, ok := err.(*DecoderError); !ok {
+		t.Fatal(err)
+	}
+
+	dec = NewDecoder(bytes.NewReader(data[1+1+2:]))
+	if _, ok := dec.Remaining(); ok {
+		t.FailNow()
+	}
+}
+
+func TestDumpSync(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	x := NewTestInputObject()
+	if err := Dump(fn, WithSync(), x); err != nil {
+		t.Fatal(err)
+	}
+	if err := DumpAtomic(fn, WithSync(), x); err != nil {
+		t.Fatal(err)
+	}
+
+	y := &TestInputObject{}
+	if err := Load(fn, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+}
+
+func TestEncodeAllocs(t *testing.T) {
+	type item struct {
+		ID    int
+		Name  string
+		Score float64
+		Data  []byte
+	}
+	x := struct {
+		Items []item
+		Tags  [2]string
+		Ok    bool
+	}{
+		Items: []item{{1, "a", 1.5, []byte{1}}, {2, "b", 1e100, nil}},
+		Tags:  [2]string{"x", "y"},
+		Ok:    true,
+	}
+
+	enc := NewEncoder(io.Discard)
+	if n := testing.AllocsPerRun(100, func() {
+		if err := enc.Encode(&x); err != nil {
+			t.Fatal(err)
+		}
+	}); n != 0 {
+		t.Fatalf("%v allocations", n)
+	}
+}
+
+func TestRecursiveType(t *testing.T) {
+	type node struct {
+		Value    int
+		Children []*node
+		Next     *node
+	}
+
+	x := &node{1, []*node{{Value: 2}, {Value: 3, Next: &node{Value: 4}}}, nil}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y *node
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+}
+
+func TestDecodeBinaryReuse(t *testing.T) {
+	data, err := Marshal([]byte{1, 2, 3}, []byte{4, 5, 6, 7, 8}, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewDecoder(bytes.NewReader(data))
+	buf := make([]byte, 0, 4)
+	y, err := dec.DecodeBinaryInto(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []byte{1, 2, 3}, y)
+	assertEqual(t, &buf[:1][0], &y[0])
+
+	y, err = dec.DecodeBinaryInto(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []byte{4, 5, 6, 7, 8}, y)
+
+	z := buf
+	if err = dec.Decode(&z); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []byte{}, z)
+	assertEqual(t, &buf[:1][0], &z[:1][0])
+}
+
+func TestDecodeInPlace(t *testing.T) {
+	type entry struct {
+		Name  string
+		Tags  []string
+		Inner *entry
+	}
+
+	x := map[string]*entry{
+		"a": {Name: "a", Tags: []string{"x"}, Inner: &entry{Name: "b"}},
+		"c": {Name: "c"},
+	}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner := &entry{Name: "old", Tags: []string{"old"}}
+	a := &entry{Name: "old", Tags: make([]string, 2, 4), Inner: inner}
+	y := map[string]*entry{"a": a, "d": {}}
+	if err = Unmarshal(data, &y, WithInPlace()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+	if y["a"] != a || y["a"].Inner != inner || cap(a.Tags) != 4 {
+		t.FailNow()
+	}
+
+	y = map[string]*entry{"a": a}
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+	if y["a"] == a {
+		t.FailNow()
+	}
+}
+
+func TestDecodeTrusted(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	x := NewTestInputObject()
+	if err := Dump(fn, x); err != nil {
+		t.Fatal(err)
+	}
+	y := &TestInputObject{}
+	if err := Load(fn, &y, WithTrusted()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+
+	data, err := Marshal([]byte{1, 2, 3}, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var z []byte
+	var n int8
+	if err = Unmarshal(data, &z, &n, WithTrusted()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []byte{1, 2, 3}, z)
+	assertEqual(t, &data[2], &z[0])
+	assertEqual(t, int8(44), n)
+}
+
+func TestUnmarshalMaxTotalBytes(t *testing.T) {
+	x := []string{strings.Repeat("a", 100), strings.Repeat("b", 100)}
+	data, err := Marshal(x, x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y1, y2 []string
+	if err = Unmarshal(data, &y1, &y2, WithMaxTotalBytes(300)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y1)
+	assertEqual(t, x, y2)
+
+	var z interface{}
+	err = Unmarshal(data, &z, WithMaxTotalBytes(200))
+	if _, ok := err.(*DecoderError); !ok {
+		t.Fatal(err)
+	}
+	_ = err.Error()
+}
+
+type testMetrics struct {
+	encoded, decoded, errors int
+	bytes                    int64
+}
+
+func (m *testMetrics) Encoded(n int64, d time.Duration, err error) {
+	m.encoded++
+	m.bytes += n
+}
+
+func (m *testMetrics) Decoded(n int64, d time.Duration, err error) {
+	m.decoded++
+	if err != nil {
+		m.errors++
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := &testMetrics{}
+	data, err := Marshal(1, "x", WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x int
+	var y string
+	var z bool
+	if err = Unmarshal(data, &x, &y, WithMetrics(m)); err != nil {
+		t.Fatal(err)
+	}
+	if err = Unmarshal(data, &z, WithMetrics(m)); err == nil {
+		t.Fatal("expected error")
+	}
+	assertEqual(t, &testMetrics{2, 3, 1, int64(len(data))}, m)
+}
+
+func TestUnmarshalSoftErrors(t *testing.T) {
+	type item struct {
+		A int
+		B string
+	}
+	x := map[string]interface{}{
+		"Items": []interface{}{
+			map[string]interface{}{"A": 1, "B": "x"},
+			map[string]interface{}{"A": "bad", "B": "y"},
+		},
+		"Tags": map[string]interface{}{"k": []int{1}},
+		"N":    2,
+	}
+	data, err := Marshal(x, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y struct {
+		Items []item
+		Tags  map[string]string
+		N     int
+	}
+	if err = Unmarshal(data, &y); err == nil {
+		t.Fatal("expected error")
+	}
+
+	var paths []string
+	err = Unmarshal(data, &y, WithSoftErrors(func(path string, offset int64, wire Type, target reflect.Type) {
+		if offset <= 0 || offset >= int64(len(data)) {
+			t.Fatalf("bad offset %d", offset)
+		}
+		paths = append(paths, fmt.Sprintf("%s %s %s", path, wire, target))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []string{"Tags[k] array string", "Items[1].A string int"}, paths)
+	assertEqual(t, []item{{1, "x"}, {0, "y"}}, y.Items)
+	assertEqual(t, map[string]string{"k": ""}, y.Tags)
+	assertEqual(t, 2, y.N)
+}
+
+func TestUnmarshalLenient(t *testing.T) {
+	type item struct {
+		A int
+		B string
+	}
+	x := []interface{}{
+		map[string]interface{}{"A": 1, "B": "x"},
+		map[string]interface{}{"A": "bad", "B": 2},
+	}
+	data, err := Marshal(x, []int{1}, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y []item
+	var z []int
+	err = Unmarshal(data, &y, &z, WithLenient())
+	errs, ok := err.(DecodeErrors)
+	if !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	paths := make([]string, len(errs))
+	for i, e := range errs {
+		if _, ok := e.Err.(*DecoderTypeError); !ok {
+			t.Fatalf("unexpected error %v", e.Err)
+		}
+		paths[i] = e.Path
+	}
+	assertEqual(t, []string{"[1].A", "[1].B"}, paths)
+	assertEqual(t, []item{{1, "x"}, {}}, y)
+	assertEqual(t, []int{1}, z)
+	if !strings.Contains(err.Error(), "2 values") {
+		t.Fatal(err)
+	}
+}
+
+func TestUnmarshalStrictTypes(t *testing.T) {
+	var i int
+	var u uint
+	var f32 float32
+	var b bool
+	for _, tc := range []struct {
+		x, v interface{}
+		ok   bool
+	}{
+		{"1", &i, false},
+		{"true", &b, false},
+		{1.5, &i, false},
+		{2.0, &i, true},
+		{-1, &u, false},
+		{uint64(math.MaxUint64), &i, false},
+		{int64(1)<<53 + 1, new(float64), false},
+		{0.1, &f32, false},
+		{0.5, &f32, true},
+		{7, &u, true},
+	} {
+		data, err := Marshal(tc.x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = Unmarshal(data, tc.v); err != nil {
+			t.Fatalf("%v: %v", tc.x, err)
+		}
+		err = Unmarshal(data, tc.v, WithStrictTypes())
+		if _, ok := err.(*DecoderTypeError); ok == tc.ok || err != nil && !ok {
+			t.Fatalf("%v: unexpected error %v", tc.x, err)
+		}
+	}
+}
+
+func TestMarshalLittleEndian(t *testing.T) {
+	data, err := Marshal(uint16(0x0102), WithLittleEndian())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []byte{tLittleEndian, tUint16, 0x02, 0x01}, data)
+
+	var n uint16
+	if err = Unmarshal(data[1:], &n, WithLittleEndian()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, uint16(0x0102), n)
+
+	x := []interface{}{
+		map[string]interface{}{"a": []interface{}{int64(-300), 1.5, strings.Repeat("x", 300)}},
+		int64(1) << 40,
+		Tensor{Shape: []int{2}, Data: []float32{1, 2}},
+	}
+	data, err = Marshal(x[0], x[1], x[2], WithLittleEndian(), WithValueCount(), WithChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y0, y1 interface{}
+	var y2 Tensor
+	if err = Unmarshal(data, &y0, &y1, &y2); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[interface{}]interface{}{"a": x[0].(map[string]interface{})["a"]}, y0)
+	assertEqual(t, x[1], y1)
+	assertEqual(t, x[2], y2)
+}
+
+func TestUnmarshalNaNKey(t *testing.T) {
+	data := []byte{tObject8, 1, tFloat64, 0x7F, 0xF8, 0, 0, 0, 0, 0, 1, tNil}
+	var x map[float64]interface{}
+	err := Unmarshal(data, &x)
+	if _, ok := err.(*DecoderKeyError); !ok {
+		t.Fatal(err)
+	}
+	var y interface{}
+	err = Unmarshal(data, &y)
+	if _, ok := err.(*DecoderKeyError); !ok {
+		t.Fatal(err)
+	}
+	_ = err.Error()
+
+	_, err = checkDecodedLength(tArray32, uint64(maxInt)+1)
+	if _, ok := err.(*DecoderLengthError); !ok {
+		t.Fatal(err)
+	}
+	_ = err.Error()
+}
+
+func TestUnmarshalRejectDuplicates(t *testing.T) {
+	data := []byte{tObject8, 2, tString8, 1, 'A', tInt8, 1, tString8, 1, 'A', tInt8, 2}
+
+	var x map[string]int
+	if err := Unmarshal(data, &x); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]int{"A": 2}, x)
+
+	var y struct{ A int }
+	var z interface{}
+	for _, v := range []interface{}{&x, &y, &z} {
+		err := Unmarshal(data, v, WithRejectDuplicates())
+		if _, ok := err.(*DecoderError); !ok {
+			t.Fatal(err)
+		}
+	}
+
+	x = map[string]int{"A": 1, "B": 2}
+	data, _ = Marshal(map[string]int{"A": 3})
+	if err := Unmarshal(data, &x, WithRejectDuplicates(), WithInPlace()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]int{"A": 3}, x)
+}
+
+func TestUnmarshalMapMerge(t *testing.T) {
+	x := map[string]map[string]int{"a": {"x": 1}, "b": {"y": 2}}
+	data, err := Marshal(map[string]map[string]int{"a": {"z": 3}, "c": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range [][]interface{}{{WithMapMerge()}, {WithMapMerge(), WithInPlace()}} {
+		y := map[string]map[string]int{"a": {"x": 1}, "b": {"y": 2}}
+		if err = Unmarshal(data, &y, opts...); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, map[string]map[string]int{"a": {"x": 1, "z": 3}, "b": {"y": 2}, "c": {}}, y)
+	}
+	if err = Unmarshal(data, &x); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]map[string]int{"a": {"z": 3}, "c": {}}, x)
+}
+
+func TestUnmarshalPatch(t *testing.T) {
+	type inner struct{ X, Y int }
+	type outer struct {
+		Name  string
+		Count int
+		In    inner
+	}
+	data, err := Marshal(map[string]interface{}{"Count": 2, "In": map[string]int{"Y": 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x := outer{"a", 1, inner{3, 4}}
+	if err = Unmarshal(data, &x, WithPatch()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, outer{"a", 2, inner{3, 5}}, x)
+
+	if err = Unmarshal(data, &x); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, outer{"", 2, inner{0, 5}}, x)
+}
+
+func TestUnmarshalChan(t *testing.T) {
+	data, err := Marshal([]int{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan int)
+	res := make(chan []int)
+	go func() {
+		var x []int
+		for v := range ch {
+			x = append(x, v)
+		}
+		res <- x
+	}()
+	if err = Unmarshal(data, &ch); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []int{1, 2, 3}, <-res)
+
+	var nilCh chan int
+	if err = Unmarshal(data, &nilCh); err == nil {
+		t.Fatal("expected error")
+	}
+	recvCh := make(<-chan int)
+	if err = Unmarshal(data, &recvCh); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestEncodeChan(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	ch := make(chan string, 3)
+	ch <- "a"
+	ch <- "b"
+	close(ch)
+	if err := enc.EncodeChan(ch); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.EncodeChan(1); err == nil {
+		t.Fatal("expected error")
+	}
+	data := buf.Bytes()
+
+	var x1 []string
+	var x2 [3]string
+	var x3 interface{}
+	var n int
+	for _, v := range []interface{}{&x1, &x2, &x3} {
+		if err := Unmarshal(data, v, &n); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, 1, n)
+	}
+	assertEqual(t, []string{"a", "b"}, x1)
+	assertEqual(t, [3]string{"a", "b", ""}, x2)
+	assertEqual(t, []interface{}{"a", "b"}, x3)
+
+	x5 := make(chan string, 2)
+	if err := Unmarshal(data, &x5); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "a", <-x5)
+	assertEqual(t, "b", <-x5)
+
+	var x4 [1]string
+	if err := Unmarshal(data, &x4); err == nil {
+		t.Fatal("expected error")
+	}
+
+	dec := NewDecoder(bytes.NewReader(data))
+	typ, l, err := dec.PeekHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, ArrayType, typ)
+	assertEqual(t, -1, l)
+	if err = dec.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if err = dec.Decode(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	dec = NewDecoder(bytes.NewReader(data))
+	if err = CopyValue(NewEncoder(out), dec); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data[:len(data)-2], out.Bytes())
+
+	dec = NewDecoder(bytes.NewReader(data))
+	if l, err = dec.DecodeArrayHeader(); err != nil || l != -1 {
+		t.Fatal(l, err)
+	}
+	var items []string
+	for {
+		end, err := dec.DecodeArrayEnd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if end {
+			break
+		}
+		s, err := dec.DecodeString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, s)
+	}
+	assertEqual(t, []string{"a", "b"}, items)
+}
+
+func TestLoadErrorResume(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	if err := Dump(fn, 1, "a", 2, WithValueCount()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]interface{}{nil, {WithParallel()}} {
+		var x1, x2, x3 int
+		err := Load(fn, &x1, append([]interface{}{&x2, &x3}, opts...)...)
+		e, ok := err.(*LoadError)
+		if !ok {
+			t.Fatal(err)
+		}
+		if _, ok = e.Err.(*DecoderTypeError); !ok {
+			t.Fatal(e.Err)
+		}
+		_ = err.Error()
+		assertEqual(t, 1, e.Values)
+		assertEqual(t, int64(4), e.Offset)
+
+		var s string
+		if err = ResumeLoad(fn, e.Offset, &s, &x3); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, "a", s)
+		assertEqual(t, 2, x3)
+	}
+}
+
+func TestEncodeAllDecodeAll(t *testing.T) {
+	x1, x2 := NewTestInputObject(), NewTestInputArray()
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf, WithValueCount(), WithChecksum(), WithCanonical())
+	if err := enc.EncodeAll([]interface{}{x1, x2}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(x1, x2, WithValueCount(), WithChecksum(), WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data, buf.Bytes())
+
+	y1, y2 := &TestInputObject{}, &TestInputArray{}
+	dec := NewDecoder(bytes.NewReader(data), WithChecksum())
+	if err = dec.DecodeAll(&y1, &y2); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x1, y1)
+	assertEqual(t, x2, y2)
+
+	var s string
+	err = NewDecoder(bytes.NewReader(data)).DecodeAll(&y1, &s)
+	if e, ok := err.(*LoadError); !ok || e.Values != 1 {
+		t.Fatal(err)
+	}
+	err = NewDecoder(bytes.NewReader(data)).DecodeAll(&y1, &y2, &s)
+	if err == nil {
+		t.FailNow()
+	}
+}
+
+func TestMarshalMaxDepth(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	x := &node{}
+	x.Next = x
+	if _, err := Marshal(x); err == nil {
+		t.FailNow()
+	}
+	m := map[string]interface{}{}
+	m["self"] = m
+	_, err := Marshal(m)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	y := [][][]int{{{1}}}
+	if _, err = Marshal(y, WithMaxDepth(3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Marshal(y, WithMaxDepth(2)); err == nil {
+		t.FailNow()
+	}
+	if _, err = Marshal(map[string][][][]int{"a": y}, WithMaxDepth(3), WithCanonical()); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestMarshalStrictUTF8(t *testing.T) {
+	invalid := "caf\xe9"
+	if _, err := Marshal(invalid, WithStrictUTF8()); err == nil {
+		t.Fatal("invalid UTF-8 should not encode")
+	}
+	if _, err := Marshal(map[string]string{"k": invalid}, WithStrictUTF8()); err == nil {
+		t.Fatal("invalid UTF-8 should not encode")
+	}
+
+	data, err := Marshal([]interface{}{"café", invalid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x []string
+	if err = Unmarshal(data, &x); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, invalid, x[1])
+	var y []interface{}
+	if err = Unmarshal(data, &y, WithStrictUTF8()); err == nil {
+		t.Fatal("invalid UTF-8 should not decode")
+	}
+
+	dec := NewDecoder(bytes.NewReader(data), WithStrictUTF8())
+	if _, err = dec.DecodeArrayHeader(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := dec.DecodeString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "café", s)
+	if _, err = dec.DecodeString(); err == nil {
+		t.Fatal("invalid UTF-8 should not decode")
+	}
+}
+
+func TestUnmarshalBinaryPolicy(t *testing.T) {
+	data, err := Marshal([]interface{}{"text", []byte("binary")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var x []interface{}
+	if err = Unmarshal(data, &x); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []interface{}{"text", []byte("binary")}, x)
+
+	if err = Unmarshal(data, &x, WithBinaryPolicy(BinaryBase64)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []interface{}{"text", "YmluYXJ5"}, x)
+
+	// typed targets are not affected
+	var y [][]byte
+	if err = Unmarshal(data, &y, WithBinaryPolicy(BinaryBase64)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []byte("binary"), y[1])
+}
+
+func TestMarshalCanonicalMapMemory(t *testing.T) {
+	x := make(map[string]int, 1000)
+	for i := 0; i < 1000; i++ {
+		x[fmt.Sprintf("key%d", i)] = i
+	}
+	data1, err := Marshal(x, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data2, err := Marshal(x, WithCanonical(), WithMapMemory(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data1, data2)
+
+	// duplicates are detected across spilled runs
+	y := map[interface{}]interface{}{int8(1): 1, int16(1): 2}
+	for i := 0; i < 100; i++ {
+		y[fmt.Sprintf("key%d", i)] = i
+	}
+	if _, err = Marshal(y, WithCanonical(), WithMapMemory(8)); err == nil {
+		t.Fatal("duplicate canonical keys should not encode")
+	}
+}
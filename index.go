@@ -0,0 +1,172 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+const (
+	indexMagic       = "GDIX"
+	indexTrailerSize = 8 + len(indexMagic)
+)
+
+func (e *Encoder) markValue() {
+	if e.offsets != nil {
+		e.offsets = append(e.offsets, e.n)
+		e.names = nil // indexed values are decoded on their own
+	}
+}
+
+// writeFooters ends the stream with the index and checksum footers, if enabled
+func (e *Encoder) writeFooters() error {
+	e.footed = true
+	if e.index {
+		if err := e.writeIndex(); err != nil {
+			return err
+		}
+	}
+	if e.checksum {
+		return e.writeChecksum()
+	}
+	return nil
+}
+
+func (e *Encoder) writeIndex() error {
+	offset := e.n
+	if err := e.writeRaw([]byte{tIndex}); err != nil {
+		return err
+	}
+	if err := e.EncodeValue(reflect.ValueOf(e.offsets)); err != nil {
+		return err
+	}
+	trailer := make([]byte, indexTrailerSize)
+	binary.BigEndian.PutUint64(trailer, uint64(offset))
+	copy(trailer[8:], indexMagic)
+	return e.writeRaw(trailer)
+}
+
+// readIndexFooter consumes the index footer, checking its trailer
+func (d *Decoder) readIndexFooter() error {
+	if _, err := d.next(1); err != nil {
+		return err
+	}
+	if _, err := d.readRaw(nil); err != nil {
+		return err
+	}
+	trailer, err := d.next(indexTrailerSize)
+	if err != nil {
+		return err
+	}
+	if string(trailer[8:]) != indexMagic {
+		return &DecoderError{"invalid index trailer"}
+	}
+	return nil
+}
+
+// readIndex returns value offsets of the index footer, or nil if r has none
+func readIndex(r io.ReadSeeker, hdr *Decoder) ([]int64, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	// the index trailer either ends the stream or precedes a checksum footer
+	for _, end := range []int64{size, size - 1 - sha256.Size} {
+		offsets, err := readIndexAt(r, end, hdr)
+		if err != nil || offsets != nil {
+			return offsets, err
+		}
+	}
+	return nil, nil
+}
+
+func readIndexAt(r io.ReadSeeker, end int64, hdr *Decoder) ([]int64, error) {
+	end -= int64(indexTrailerSize)
+	if end < 1 {
+		return nil, nil
+	}
+	if _, err := r.Seek(end, io.SeekStart); err != nil {
+		return nil, err
+	}
+	trailer := make([]byte, indexTrailerSize)
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		return nil, err
+	}
+	if string(trailer[8:]) != indexMagic {
+		return nil, nil
+	}
+	offset := int64(binary.BigEndian.Uint64(trailer))
+	if offset < 0 || offset >= end {
+		return nil, nil
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var t [1]byte
+	if _, err := io.ReadFull(r, t[:]); err != nil {
+		return nil, err
+	} else if t[0] != tIndex {
+		return nil, nil
+	}
+	var offsets []int64
+	if err := hdr.clone(io.LimitReader(r, end-offset-1)).Decode(&offsets); err != nil {
+		return nil, err
+	}
+	return offsets, nil
+}
+
+// LoadNth decodes the n-th top-level value of the file into v. Files dumped
+// WithIndex are read from the value offset directly, others are scanned.
+func LoadNth(filename string, n int, v interface{}, opts ...Option) error {
+	f, err := open(filename, opts)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if rs, ok := f.(io.ReadSeeker); ok {
+		hdr, err := headerDecoder(rs, opts)
+		if err != nil {
+			return err
+		}
+		offsets, err := readIndex(rs, hdr)
+		if err != nil {
+			return err
+		}
+		if offsets != nil {
+			if n < 0 || n >= len(offsets) {
+				return &DecoderError{fmt.Sprintf("value %d out of range", n)}
+			}
+			if _, err = rs.Seek(offsets[n], io.SeekStart); err != nil {
+				return err
+			}
+			return hdr.clone(bufio.NewReader(rs)).Decode(v)
+		}
+		if _, err = rs.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	if n < 0 {
+		return &DecoderError{fmt.Sprintf("value %d out of range", n)}
+	}
+	dec := NewDecoder(bufio.NewReader(f), opts...)
+	for i := 0; i < n; i++ {
+		if err = dec.Skip(); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = dec.Decode(v)
+	}
+	if err == io.EOF {
+		return &DecoderError{fmt.Sprintf("value %d out of range", n)}
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoadNth(t *testing.T) {
+	fn1, fn2 := randomFilename(), randomFilename()
+	defer os.Remove(fn1)
+	defer os.Remove(fn2)
+
+	x1 := NewTestInputString()
+	x2 := NewTestInputObject()
+	x3 := NewTestInputArray()
+	if err := Dump(fn1, WithIndex(), WithValueCount(), x1, x2, x3); err != nil {
+		t.Fatal(err)
+	}
+	if err := Dump(fn2, x1, x2, x3); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fn := range []string{fn1, fn2} {
+		y2 := &TestInputObject{}
+		if err := LoadNth(fn, 1, &y2); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, x2, y2)
+
+		y3 := &TestInputArray{}
+		if err := LoadNth(fn, 2, &y3); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, x3, y3)
+
+		var y interface{}
+		err := LoadNth(fn, 3, &y)
+		if _, ok := err.(*DecoderError); !ok {
+			t.Fatal(err)
+		}
+		_ = err.Error()
+	}
+}
+
+func TestLoadNthHeader(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	x1 := NewTestInputObject()
+	x2 := NewTestInputObject()
+	if err := Dump(fn, WithIndex(), WithLittleEndian(), WithFieldHashes(), WithDedup(), x1, x2); err != nil {
+		t.Fatal(err)
+	}
+
+	y2 := &TestInputObject{}
+	if err := LoadNth(fn, 1, &y2); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x2, y2)
+}
+
+func TestLoadIndexed(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	if err := Dump(fn, WithIndex(), WithParallel(), 1, "a", true); err != nil {
+		t.Fatal(err)
+	}
+
+	var y1 int
+	var y2 string
+	if err := Load(fn, &y1, &y2); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 1, y1)
+	assertEqual(t, "a", y2)
+
+	var y3 bool
+	if err := LoadNth(fn, 2, &y3); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, true, y3)
+
+	var n int
+	err := LoadFunc(fn, func(dec *Decoder) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 3, n)
+}
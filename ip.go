@@ -0,0 +1,175 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+)
+
+// Extension codes of network addresses, which are encoded as binary before format version 2.
+const (
+	ExtIP    byte = 'I' // 4 or 16 bytes of an address, followed by the zone of IPv6 addresses
+	ExtIPNet byte = 'N' // address followed by a prefix length or a mask of the same size
+)
+
+// builtinEncoders and builtinDecoders handle standard types that are not encoded by their kinds,
+// and are filled by init functions to break the initialization cycle through decodeType
+var (
+	builtinEncoders = make(map[reflect.Type]encoderFunc)
+	builtinDecoders = make(map[reflect.Type]decoderFunc)
+)
+
+var (
+	ipType    = reflect.TypeOf(net.IP(nil))
+	ipNetType = reflect.TypeOf(net.IPNet{})
+)
+
+func init() {
+	builtinEncoders[ipType] = ipEncoder
+	builtinEncoders[ipNetType] = ipNetEncoder
+	builtinDecoders[ipType] = ipDecoder
+	builtinDecoders[ipNetType] = ipNetDecoder
+}
+
+// encodeNetwork encodes data of a network extension value, or binary before format version 2
+func (e *Encoder) encodeNetwork(code byte, data []byte) error {
+	if e.formatVersion < 2 {
+		return e.EncodeBinary(data)
+	}
+	return e.EncodeExt(Ext{code, data})
+}
+
+// decodeNetwork returns data of a network extension value or binary of type t, reporting false
+// for values of other types, which are left unread
+func (d *Decoder) decodeNetwork(t byte, code byte, target reflect.Type) ([]byte, bool, error) {
+	if tt := typeOf(t); tt != BinaryType && tt != ExtType {
+		return nil, false, nil
+	}
+	n, err := d.readSize(t)
+	if err != nil {
+		return nil, true, err
+	}
+	if typeOf(t) == ExtType {
+		var c uint8
+		if err = d.read(&c); err != nil {
+			return nil, true, err
+		}
+		if c != code {
+			return nil, true, &DecoderTypeError{"ext", target}
+		}
+	} else if n < 0 {
+		data, err := d.readBinaryStream()
+		return data, true, err
+	}
+	data, err := d.next(n)
+	return data, true, err
+}
+
+func ipEncoder(e *Encoder, v reflect.Value) error {
+	ip := v.Interface().(net.IP)
+	if ip == nil {
+		return e.EncodeNil()
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if len(ip) != net.IPv6len {
+		return &EncoderError{fmt.Sprintf("invalid IP address of %d bytes", len(ip))}
+	}
+	return e.encodeNetwork(ExtIP, ip)
+}
+
+func ipDecoder(d *Decoder, t byte, v reflect.Value) error {
+	data, ok, err := d.decodeNetwork(t, ExtIP, v.Type())
+	if !ok {
+		return d.decodeType(t, v)
+	} else if err != nil {
+		return err
+	}
+	ip, _, err := parseIP(data)
+	if err != nil {
+		return err
+	}
+	v.SetBytes(ip)
+	return nil
+}
+
+// parseIP parses an address of 4 or 16 bytes and the zone of IPv6 addresses
+func parseIP(data []byte) (net.IP, string, error) {
+	switch {
+	case len(data) == net.IPv4len:
+		return net.IP(append([]byte(nil), data...)), "", nil
+	case len(data) >= net.IPv6len:
+		return net.IP(append([]byte(nil), data[:net.IPv6len]...)), string(data[net.IPv6len:]), nil
+	}
+	return nil, "", &DecoderError{fmt.Sprintf("invalid IP address of %d bytes", len(data))}
+}
+
+func ipNetEncoder(e *Encoder, v reflect.Value) error {
+	n := v.Interface().(net.IPNet)
+	ip := n.IP.To16()
+	if len(n.Mask) == net.IPv4len {
+		ip = n.IP.To4()
+	}
+	if ip == nil || len(ip) != len(n.Mask) {
+		return &EncoderError{fmt.Sprintf("invalid IP network %s", n.String())}
+	}
+	data := append([]byte(nil), ip...)
+	if ones, bits := n.Mask.Size(); bits != 0 {
+		data = append(data, byte(ones))
+	} else {
+		data = append(data, n.Mask...)
+	}
+	return e.encodeNetwork(ExtIPNet, data)
+}
+
+func ipNetDecoder(d *Decoder, t byte, v reflect.Value) error {
+	data, ok, err := d.decodeNetwork(t, ExtIPNet, v.Type())
+	if !ok {
+		return d.decodeType(t, v)
+	} else if err != nil {
+		return err
+	}
+	n, err := parseIPNet(data)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(*n))
+	return nil
+}
+
+// parseIPNet parses an address followed by a prefix length or a mask
+func parseIPNet(data []byte) (*net.IPNet, error) {
+	var size int
+	switch len(data) {
+	case net.IPv4len + 1, 2 * net.IPv4len:
+		size = net.IPv4len
+	case net.IPv6len + 1, 2 * net.IPv6len:
+		size = net.IPv6len
+	default:
+		return nil, &DecoderError{fmt.Sprintf("invalid IP network of %d bytes", len(data))}
+	}
+	n := &net.IPNet{IP: net.IP(append([]byte(nil), data[:size]...))}
+	if len(data) == 2*size {
+		n.Mask = net.IPMask(append([]byte(nil), data[size:]...))
+	} else if ones := int(data[size]); ones <= 8*size {
+		n.Mask = net.CIDRMask(ones, 8*size)
+	} else {
+		return nil, &DecoderError{fmt.Sprintf("invalid IP network prefix length %d", ones)}
+	}
+	return n, nil
+}
+
+// networkInterface returns the data of network extension values decoded into interface{}
+func networkInterface(code byte, data []byte) (interface{}, error) {
+	if code == ExtIPNet {
+		return parseIPNet(data)
+	}
+	ip, zone, err := parseIP(data)
+	if err != nil || zone == "" {
+		return ip, err
+	}
+	return &net.IPAddr{IP: ip, Zone: zone}, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"net"
+	"testing"
+)
+
+type testHost struct {
+	Addr    net.IP
+	Network *net.IPNet
+	Mask    net.IPNet
+}
+
+func TestMarshalIP(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	x := testHost{
+		Addr:    net.ParseIP("10.1.2.3"),
+		Network: network,
+		Mask:    net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.IPMask(net.ParseIP("ffff:0:ffff::"))},
+	}
+	for _, v := range []int{1, 2} {
+		data, err := Marshal(x, WithFormatVersion(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var y testHost
+		if err = Unmarshal(data, &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, net.IP{10, 1, 2, 3}, y.Addr)
+		assertEqual(t, x.Network, y.Network)
+		assertEqual(t, x.Mask.String(), y.Mask.String())
+	}
+
+	// IPv4 addresses are encoded in 4 bytes
+	data, err := Marshal(net.ParseIP("10.1.2.3"), WithFormatVersion(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 2+2+1+4, len(data))
+
+	var y []interface{}
+	data, err = Marshal([]interface{}{net.ParseIP("::1"), network}, WithFormatVersion(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []interface{}{net.ParseIP("::1"), network}, y)
+
+	if _, err = Marshal(net.IP{1, 2, 3}); err == nil {
+		t.Fatal("invalid IP address should not encode")
+	}
+	var ip net.IP
+	if err = Unmarshal([]byte{tBinary8, 3, 1, 2, 3}, &ip); err == nil {
+		t.Fatal("invalid IP address should not decode")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package godat
+
+import (
+	"bufio"
+	"io"
+	"iter"
+)
+
+// LoadSeq iterates over the top-level values in the file; values left unread are skipped.
+func LoadSeq(filename string, opts ...Option) iter.Seq2[*Decoder, error] {
+	return func(yield func(*Decoder, error) bool) {
+		f, err := open(filename, opts)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer f.Close()
+
+		dec := NewDecoder(bufio.NewReader(f), opts...)
+		for {
+			if _, err := dec.PeekType(); err == io.EOF {
+				if err = dec.verifyChecksum(); err != nil {
+					yield(nil, err)
+				}
+				return
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+			offset := dec.InputOffset()
+			if !yield(dec, nil) {
+				return
+			}
+			if dec.InputOffset() == offset {
+				if err := dec.Skip(); err != nil {
+					yield(nil, err)
+					return
+				}
+			}
+		}
+	}
+}
+
+// Values iterates over the remaining top-level values of the stream, decoded into interface{}.
+// Iteration stops after the first error.
+func (d *Decoder) Values() iter.Seq2[interface{}, error] {
+	return func(yield func(interface{}, error) bool) {
+		for {
+			var v interface{}
+			err := d.Decode(&v)
+			if err == io.EOF || !yield(v, err) || err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package godat
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadSeq(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	err := Dump(fn, 1, "skip", 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y []int
+	for dec, err := range LoadSeq(fn) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ, _ := dec.PeekType(); typ == StringType {
+			continue
+		}
+		var i int
+		if err = dec.Decode(&i); err != nil {
+			t.Fatal(err)
+		}
+		if y = append(y, i); len(y) == 2 {
+			break
+		}
+	}
+
+	assertEqual(t, []int{1, 3}, y)
+
+	for _, err := range LoadSeq(randomFilename()) {
+		if err == nil {
+			t.FailNow()
+		}
+	}
+}
+
+func TestLoadSeqChecksum(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	if err := Dump(fn, WithChecksum(), 1, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xFF
+	if err = ioutil.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for _, err := range LoadSeq(fn, WithChecksum()) {
+		if err != nil {
+			if _, ok := err.(*DecoderError); !ok {
+				t.Fatal(err)
+			}
+			assertEqual(t, 3, n)
+			return
+		}
+		n++
+	}
+	t.Fatal("corrupted file should fail checksum")
+}
+
+func TestDecoderValues(t *testing.T) {
+	data, err := Marshal(1, "x", []int{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y []interface{}
+	for v, err := range NewDecoder(&sliceReader{data}).Values() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		y = append(y, v)
+	}
+	assertEqual(t, []interface{}{int64(1), "x", []interface{}{int64(2)}}, y)
+
+	var errs int
+	for _, err := range NewDecoder(&sliceReader{data[:len(data)-1]}).Values() {
+		if err != nil {
+			errs++
+		}
+	}
+	assertEqual(t, 1, errs)
+}
@@ -0,0 +1,19 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+//go:build go1.12
+// +build go1.12
+
+package godat
+
+import "reflect"
+
+// rangeMap calls fn for every entry of map v, without collecting its keys up front
+func rangeMap(v reflect.Value, fn func(k, v reflect.Value) error) error {
+	for it := v.MapRange(); it.Next(); {
+		if err := fn(it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+//go:build !go1.12
+// +build !go1.12
+
+package godat
+
+import "reflect"
+
+// rangeMap calls fn for every entry of map v
+func rangeMap(v reflect.Value, fn func(k, v reflect.Value) error) error {
+	for _, k := range v.MapKeys() {
+		if err := fn(k, v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// MergeStrategy controls how MergeObjects combines nested values present in both inputs.
+// The zero value merges nested objects recursively and replaces arrays.
+type MergeStrategy uint8
+
+const (
+	MergeReplaceObjects MergeStrategy = 1 << iota // replace nested objects instead of merging them
+	MergeAppendArrays                             // append arrays instead of replacing them
+)
+
+// MergeDumps concatenates the values of dump files into out, re-framing every value.
+// The output is written atomically, so out may also be one of the inputs.
+// If every input records a value count, so does the output. Options may be passed among the
+// inputs and apply to reading them and writing out.
+func MergeDumps(out string, inputs ...interface{}) error {
+	vv, opts := splitOptions(inputs)
+	filenames := make([]string, len(vv))
+	for i, v := range vv {
+		filename, ok := v.(string)
+		if !ok {
+			return &EncoderError{fmt.Sprintf("input %d is %T, not a filename", i, v)}
+		}
+		filenames[i] = filename
+	}
+
+	count, ok := 0, len(filenames) > 0
+	for _, in := range filenames {
+		n, counted, err := dumpCount(in, opts)
+		if err != nil {
+			return err
+		}
+		count, ok = count+n, ok && counted
+	}
+	tmp, err := dumpTemp(out, opts, func(enc *Encoder) error {
+		if ok {
+			if err := enc.EncodeCount(count); err != nil {
+				return err
+			}
+		}
+		for _, in := range filenames {
+			if err := mergeDump(enc, in, opts); err != nil {
+				return err
+			}
+		}
+		return enc.writeFooters()
+	})
+	if err != nil {
+		return err
+	}
+	return renameTemp(tmp, out, opts)
+}
+
+func mergeDump(enc *Encoder, filename string, opts []Option) error {
+	f, err := open(filename, opts)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := NewDecoder(bufio.NewReader(f), opts...)
+	for {
+		if _, err = dec.PeekType(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		enc.markValue()
+		if err = CopyValue(enc, dec); err != nil {
+			return err
+		}
+	}
+}
+
+func dumpCount(filename string, opts []Option) (int, bool, error) {
+	f, err := open(filename, opts)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	n, ok := NewDecoder(f, opts...).Remaining()
+	return n, ok, nil
+}
+
+// MergeObjects combines the encoded objects a and b, with values of b overriding values of a.
+// Only the first value of each input is merged, and object keys are compared by their encoding.
+func MergeObjects(a, b []byte, strategy MergeStrategy) ([]byte, error) {
+	ra, err := firstRaw(a)
+	if err != nil {
+		return nil, err
+	}
+	rb, err := firstRaw(b)
+	if err != nil {
+		return nil, err
+	}
+	if typeOf(ra[0]) != ObjectType || typeOf(rb[0]) != ObjectType {
+		return nil, &DecoderError{"merge of non-object values"}
+	}
+	return mergeRaw(ra, rb, strategy, true)
+}
+
+func firstRaw(data []byte) ([]byte, error) {
+	d := NewDecoder(&sliceReader{data})
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	return d.readRaw(nil)
+}
+
+// plainPatcher splits and joins raw values of big-endian streams without a header
+var plainPatcher = &patcher{dec: NewDecoder(nil)}
+
+func mergeRaw(a, b []byte, strategy MergeStrategy, top bool) ([]byte, error) {
+	ta, tb := typeOf(a[0]), typeOf(b[0])
+	switch {
+	case ta == ObjectType && tb == ObjectType && (top || strategy&MergeReplaceObjects == 0):
+		_, xa, err := plainPatcher.splitContainer(a)
+		if err != nil {
+			return nil, err
+		}
+		_, xb, err := plainPatcher.splitContainer(b)
+		if err != nil {
+			return nil, err
+		}
+	next:
+		for j := 0; j < len(xb); j += 2 {
+			for i := 0; i < len(xa); i += 2 {
+				if bytes.Equal(xa[i], xb[j]) {
+					if xa[i+1], err = mergeRaw(xa[i+1], xb[j+1], strategy, false); err != nil {
+						return nil, err
+					}
+					continue next
+				}
+			}
+			xa = append(xa, xb[j], xb[j+1])
+		}
+		return plainPatcher.joinContainer(ObjectType, xa)
+	case ta == ArrayType && tb == ArrayType && strategy&MergeAppendArrays != 0:
+		_, xa, err := plainPatcher.splitContainer(a)
+		if err != nil {
+			return nil, err
+		}
+		_, xb, err := plainPatcher.splitContainer(b)
+		if err != nil {
+			return nil, err
+		}
+		return plainPatcher.joinContainer(ArrayType, append(xa, xb...))
+	}
+	return b, nil
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMergeDumps(t *testing.T) {
+	fn1, fn2, out := randomFilename(), randomFilename(), randomFilename()
+	defer os.Remove(fn1)
+	defer os.Remove(fn2)
+	defer os.Remove(out)
+
+	x1 := NewTestInputBool()
+	x2 := NewTestInputString()
+	x3 := NewTestInputObject()
+	err := Dump(fn1, x1, x2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Dump(fn2, x3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = MergeDumps(out, fn1, fn2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = MergeDumps(fn1, fn1, fn2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y1 := &TestInputBool{}
+	y2 := &TestInputString{}
+	y3 := &TestInputObject{}
+	err = Load(out, &y1, &y2, &y3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x1, y1)
+	assertEqual(t, x2, y2)
+	assertEqual(t, x3, y3)
+
+	data1, _ := ioutil.ReadFile(fn1)
+	data2, _ := ioutil.ReadFile(out)
+	assertEqual(t, data2, data1)
+}
+
+func TestMergeDumpsError(t *testing.T) {
+	fn, out := randomFilename(), randomFilename()
+	defer os.Remove(fn)
+
+	err := ioutil.WriteFile(fn, []byte{tString8, 10, 'a'}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = MergeDumps(out, fn)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	_, err = os.Stat(out)
+	if !os.IsNotExist(err) {
+		t.FailNow()
+	}
+
+	err = MergeDumps(out, randomFilename())
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestMergeDumpsValueCount(t *testing.T) {
+	fn1, fn2, out := randomFilename(), randomFilename(), randomFilename()
+	defer os.Remove(fn1)
+	defer os.Remove(fn2)
+	defer os.Remove(out)
+
+	if err := Dump(fn1, WithValueCount(), 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := Dump(fn2, WithValueCount(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := MergeDumps(out, fn1, fn2); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	err := LoadFunc(out, func(dec *Decoder) error {
+		if m, ok := dec.Remaining(); !ok || m != 3-n {
+			t.Fatalf("remaining %d %v", m, ok)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 3, n)
+}
+
+func TestMergeObjects(t *testing.T) {
+	a, err := Marshal(map[string]interface{}{
+		"name": "a",
+		"list": []int{1, 2},
+		"sub":  map[string]int{"x": 1, "y": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Marshal(map[string]interface{}{
+		"list": []int{3},
+		"sub":  map[string]int{"y": 3},
+		"new":  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for strategy, expected := range map[MergeStrategy]map[string]interface{}{
+		0: {
+			"name": "a", "list": []int{3}, "sub": map[string]int{"x": 1, "y": 3}, "new": true,
+		},
+		MergeReplaceObjects | MergeAppendArrays: {
+			"name": "a", "list": []int{1, 2, 3}, "sub": map[string]int{"y": 3}, "new": true,
+		},
+	} {
+		data, err := MergeObjects(a, b, strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var x struct {
+			Name string
+			List []int
+			Sub  map[string]int
+			New  bool
+		}
+		if err = Unmarshal(data, &x, WithFieldNamer(strings.ToLower)); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, expected["name"], x.Name)
+		assertEqual(t, expected["list"], x.List)
+		assertEqual(t, expected["sub"], x.Sub)
+		assertEqual(t, expected["new"], x.New)
+	}
+
+	s, _ := Marshal("x")
+	if _, err = MergeObjects(a, s, 0); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestMergeDumpsOptions(t *testing.T) {
+	b := NewMemoryBackend()
+	key := bytes.Repeat([]byte{1}, 32)
+	if err := Dump("a.dat", WithBackend(b), WithEncryption(key), WithValueCount(), 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := Dump("b.dat", WithBackend(b), WithEncryption(key), WithValueCount(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := MergeDumps("c.dat", "a.dat", "b.dat", WithBackend(b), WithEncryption(key)); err != nil {
+		t.Fatal(err)
+	}
+
+	var y1, y2, y3 int
+	if err := Load("c.dat", &y1, &y2, &y3, WithBackend(b), WithEncryption(key)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []int{1, 2, 3}, []int{y1, y2, y3})
+
+	err := MergeDumps("c.dat", "a.dat", 1, WithBackend(b))
+	if _, ok := err.(*EncoderError); !ok {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeDumpsFooters(t *testing.T) {
+	b := NewMemoryBackend()
+	if err := Dump("a.dat", 1, "a", WithBackend(b), WithIndex(), WithChecksum()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Dump("b.dat", true, WithBackend(b), WithIndex(), WithChecksum()); err != nil {
+		t.Fatal(err)
+	}
+	if err := MergeDumps("c.dat", "a.dat", "b.dat", WithBackend(b), WithIndex(), WithChecksum()); err != nil {
+		t.Fatal(err)
+	}
+
+	var y1 int
+	var y2 string
+	var y3 bool
+	if err := Load("c.dat", &y1, &y2, &y3, WithBackend(b), WithIndex(), WithChecksum()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []interface{}{1, "a", true}, []interface{}{y1, y2, y3})
+
+	y2 = ""
+	if err := LoadNth("c.dat", 1, &y2, WithBackend(b), WithChecksum()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "a", y2)
+}
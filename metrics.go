@@ -0,0 +1,14 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import "time"
+
+// Metrics receives a call for every top-level value encoded or decoded with
+// the number of bytes written or read, time spent and the resulting error.
+// Package github.com/lokhman/godat/metrics adapts it for expvar and Prometheus.
+type Metrics interface {
+	Encoded(n int64, d time.Duration, err error)
+	Decoded(n int64, d time.Duration, err error)
+}
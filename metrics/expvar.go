@@ -0,0 +1,37 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+// Package metrics provides expvar and Prometheus adapters of godat.Metrics.
+package metrics
+
+import (
+	"expvar"
+	"time"
+)
+
+// Expvar publishes counters of encoded and decoded values as an expvar map.
+type Expvar struct {
+	m *expvar.Map
+}
+
+// NewExpvar publishes a map under name, it panics if name is already registered.
+func NewExpvar(name string) *Expvar {
+	return &Expvar{expvar.NewMap(name)}
+}
+
+func (m *Expvar) add(op string, n int64, d time.Duration, err error) {
+	m.m.Add(op+"_values", 1)
+	m.m.Add(op+"_bytes", n)
+	m.m.AddFloat(op+"_seconds", d.Seconds())
+	if err != nil {
+		m.m.Add(op+"_errors", 1)
+	}
+}
+
+func (m *Expvar) Encoded(n int64, d time.Duration, err error) {
+	m.add("encode", n, d, err)
+}
+
+func (m *Expvar) Decoded(n int64, d time.Duration, err error) {
+	m.add("decode", n, d, err)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lokhman/godat"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	_ godat.Metrics        = (*Expvar)(nil)
+	_ godat.Metrics        = (*Prometheus)(nil)
+	_ prometheus.Collector = (*Prometheus)(nil)
+)
+
+func TestExpvar(t *testing.T) {
+	m := NewExpvar("godat_test")
+	data, err := godat.Marshal(1, "x", godat.WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x bool
+	if err = godat.Unmarshal(data, &x, godat.WithMetrics(m)); err == nil {
+		t.Fatal("expected error")
+	}
+	for name, value := range map[string]string{
+		"encode_values": "2",
+		"decode_values": "1",
+		"decode_errors": "1",
+	} {
+		if s := m.m.Get(name).String(); s != value {
+			t.Fatalf("%s: %s", name, s)
+		}
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	m := NewPrometheus("")
+	data, err := godat.Marshal(1, "x", godat.WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x int
+	var y string
+	if err = godat.Unmarshal(data, &x, &y, godat.WithMetrics(m)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := prometheus.NewRegistry()
+	if err = r.Register(m); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP godat_values_total Top-level values processed.
+# TYPE godat_values_total counter
+godat_values_total{op="decode"} 2
+godat_values_total{op="encode"} 2
+`
+	if err = testutil.GatherAndCompare(r, strings.NewReader(expected), "godat_values_total"); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.ToFloat64(m.bytes.WithLabelValues("encode")); n != float64(len(data)) {
+		t.Fatalf("%v bytes", n)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus is a prometheus.Collector of counters of encoded and decoded values,
+// labelled by op, which is either "encode" or "decode".
+type Prometheus struct {
+	values, bytes, errors, seconds *prometheus.CounterVec
+}
+
+// NewPrometheus returns counters named with the namespace, "godat" if empty,
+// to be registered with a prometheus.Registerer.
+func NewPrometheus(namespace string) *Prometheus {
+	if namespace == "" {
+		namespace = "godat"
+	}
+	counter := func(name, help string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, []string{"op"})
+	}
+	return &Prometheus{
+		values:  counter("values_total", "Top-level values processed."),
+		bytes:   counter("bytes_total", "Bytes written or read."),
+		errors:  counter("errors_total", "Values that failed with an error."),
+		seconds: counter("duration_seconds_total", "Time spent processing values."),
+	}
+}
+
+func (m *Prometheus) add(op string, n int64, d time.Duration, err error) {
+	m.values.WithLabelValues(op).Inc()
+	m.bytes.WithLabelValues(op).Add(float64(n))
+	m.seconds.WithLabelValues(op).Add(d.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(op).Inc()
+	}
+}
+
+func (m *Prometheus) Encoded(n int64, d time.Duration, err error) {
+	m.add("encode", n, d, err)
+}
+
+func (m *Prometheus) Decoded(n int64, d time.Duration, err error) {
+	m.add("decode", n, d, err)
+}
+
+func (m *Prometheus) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range [...]*prometheus.CounterVec{m.values, m.bytes, m.errors, m.seconds} {
+		c.Describe(ch)
+	}
+}
+
+func (m *Prometheus) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range [...]*prometheus.CounterVec{m.values, m.bytes, m.errors, m.seconds} {
+		c.Collect(ch)
+	}
+}
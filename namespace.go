@@ -0,0 +1,273 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Namespace containers hold independent streams of values, each with its own index, followed by
+// a directory of their offsets and lengths and a trailer of the directory offset. Changes append
+// streams and a new directory, so other namespaces are never rewritten until compaction.
+const (
+	namespaceMagic       = "GDNS"
+	namespaceTrailerSize = 8 + len(namespaceMagic)
+)
+
+type namespaceDir map[string][2]int64
+
+// openNamespaces returns the directory of container filename and the container size,
+// or an empty directory if the file does not exist
+func openNamespaces(filename string, o *options) (io.ReadSeeker, io.Closer, namespaceDir, int64, error) {
+	f, err := backendOf(o).Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil, namespaceDir{}, 0, nil
+	} else if err != nil {
+		return nil, nil, nil, 0, err
+	}
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, nil, 0, err
+		}
+		rs = bytes.NewReader(data)
+	}
+	dir, size, err := readNamespaceDir(rs)
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, 0, err
+	}
+	return rs, f, dir, size, nil
+}
+
+func readNamespaceDir(rs io.ReadSeeker) (namespaceDir, int64, error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+	if size == 0 {
+		return namespaceDir{}, 0, nil
+	}
+	trailer := make([]byte, namespaceTrailerSize)
+	if size < int64(len(trailer)) {
+		return nil, 0, &DecoderError{"not a namespace container"}
+	}
+	if _, err = rs.Seek(-int64(len(trailer)), io.SeekEnd); err != nil {
+		return nil, 0, err
+	}
+	if _, err = io.ReadFull(rs, trailer); err != nil {
+		return nil, 0, err
+	}
+	if string(trailer[8:]) != namespaceMagic {
+		return nil, 0, &DecoderError{"not a namespace container"}
+	}
+	offset := int64(binary.BigEndian.Uint64(trailer))
+	end := size - int64(len(trailer))
+	if offset < 0 || offset > end {
+		return nil, 0, &DecoderError{fmt.Sprintf("namespace directory at %d out of range", offset)}
+	}
+	if _, err = rs.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	dir := namespaceDir{}
+	if err = NewDecoder(io.LimitReader(rs, end-offset)).Decode(&dir); err != nil {
+		return nil, 0, err
+	}
+	for ns, x := range dir {
+		if x[0] < 0 || x[1] < 0 || x[0] > offset || x[1] > offset-x[0] {
+			return nil, 0, &DecoderError{fmt.Sprintf("namespace %q out of range", ns)}
+		}
+	}
+	return dir, size, nil
+}
+
+// appendNamespaces appends data and directory dir to container filename of size bytes
+func appendNamespaces(filename string, size int64, data []byte, dir namespaceDir, opts []Option) error {
+	buf := bytes.NewBuffer(data)
+	if err := NewEncoder(buf, WithCanonical()).Encode(dir); err != nil {
+		return err
+	}
+	trailer := make([]byte, namespaceTrailerSize)
+	binary.BigEndian.PutUint64(trailer, uint64(size)+uint64(len(data)))
+	copy(trailer[8:], namespaceMagic)
+	buf.Write(trailer)
+
+	o := fileOptions(opts)
+	b := backendOf(o)
+	if a, ok := b.(interface {
+		Append(name string) (io.WriteCloser, error)
+	}); ok {
+		w, err := a.Append(filename)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(buf.Bytes()); err == nil && o.sync {
+			err = syncFile(w)
+		}
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	// backends that cannot append get the container rewritten
+	var old []byte
+	if size > 0 {
+		f, err := b.Open(filename)
+		if err != nil {
+			return err
+		}
+		old, err = ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	tmp := tempName(filename)
+	w, err := b.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(old[:size])
+	if err == nil {
+		_, err = w.Write(buf.Bytes())
+	}
+	if err == nil && o.sync {
+		err = syncFile(w)
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		b.Remove(tmp)
+		return err
+	}
+	return renameTemp(tmp, filename, opts)
+}
+
+// DumpNamespace encodes values like Dump into namespace ns of container filename, replacing the
+// namespace if it exists. Containers must not be changed concurrently.
+func DumpNamespace(filename, ns string, v interface{}, vv ...interface{}) error {
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+	data, err := marshal(vv, append(opts[:len(opts):len(opts)], WithIndex()))
+	if err != nil {
+		return err
+	}
+
+	_, f, dir, size, err := openNamespaces(filename, fileOptions(opts))
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		f.Close()
+	}
+	dir[ns] = [2]int64{size, int64(len(data))}
+	return appendNamespaces(filename, size, data, dir, opts)
+}
+
+// LoadNamespace decodes values of namespace ns of container filename like Load.
+func LoadNamespace(filename, ns string, v interface{}, vv ...interface{}) error {
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+	rs, f, dir, _, err := openNamespaces(filename, fileOptions(opts))
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return &os.PathError{Op: "open", Path: filename, Err: os.ErrNotExist}
+	}
+	defer f.Close()
+
+	x, ok := dir[ns]
+	if !ok {
+		return &DecoderError{fmt.Sprintf("namespace %q not found", ns)}
+	}
+	if _, err = rs.Seek(x[0], io.SeekStart); err != nil {
+		return err
+	}
+	data := make([]byte, x[1])
+	if _, err = io.ReadFull(rs, data); err != nil {
+		return err
+	}
+	return unmarshal(data, vv, opts)
+}
+
+// RemoveNamespace removes namespace ns from container filename, whose space is reclaimed by
+// CompactNamespaces.
+func RemoveNamespace(filename, ns string, opts ...Option) error {
+	_, f, dir, size, err := openNamespaces(filename, fileOptions(opts))
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		f.Close()
+	}
+	if _, ok := dir[ns]; !ok {
+		return &DecoderError{fmt.Sprintf("namespace %q not found", ns)}
+	}
+	delete(dir, ns)
+	return appendNamespaces(filename, size, nil, dir, opts)
+}
+
+// Namespaces returns the sorted names of namespaces in container filename.
+func Namespaces(filename string, opts ...Option) ([]string, error) {
+	_, f, dir, _, err := openNamespaces(filename, fileOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		f.Close()
+	}
+	return sortedNamespaces(dir), nil
+}
+
+// CompactNamespaces atomically rewrites container filename without replaced and removed namespaces.
+func CompactNamespaces(filename string, opts ...Option) error {
+	rs, f, dir, _, err := openNamespaces(filename, fileOptions(opts))
+	if err != nil || f == nil {
+		return err
+	}
+	defer f.Close()
+
+	var data []byte
+	compacted := namespaceDir{}
+	for _, ns := range sortedNamespaces(dir) {
+		x := dir[ns]
+		if _, err = rs.Seek(x[0], io.SeekStart); err != nil {
+			return err
+		}
+		p := make([]byte, x[1])
+		if _, err = io.ReadFull(rs, p); err != nil {
+			return err
+		}
+		compacted[ns] = [2]int64{int64(len(data)), x[1]}
+		data = append(data, p...)
+	}
+
+	b := backendOf(fileOptions(opts))
+	tmp := tempName(filename)
+	if err = b.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = appendNamespaces(tmp, 0, data, compacted, opts); err != nil {
+		return err
+	}
+	return renameTemp(tmp, filename, opts)
+}
+
+func sortedNamespaces(dir namespaceDir) []string {
+	names := make([]string, 0, len(dir))
+	for ns := range dir {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testNamespaces(t *testing.T, filename string, opt Option) {
+	x1 := NewTestInputObject()
+	x2 := NewTestInputArray()
+	if err := DumpNamespace(filename, "acme", x1, opt); err != nil {
+		t.Fatal(err)
+	}
+	if err := DumpNamespace(filename, "globex", x2, "extra", opt); err != nil {
+		t.Fatal(err)
+	}
+
+	y1 := &TestInputObject{}
+	if err := LoadNamespace(filename, "acme", &y1, opt); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x1, y1)
+
+	y2 := &TestInputArray{}
+	var s string
+	if err := LoadNamespace(filename, "globex", &y2, &s, opt); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x2, y2)
+	assertEqual(t, "extra", s)
+
+	// replacing and removing namespaces leaves the others intact
+	if err := DumpNamespace(filename, "acme", "replaced", opt); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveNamespace(filename, "globex", opt); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveNamespace(filename, "globex", opt); err == nil {
+		t.Fatal("removed namespace should not be removed again")
+	}
+	if err := DumpNamespace(filename, "initech", 42, opt); err != nil {
+		t.Fatal(err)
+	}
+	names, err := Namespaces(filename, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []string{"acme", "initech"}, names)
+
+	if err = LoadNamespace(filename, "globex", &y2, opt); err == nil {
+		t.Fatal("removed namespace should not load")
+	}
+	if err = LoadNamespace(filename, "acme", &s, opt); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "replaced", s)
+
+	size := namespaceSize(t, filename, opt)
+	if err = CompactNamespaces(filename, opt); err != nil {
+		t.Fatal(err)
+	}
+	if namespaceSize(t, filename, opt) >= size {
+		t.Fatal("compaction should shrink the container")
+	}
+	var n int
+	if err = LoadNamespace(filename, "initech", &n, opt); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 42, n)
+	if err = LoadNamespace(filename, "acme", &s, opt); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "replaced", s)
+}
+
+func namespaceSize(t *testing.T, filename string, opt Option) int {
+	f, err := backendOf(fileOptions([]Option{opt})).Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(data)
+}
+
+type noAppendBackend struct {
+	Backend
+}
+
+func TestNamespaces(t *testing.T) {
+	testNamespaces(t, "a.dat", WithBackend(NewMemoryBackend()))
+	testNamespaces(t, "a.dat", WithBackend(noAppendBackend{NewMemoryBackend()}))
+
+	dir, err := ioutil.TempDir("", "godat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testNamespaces(t, filepath.Join(dir, "tenants.dat"), WithSync())
+}
+
+func TestNamespacesAppend(t *testing.T) {
+	b := NewMemoryBackend()
+	if err := DumpNamespace("a.dat", "acme", NewTestInputObject(), WithBackend(b)); err != nil {
+		t.Fatal(err)
+	}
+	before := append([]byte(nil), b.files["a.dat"]...)
+	if err := DumpNamespace("a.dat", "globex", 1, WithBackend(b)); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveNamespace("a.dat", "globex", WithBackend(b)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b.files["a.dat"], before) {
+		t.Fatal("existing namespaces should not be rewritten")
+	}
+}
+
+func TestNamespacesInvalid(t *testing.T) {
+	b := NewMemoryBackend()
+	if err := Dump("a.dat", 1, WithBackend(b)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Namespaces("a.dat", WithBackend(b)); err == nil {
+		t.Fatal("plain file should not be a namespace container")
+	}
+	names, err := Namespaces("b.dat", WithBackend(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []string{}, names)
+	var n int
+	if err = LoadNamespace("b.dat", "acme", &n, WithBackend(b)); !os.IsNotExist(err) {
+		t.Fatal("missing container should not load")
+	}
+}
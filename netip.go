@@ -0,0 +1,80 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package godat
+
+import (
+	"net/netip"
+	"reflect"
+)
+
+var (
+	addrType   = reflect.TypeOf(netip.Addr{})
+	prefixType = reflect.TypeOf(netip.Prefix{})
+)
+
+func init() {
+	builtinEncoders[addrType] = addrEncoder
+	builtinEncoders[prefixType] = prefixEncoder
+	builtinDecoders[addrType] = addrDecoder
+	builtinDecoders[prefixType] = prefixDecoder
+}
+
+// addrEncoder encodes valid addresses in the layout of their MarshalBinary, and others as nil
+func addrEncoder(e *Encoder, v reflect.Value) error {
+	a := v.Interface().(netip.Addr)
+	if !a.IsValid() {
+		return e.EncodeNil()
+	}
+	data, err := a.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return e.encodeNetwork(ExtIP, data)
+}
+
+func addrDecoder(d *Decoder, t byte, v reflect.Value) error {
+	data, ok, err := d.decodeNetwork(t, ExtIP, v.Type())
+	if !ok {
+		return d.decodeType(t, v)
+	} else if err != nil {
+		return err
+	}
+	var a netip.Addr
+	if err = a.UnmarshalBinary(data); err != nil {
+		return &DecoderError{err.Error()}
+	}
+	v.Set(reflect.ValueOf(a))
+	return nil
+}
+
+// prefixEncoder encodes valid prefixes in the layout of their MarshalBinary, and others as nil
+func prefixEncoder(e *Encoder, v reflect.Value) error {
+	p := v.Interface().(netip.Prefix)
+	if !p.IsValid() {
+		return e.EncodeNil()
+	}
+	data, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return e.encodeNetwork(ExtIPNet, data)
+}
+
+func prefixDecoder(d *Decoder, t byte, v reflect.Value) error {
+	data, ok, err := d.decodeNetwork(t, ExtIPNet, v.Type())
+	if !ok {
+		return d.decodeType(t, v)
+	} else if err != nil {
+		return err
+	}
+	var p netip.Prefix
+	if err = p.UnmarshalBinary(data); err != nil {
+		return &DecoderError{err.Error()}
+	}
+	v.Set(reflect.ValueOf(p))
+	return nil
+}
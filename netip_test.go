@@ -0,0 +1,59 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package godat
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestMarshalNetip(t *testing.T) {
+	type inventory struct {
+		Addrs   []netip.Addr
+		Prefix  netip.Prefix
+		Missing netip.Addr
+	}
+	x := inventory{
+		Addrs:  []netip.Addr{netip.MustParseAddr("192.168.0.1"), netip.MustParseAddr("fe80::1%eth0")},
+		Prefix: netip.MustParsePrefix("192.168.0.0/16"),
+	}
+	for _, v := range []int{1, 2} {
+		data, err := Marshal(x, WithFormatVersion(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var y inventory
+		if err = Unmarshal(data, &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, x, y)
+	}
+
+	// addresses and prefixes are interchangeable with net types
+	data, err := Marshal(netip.MustParseAddr("10.0.0.1"), x.Prefix, WithFormatVersion(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ip net.IP
+	var network net.IPNet
+	if err = Unmarshal(data, &ip, &network); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "10.0.0.1", ip.String())
+	assertEqual(t, "192.168.0.0/16", network.String())
+
+	var y []interface{}
+	data, err = Marshal(x.Addrs, WithFormatVersion(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, &net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth0"}, y[1])
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"reflect"
+	"strings"
+)
+
+// isNullType reports whether t is one of sql.NullString, sql.NullInt64, sql.Null[T] and
+// the like, which are encoded as nil or their inner value
+func isNullType(t reflect.Type) bool {
+	return t.PkgPath() == "database/sql" && strings.HasPrefix(t.Name(), "Null") &&
+		t.NumField() == 2 && t.Field(1).Name == "Valid" && t.Field(1).Type.Kind() == reflect.Bool
+}
+
+func newNullEncoder(t reflect.Type) encoderFunc {
+	elem := typeEncoder(t.Field(0).Type)
+	return func(e *Encoder, v reflect.Value) error {
+		if !v.Field(1).Bool() {
+			return e.EncodeNil()
+		}
+		return elem(e, v.Field(0))
+	}
+}
+
+func newNullDecoder(t reflect.Type) decoderFunc {
+	elem := typeDecoder(t.Field(0).Type)
+	return func(d *Decoder, tt byte, v reflect.Value) error {
+		if tt == tNil {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if err := elem(d, tt, v.Field(0)); err != nil {
+			return err
+		}
+		v.Field(1).SetBool(true)
+		return nil
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestSQLNull(t *testing.T) {
+	type row struct {
+		Name  sql.NullString
+		Age   sql.NullInt64
+		Score sql.NullFloat64
+		Seen  sql.NullTime
+	}
+	x := []row{
+		{Name: sql.NullString{String: "a", Valid: true}, Seen: sql.NullTime{Time: time.Unix(1, 0).UTC(), Valid: true}},
+		{Age: sql.NullInt64{Int64: 0, Valid: true}},
+	}
+	data, err := Marshal(x, WithPreserveEmpty())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y []row
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+
+	var z []map[string]interface{}
+	if err = Unmarshal(data, &z); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "a", z[0]["Name"])
+	assertEqual(t, nil, z[0]["Age"])
+	assertEqual(t, int64(0), z[1]["Age"])
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+var numberType = reflect.TypeOf(Number{})
+
+// Number is a decoded numeric value that remembers its wire kind (one of
+// reflect.Int8...Int64, reflect.Uint8...Uint64, reflect.Float32 or reflect.Float64).
+// It is produced for interface{} targets when Decoder.UseNumber is enabled and is
+// encoded back with exactly the same wire type.
+type Number struct {
+	Kind reflect.Kind
+	bits uint64
+}
+
+func newNumber(kind reflect.Kind, x interface{}) Number {
+	switch x := x.(type) {
+	case int64:
+		return Number{kind, uint64(x)}
+	case uint64:
+		return Number{kind, x}
+	case float64:
+		return Number{kind, math.Float64bits(x)}
+	}
+	return Number{}
+}
+
+func exactNumber(v reflect.Value) Number {
+	switch k := v.Kind(); k {
+	case reflect.Int:
+		return Number{reflect.Int64, uint64(v.Int())}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Number{k, uint64(v.Int())}
+	case reflect.Uint, reflect.Uintptr:
+		return Number{reflect.Uint64, v.Uint()}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Number{k, v.Uint()}
+	case reflect.Float32, reflect.Float64:
+		return Number{k, math.Float64bits(v.Float())}
+	}
+	return Number{}
+}
+
+func (n Number) raw() interface{} {
+	switch {
+	case n.isInt():
+		return int64(n.bits)
+	case n.isUint():
+		return n.bits
+	}
+	return math.Float64frombits(n.bits)
+}
+
+func (n Number) value() interface{} {
+	switch n.Kind {
+	case reflect.Int8:
+		return int8(n.bits)
+	case reflect.Int16:
+		return int16(n.bits)
+	case reflect.Int32:
+		return int32(n.bits)
+	case reflect.Int64:
+		return int64(n.bits)
+	case reflect.Uint8:
+		return uint8(n.bits)
+	case reflect.Uint16:
+		return uint16(n.bits)
+	case reflect.Uint32:
+		return uint32(n.bits)
+	case reflect.Uint64:
+		return n.bits
+	case reflect.Float32:
+		return float32(math.Float64frombits(n.bits))
+	}
+	return math.Float64frombits(n.bits)
+}
+
+func (n Number) isInt() bool {
+	switch n.Kind {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func (n Number) isUint() bool {
+	switch n.Kind {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func (n Number) isFloat() bool {
+	return n.Kind == reflect.Float32 || n.Kind == reflect.Float64
+}
+
+func (n Number) error(t reflect.Type) error {
+	return &DecoderTypeError{fmt.Sprintf("%s(%s)", n.Kind, n.String()), t}
+}
+
+func (n Number) Int64() (int64, error) {
+	switch {
+	case n.isInt():
+		return int64(n.bits), nil
+	case n.isUint():
+		if n.bits <= math.MaxInt64 {
+			return int64(n.bits), nil
+		}
+	case n.isFloat():
+		if f := math.Float64frombits(n.bits); f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), nil
+		}
+	}
+	return 0, n.error(reflect.TypeOf(int64(0)))
+}
+
+func (n Number) Uint64() (uint64, error) {
+	switch {
+	case n.isInt():
+		if int64(n.bits) >= 0 {
+			return n.bits, nil
+		}
+	case n.isUint():
+		return n.bits, nil
+	case n.isFloat():
+		if f := math.Float64frombits(n.bits); f == math.Trunc(f) && f >= 0 && f < math.MaxUint64 {
+			return uint64(f), nil
+		}
+	}
+	return 0, n.error(reflect.TypeOf(uint64(0)))
+}
+
+func (n Number) Float64() float64 {
+	switch {
+	case n.isInt():
+		return float64(int64(n.bits))
+	case n.isUint():
+		return float64(n.bits)
+	}
+	return math.Float64frombits(n.bits)
+}
+
+func (n Number) String() string {
+	switch {
+	case n.isInt():
+		return strconv.FormatInt(int64(n.bits), 10)
+	case n.isUint():
+		return strconv.FormatUint(n.bits, 10)
+	case n.Kind == reflect.Float32:
+		return strconv.FormatFloat(math.Float64frombits(n.bits), 'g', -1, 32)
+	}
+	return strconv.FormatFloat(math.Float64frombits(n.bits), 'g', -1, 64)
+}
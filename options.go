@@ -0,0 +1,423 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import "reflect"
+
+type Option func(*options)
+
+type options struct {
+	exactKinds         bool
+	canonical          bool
+	errorOnUnsupported bool
+	preserveEmpty      bool
+	useNumber          bool
+	limit              int
+	parallel           bool
+	valueCount         bool
+	index              bool
+	checksum           bool
+	sync               bool
+	backend            Backend
+	deprecationWarning func(t reflect.Type, field string)
+	fieldNamer         func(name string) string
+	jsonTags           bool
+	arena              *Arena
+	inPlace            bool
+	trusted            bool
+	maxTotalBytes      int64
+	metrics            Metrics
+	softError          func(path string, offset int64, wire Type, target reflect.Type)
+	validate           bool
+	rejectDuplicates   bool
+	mergeMaps          bool
+	patch              bool
+	lenient            bool
+	strictTypes        bool
+	coercions          map[coercionKey]Coercion
+	timeLocation       TimeLocation
+	littleEndian       bool
+	formatVersion      int
+	aad                []byte
+	encryptionKey      []byte
+	keyID              string
+	keyring            Keyring
+	dict               *Dictionary
+	dicts              map[uint32]*Dictionary
+	compressThreshold  int
+	dedup              bool
+	chunkDir           string
+	chunkSize          int
+	fieldHashes        bool
+	maxDepth           int
+	strictUTF8         bool
+	binaryPolicy       BinaryPolicy
+	mapMemory          int
+	asyncWrite         bool
+	asyncSize          int
+	typedNil           bool
+}
+
+func (o *options) apply(opts []Option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func WithExactKinds() Option {
+	return func(o *options) {
+		o.exactKinds = true
+	}
+}
+
+// WithCanonical makes the Encoder write objects with keys in a total order and numeric keys at
+// their narrowest width, so that equal values always have equal bytes.
+func WithCanonical() Option {
+	return func(o *options) {
+		o.canonical = true
+	}
+}
+
+func WithErrorOnUnsupported() Option {
+	return func(o *options) {
+		o.errorOnUnsupported = true
+	}
+}
+
+func WithPreserveEmpty() Option {
+	return func(o *options) {
+		o.preserveEmpty = true
+	}
+}
+
+func WithNumbers() Option {
+	return func(o *options) {
+		o.useNumber = true
+	}
+}
+
+// WithLimit caps the length of any single string, binary, array or object accepted by a decoder.
+func WithLimit(n int) Option {
+	return func(o *options) {
+		o.limit = n
+	}
+}
+
+// WithParallel makes top-level functions encode or decode their values concurrently, preserving order.
+func WithParallel() Option {
+	return func(o *options) {
+		o.parallel = true
+	}
+}
+
+// WithValueCount makes Marshal and Dump record how many values follow, so readers can detect truncation.
+func WithValueCount() Option {
+	return func(o *options) {
+		o.valueCount = true
+	}
+}
+
+// WithIndex makes Marshal and Dump append an index of value offsets, used by LoadNth.
+func WithIndex() Option {
+	return func(o *options) {
+		o.index = true
+	}
+}
+
+// WithChecksum makes Marshal and Dump append a SHA-256 of the stream, and Unmarshal and Load verify it.
+func WithChecksum() Option {
+	return func(o *options) {
+		o.checksum = true
+	}
+}
+
+// WithSync makes Dump flush written files and their directory entries to stable storage.
+func WithSync() Option {
+	return func(o *options) {
+		o.sync = true
+	}
+}
+
+// WithBackend makes Dump and Load functions use b instead of the local filesystem.
+func WithBackend(b Backend) Option {
+	return func(o *options) {
+		o.backend = b
+	}
+}
+
+// WithDeprecationWarning makes the Decoder call fn for every decoded field tagged `godat:",deprecated"`.
+func WithDeprecationWarning(fn func(t reflect.Type, field string)) Option {
+	return func(o *options) {
+		o.deprecationWarning = fn
+	}
+}
+
+// WithFieldNamer maps names of struct fields without a tag name, e.g. WithFieldNamer(SnakeCase).
+func WithFieldNamer(fn func(name string) string) Option {
+	return func(o *options) {
+		o.fieldNamer = fn
+	}
+}
+
+// WithJSONTags uses names and options of `json` struct tags for fields without a godat tag.
+func WithJSONTags() Option {
+	return func(o *options) {
+		o.jsonTags = true
+	}
+}
+
+// WithArena makes the Decoder allocate strings and byte slices from a.
+func WithArena(a *Arena) Option {
+	return func(o *options) {
+		o.arena = a
+	}
+}
+
+// WithInPlace makes the Decoder reuse existing struct fields, map values and their allocations.
+func WithInPlace() Option {
+	return func(o *options) {
+		o.inPlace = true
+	}
+}
+
+// WithTrusted skips overflow checks and lets decoded strings and byte slices share memory
+// with the input, which must not be modified afterwards. Use only for inputs the program wrote.
+func WithTrusted() Option {
+	return func(o *options) {
+		o.trusted = true
+	}
+}
+
+// WithMaxTotalBytes aborts decoding of a top-level value once it allocates more than n bytes
+// for strings, binaries, arrays and objects.
+func WithMaxTotalBytes(n int64) Option {
+	return func(o *options) {
+		o.maxTotalBytes = n
+	}
+}
+
+// WithMetrics reports every top-level value encoded or decoded to m.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithSoftErrors makes the Decoder leave nested values that do not match their target type
+// zero and call fn with their path, input offset, wire type and target type instead of failing.
+func WithSoftErrors(fn func(path string, offset int64, wire Type, target reflect.Type)) Option {
+	return func(o *options) {
+		o.softError = fn
+	}
+}
+
+// WithValidation makes the Decoder call Validate on every decoded value implementing Validator.
+func WithValidation() Option {
+	return func(o *options) {
+		o.validate = true
+	}
+}
+
+// WithRejectDuplicates makes the Decoder fail on objects repeating a map key or struct field.
+func WithRejectDuplicates() Option {
+	return func(o *options) {
+		o.rejectDuplicates = true
+	}
+}
+
+// WithMapMerge makes the Decoder upsert decoded items into existing maps instead of replacing their contents.
+func WithMapMerge() Option {
+	return func(o *options) {
+		o.mergeMaps = true
+	}
+}
+
+// WithPatch makes the Decoder overwrite only struct fields present in the input, keeping the others.
+func WithPatch() Option {
+	return func(o *options) {
+		o.patch = true
+	}
+}
+
+// WithLenient makes the Decoder leave nested values that do not match their target type zero,
+// and return DecodeErrors listing all of them once the value is decoded.
+func WithLenient() Option {
+	return func(o *options) {
+		o.lenient = true
+	}
+}
+
+// WithStrictTypes disables coercion of strings into booleans and numbers, and of numbers that
+// do not fit their target kind exactly, e.g. fractional floats into integers.
+func WithStrictTypes() Option {
+	return func(o *options) {
+		o.strictTypes = true
+	}
+}
+
+// WithTimeLocation sets how the Encoder treats locations of time.Time values.
+func WithTimeLocation(l TimeLocation) Option {
+	return func(o *options) {
+		o.timeLocation = l
+	}
+}
+
+// WithLittleEndian makes the Encoder write multi-byte values little-endian and record it
+// in the stream header. Decoders detect the header, but assume little-endian values of
+// streams without it when the option is set.
+func WithLittleEndian() Option {
+	return func(o *options) {
+		o.littleEndian = true
+	}
+}
+
+// WithFormatVersion makes the Encoder write the format version v, 1 or 2, recorded in the stream header.
+// Version 2 adds varints, 64-bit lengths, time values and extension values. Decoders read both versions.
+func WithFormatVersion(v int) Option {
+	return func(o *options) {
+		o.formatVersion = v
+	}
+}
+
+// WithAAD sets the additional data authenticated by Seal, and expected by Open.
+func WithAAD(aad []byte) Option {
+	return func(o *options) {
+		o.aad = aad
+	}
+}
+
+// WithEncryption makes Dump seal files with key like Seal, and Load open them.
+func WithEncryption(key []byte) Option {
+	return func(o *options) {
+		o.encryptionKey = key
+	}
+}
+
+// WithKeyID sets the ID of the key recorded in sealed envelopes.
+func WithKeyID(id string) Option {
+	return func(o *options) {
+		o.keyID = id
+	}
+}
+
+// WithKeyring makes Open and Load pick the key of sealed envelopes by its ID, so keys can be rotated.
+func WithKeyring(keys Keyring) Option {
+	return func(o *options) {
+		o.keyring = keys
+	}
+}
+
+// WithDictionary makes Marshal compress its output with DEFLATE dictionary d, referenced by ID
+// in the frame header, and lets Unmarshal decompress frames referencing it. The option may be
+// repeated to decompress frames of several dictionaries, with Marshal using the last one.
+func WithDictionary(d *Dictionary) Option {
+	return func(o *options) {
+		m := make(map[uint32]*Dictionary, len(o.dicts)+1)
+		for id, x := range o.dicts {
+			m[id] = x // options may be shared between decoders
+		}
+		m[d.ID] = d
+		o.dict, o.dicts = d, m
+	}
+}
+
+// WithCompressThreshold makes the Encoder compress string and binary fields longer than n bytes,
+// as if they were tagged `godat:",compress"`.
+func WithCompressThreshold(n int) Option {
+	return func(o *options) {
+		o.compressThreshold = n
+	}
+}
+
+// WithDedup makes the Encoder replace subtrees of values equal to earlier subtrees of the same
+// value with back-references, which works best WithCanonical. Decoders detect the stream header,
+// but expect back-references in streams without it when the option is set.
+func WithDedup() Option {
+	return func(o *options) {
+		o.dedup = true
+	}
+}
+
+// WithChunkDir makes DumpChunked and LoadChunked store chunks in dir instead of "chunks" next to the file.
+func WithChunkDir(dir string) Option {
+	return func(o *options) {
+		o.chunkDir = dir
+	}
+}
+
+// WithChunkSize sets the average size of chunks written by DumpChunked, 64KB by default.
+func WithChunkSize(n int) Option {
+	return func(o *options) {
+		o.chunkSize = n
+	}
+}
+
+// WithFieldHashes makes the Encoder write struct field names as 4-byte hashes, defining each name
+// once per stream or indexed value. Canonical encoders keep writing names as strings.
+func WithFieldHashes() Option {
+	return func(o *options) {
+		o.fieldHashes = true
+	}
+}
+
+// WithMaxDepth makes the Encoder fail on values nested deeper than n arrays, objects and pointers,
+// 100000 by default, which also stops encoding of cyclic data.
+func WithMaxDepth(n int) Option {
+	return func(o *options) {
+		o.maxDepth = n
+	}
+}
+
+// WithStrictUTF8 makes the Encoder and the Decoder fail on strings that are not valid UTF-8.
+func WithStrictUTF8() Option {
+	return func(o *options) {
+		o.strictUTF8 = true
+	}
+}
+
+// WithBinaryPolicy sets how the Decoder decodes binary values into interface{}.
+func WithBinaryPolicy(p BinaryPolicy) Option {
+	return func(o *options) {
+		o.binaryPolicy = p
+	}
+}
+
+// WithMapMemory bounds the encoded entries the Encoder buffers to sort each map WithCanonical to
+// about n bytes, spilling sorted runs of entries into temporary files beyond it.
+func WithMapMemory(n int) Option {
+	return func(o *options) {
+		o.mapMemory = n
+	}
+}
+
+// WithAsyncWrite makes Dump encode values into one buffer of size bytes while a background goroutine
+// writes the other one to the file. A size of zero selects 1MB buffers.
+func WithAsyncWrite(size int) Option {
+	return func(o *options) {
+		o.asyncWrite = true
+		o.asyncSize = size
+	}
+}
+
+// WithTypedNil makes the Encoder record the type of nil pointers held in interfaces when their
+// element type is registered, so that they decode back into typed nil pointers.
+func WithTypedNil() Option {
+	return func(o *options) {
+		o.typedNil = true
+	}
+}
+
+// splitOptions separates options passed among the values of variadic top-level functions
+func splitOptions(vv []interface{}) ([]interface{}, []Option) {
+	var opts []Option
+	values := vv[:0:0]
+	for _, v := range vv {
+		if opt, ok := v.(Option); ok {
+			opts = append(opts, opt)
+		} else {
+			values = append(values, v)
+		}
+	}
+	return values, opts
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import "reflect"
+
+// orderedEncoder and orderedDecoder are implemented by OrderedMap of any type parameters
+type orderedEncoder interface {
+	encodeOrdered(e *Encoder) error
+}
+
+type orderedDecoder interface {
+	decodeOrdered(d *Decoder, t byte) error
+}
+
+var (
+	orderedEncoderType = reflect.TypeOf((*orderedEncoder)(nil)).Elem()
+	orderedDecoderType = reflect.TypeOf((*orderedDecoder)(nil)).Elem()
+)
+
+func orderedMapEncoder(e *Encoder, v reflect.Value) error {
+	return v.Interface().(orderedEncoder).encodeOrdered(e)
+}
+
+func orderedMapDecoder(d *Decoder, t byte, v reflect.Value) error {
+	if typeOf(t) != ObjectType || !v.CanAddr() {
+		return d.decodeType(t, v)
+	}
+	return v.Addr().Interface().(orderedDecoder).decodeOrdered(d, t)
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package godat
+
+import "reflect"
+
+// OrderedMap is a map that keeps the insertion order of its keys, which is also the order of
+// object items it encodes to, also WithCanonical, and decodes from. The zero value is an empty map.
+type OrderedMap[K comparable, V any] struct {
+	keys []K
+	m    map[K]V
+}
+
+// Set sets the value of k, appending k to the keys if it is new.
+func (m *OrderedMap[K, V]) Set(k K, v V) {
+	if m.m == nil {
+		m.m = make(map[K]V)
+	}
+	if _, ok := m.m[k]; !ok {
+		m.keys = append(m.keys, k)
+	}
+	m.m[k] = v
+}
+
+func (m *OrderedMap[K, V]) Get(k K) (V, bool) {
+	v, ok := m.m[k]
+	return v, ok
+}
+
+func (m *OrderedMap[K, V]) Delete(k K) {
+	if _, ok := m.m[k]; !ok {
+		return
+	}
+	delete(m.m, k)
+	for i, kk := range m.keys {
+		if kk == k {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (m *OrderedMap[K, V]) Len() int {
+	return len(m.keys)
+}
+
+// Keys returns the keys in insertion order.
+func (m *OrderedMap[K, V]) Keys() []K {
+	return append([]K(nil), m.keys...)
+}
+
+// Range calls fn for the items in insertion order until it returns false.
+func (m *OrderedMap[K, V]) Range(fn func(k K, v V) bool) {
+	for _, k := range m.keys {
+		if !fn(k, m.m[k]) {
+			return
+		}
+	}
+}
+
+func (m OrderedMap[K, V]) encodeOrdered(e *Encoder) error {
+	if err := e.EncodeObjectHeader(len(m.keys)); err != nil {
+		return err
+	}
+	for _, k := range m.keys {
+		v := m.m[k]
+		if err := e.EncodeValue(reflect.ValueOf(&k).Elem()); err != nil {
+			return err
+		}
+		if err := e.EncodeValue(reflect.ValueOf(&v).Elem()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *OrderedMap[K, V]) decodeOrdered(d *Decoder, t byte) error {
+	n, err := d.readSize(t)
+	if err != nil {
+		return err
+	}
+	*m = OrderedMap[K, V]{keys: make([]K, 0, n), m: make(map[K]V, n)}
+	for i := 0; i < n; i++ {
+		var k K
+		var v V
+		if err = d.decodeValue(reflect.ValueOf(&k)); err != nil {
+			return err
+		}
+		if err = d.decodeValue(reflect.ValueOf(&v)); err != nil {
+			return err
+		}
+		if _, ok := m.m[k]; ok && d.rejectDuplicates {
+			return &DecoderError{"duplicate key in ordered map"}
+		}
+		m.Set(k, v)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package godat
+
+import "testing"
+
+type testRenderConfig struct {
+	Sections OrderedMap[string, []int]
+	Labels   *OrderedMap[int, interface{}]
+}
+
+func TestMarshalOrderedMap(t *testing.T) {
+	var x testRenderConfig
+	for _, k := range []string{"zeta", "alpha", "mu", "beta"} {
+		x.Sections.Set(k, []int{len(k)})
+	}
+	x.Sections.Set("alpha", []int{0})
+	x.Sections.Delete("mu")
+	x.Labels = &OrderedMap[int, interface{}]{}
+	x.Labels.Set(2, "b")
+	x.Labels.Set(1, nil)
+
+	for _, opts := range [][]interface{}{nil, {WithCanonical()}} {
+		data, err := Marshal(x, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var y testRenderConfig
+		if err = Unmarshal(data, &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, []string{"zeta", "alpha", "beta"}, y.Sections.Keys())
+		v, ok := y.Sections.Get("alpha")
+		assertEqual(t, true, ok)
+		assertEqual(t, []int{0}, v)
+		assertEqual(t, []int{2, 1}, y.Labels.Keys())
+		assertEqual(t, 3, y.Sections.Len())
+
+		var m map[string]interface{}
+		if err = Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, map[interface{}]interface{}{int64(2): "b", int64(1): nil}, m["Labels"])
+	}
+
+	data, err := Marshal(map[string]int{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y OrderedMap[string, string]
+	if err = Unmarshal(data, &y); err == nil {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Set returns a copy of data with the value at path replaced by v. Path holds object keys and
+// array indexes leading to a nested value of the first value in data, a missing last key or
+// an index one past the end of an array adds the value. Only the containers along the path
+// are rewritten, so index and checksum footers of data are not updated.
+func Set(data []byte, path []interface{}, v interface{}, opts ...Option) ([]byte, error) {
+	p, err := newPatcher(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err = p.encoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return p.patch(path, buf.Bytes())
+}
+
+// Delete returns a copy of data without the value at path, see Set.
+func Delete(data []byte, path []interface{}) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, &DecoderError{"empty path"}
+	}
+	p, err := newPatcher(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return p.patch(path, nil)
+}
+
+// patcher rewrites the first value of data in the byte order, format version and field names
+// of its stream
+type patcher struct {
+	data []byte
+	opts []Option
+	dec  *Decoder // after the first value
+	head int      // offset of the first value
+	raw  []byte   // first value
+}
+
+func newPatcher(data []byte, opts []Option) (*patcher, error) {
+	d := NewDecoder(&sliceReader{data})
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	p := &patcher{data: data, opts: opts, dec: d, head: int(d.r.n)}
+	var err error
+	if p.raw, err = d.readRaw(nil); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// encoder returns an encoder of values within the stream, which are written without a header
+func (p *patcher) encoder(w io.Writer) *Encoder {
+	e := NewEncoder(w, p.opts...)
+	e.started, e.dedup = true, false
+	e.littleEndian, e.formatVersion = p.dec.le, p.dec.version
+	if len(p.dec.names) > 0 {
+		e.fieldHashes, e.names = true, &fieldNames{m: make(map[uint32]string, len(p.dec.names))}
+		for h, name := range p.dec.names {
+			var s string
+			if p.decoder(name).Decode(&s) == nil {
+				e.names.m[h] = s
+			}
+		}
+	}
+	return e
+}
+
+// decoder returns a decoder of raw values within the stream
+func (p *patcher) decoder(raw []byte) *Decoder {
+	d := p.dec.clone(&sliceReader{raw})
+	d.started = true
+	return d
+}
+
+// patch replaces the value at path with raw value val, or deletes it if val is nil
+func (p *patcher) patch(path []interface{}, val []byte) ([]byte, error) {
+	raw, err := p.patchValue(p.raw, path, val)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(p.data)-int(p.dec.r.n)+p.head+len(raw))
+	out = append(out, p.data[:p.head]...)
+	out = append(out, raw...)
+	out = append(out, p.data[p.dec.r.n:]...)
+	if len(p.dec.names) == 0 && !bytes.Contains(val, []byte{tFieldName}) {
+		return out, nil
+	}
+	return p.normalizeNames(out)
+}
+
+// normalizeNames rewrites field names of the values in data, so each is defined by its first
+// use in the stream, as patches may have moved or removed definitions
+func (p *patcher) normalizeNames(data []byte) ([]byte, error) {
+	d := NewDecoder(&sliceReader{data})
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	d.names = make(map[uint32][]byte, len(p.dec.names))
+	for h, name := range p.dec.names {
+		d.names[h] = name
+	}
+	d.written = make(map[uint32]bool)
+	out := append([]byte(nil), data[:d.r.n]...)
+	for !d.atFooter() {
+		raw, err := d.readRaw(nil)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		out = append(out, raw...)
+	}
+	return append(out, data[d.r.n:]...), nil
+}
+
+func (p *patcher) patchValue(raw []byte, path []interface{}, val []byte) ([]byte, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+	t, items, err := p.splitContainer(raw)
+	if err != nil {
+		return nil, err
+	}
+	last := len(path) == 1
+	switch typeOf(t) {
+	case ArrayType:
+		i, ok := path[0].(int)
+		if !ok {
+			return nil, &DecoderError{fmt.Sprintf("invalid array index %v", path[0])}
+		}
+		if i < 0 || i > len(items) || i == len(items) && (!last || val == nil) {
+			return nil, &DecoderError{fmt.Sprintf("array index %d out of range", i)}
+		}
+		switch {
+		case i == len(items):
+			items = append(items, val)
+		case last && val == nil:
+			items = append(items[:i], items[i+1:]...)
+		default:
+			if items[i], err = p.patchValue(items[i], path[1:], val); err != nil {
+				return nil, err
+			}
+		}
+		return p.joinContainer(ArrayType, items)
+	case ObjectType:
+		i := p.findKey(items, path[0])
+		switch {
+		case i < 0 && !last:
+			return nil, &DecoderError{fmt.Sprintf("object key %v not found", path[0])}
+		case i < 0 && val == nil:
+			return raw, nil
+		case i < 0:
+			key := new(bytes.Buffer)
+			if err = p.encoder(key).Encode(path[0]); err != nil {
+				return nil, err
+			}
+			items = append(items, key.Bytes(), val)
+		case last && val == nil:
+			items = append(items[:i], items[i+2:]...)
+		default:
+			if items[i+1], err = p.patchValue(items[i+1], path[1:], val); err != nil {
+				return nil, err
+			}
+		}
+		return p.joinContainer(ObjectType, items)
+	}
+	return nil, &DecoderError{fmt.Sprintf("cannot index %s value", typeOf(t))}
+}
+
+// splitContainer returns raw items of an encoded array, or raw keys and values of an object
+func (p *patcher) splitContainer(raw []byte) (byte, [][]byte, error) {
+	t := raw[0]
+	if typeOf(t) != ArrayType && typeOf(t) != ObjectType {
+		return t, nil, nil
+	}
+	d := p.decoder(raw[1:])
+	n, err := d.readLength(t)
+	if err != nil {
+		return t, nil, err
+	}
+	if typeOf(t) == ObjectType {
+		n *= 2
+	}
+	var items [][]byte
+	for i := 0; ; i++ {
+		if more, err := d.more(i, n); err != nil || !more {
+			return t, items, err
+		}
+		p, err := d.readRaw(nil)
+		if err != nil {
+			return t, nil, err
+		}
+		items = append(items, p)
+	}
+}
+
+func (p *patcher) joinContainer(typ Type, items [][]byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := p.encoder(buf)
+	var err error
+	if typ == ObjectType {
+		err = enc.EncodeObjectHeader(len(items) / 2)
+	} else {
+		err = enc.EncodeArrayHeader(len(items))
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range items {
+		buf.Write(p)
+	}
+	return buf.Bytes(), nil
+}
+
+// findKey returns the position of raw key equal to k in object items, or -1
+func (p *patcher) findKey(items [][]byte, k interface{}) int {
+	for i := 0; i < len(items); i += 2 {
+		kv := reflect.New(reflect.TypeOf(k))
+		if p.decoder(items[i]).Decode(kv.Interface()) == nil && reflect.DeepEqual(kv.Elem().Interface(), k) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Flatten decodes the first value in data into a map of dotted paths to its leaf values,
+// with array indexes as path elements. Empty arrays and objects are kept as leaves.
+func Flatten(data []byte, opts ...Option) (map[string]interface{}, error) {
+	var v interface{}
+	if err := NewDecoder(&sliceReader{data}, opts...).Decode(&v); err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	flatten(m, "", v)
+	return m, nil
+}
+
+func flatten(m map[string]interface{}, prefix string, v interface{}) {
+	join := func(k interface{}) string {
+		if prefix == "" {
+			return fmt.Sprint(k)
+		}
+		return prefix + "." + fmt.Sprint(k)
+	}
+	switch x := v.(type) {
+	case []interface{}:
+		if len(x) > 0 {
+			for i, xv := range x {
+				flatten(m, join(i), xv)
+			}
+			return
+		}
+	case map[interface{}]interface{}:
+		if len(x) > 0 {
+			for k, xv := range x {
+				flatten(m, join(k), xv)
+			}
+			return
+		}
+	}
+	m[prefix] = v
+}
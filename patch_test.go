@@ -0,0 +1,120 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import "testing"
+
+func TestSetDelete(t *testing.T) {
+	x := map[string]interface{}{
+		"a": []interface{}{1, 2, 3},
+		"b": map[string]interface{}{"c": "x"},
+	}
+	data, err := Marshal(x, "tail", WithValueCount())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err = Set(data, []interface{}{"a", 1}, "two"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = Set(data, []interface{}{"a", 3}, 4); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = Set(data, []interface{}{"b", "d"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = Delete(data, []interface{}{"a", 0}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = Delete(data, []interface{}{"b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var y map[string]interface{}
+	var s string
+	if err = Unmarshal(data, &y, &s); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]interface{}{
+		"a": []interface{}{"two", int64(3), int64(4)},
+		"b": map[interface{}]interface{}{"d": true},
+	}, y)
+	assertEqual(t, "tail", s)
+
+	for _, path := range [][]interface{}{{"a", 5}, {"a", "x"}, {"x", "y"}, {"b", "d", 0}} {
+		if _, err = Set(data, path, 1); err == nil {
+			t.Fatal(path)
+		}
+	}
+}
+
+func TestSetHeader(t *testing.T) {
+	type item struct {
+		A int
+		B string
+	}
+
+	for _, opt := range []Option{WithLittleEndian(), WithFormatVersion(2)} {
+		data, err := Marshal(map[string]int{"a": 1}, 2, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err = Set(data, []interface{}{"a"}, 300); err != nil {
+			t.Fatal(err)
+		}
+		if data, err = Set(data, []interface{}{"b"}, []int{70000}); err != nil {
+			t.Fatal(err)
+		}
+		var y map[string]interface{}
+		var n int
+		if err = Unmarshal(data, &y, &n); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, map[string]interface{}{"a": int64(300), "b": []interface{}{int64(70000)}}, y)
+		assertEqual(t, 2, n)
+	}
+
+	// field names defined in the first value are used by the following ones
+	data, err := Marshal([]item{{1, "x"}, {2, "y"}}, item{3, "z"}, WithFieldHashes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = Set(data, []interface{}{1, "A"}, 4); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = Set(data, []interface{}{2}, item{5, "w"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = Delete(data, []interface{}{0}); err != nil {
+		t.Fatal(err)
+	}
+	var y1 []item
+	var y2 item
+	if err = Unmarshal(data, &y1, &y2); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []item{{4, "y"}, {5, "w"}}, y1)
+	assertEqual(t, item{3, "z"}, y2)
+}
+
+func TestFlatten(t *testing.T) {
+	data, err := Marshal(map[string]interface{}{
+		"a": []interface{}{1, map[string]string{"b": "x"}},
+		"c": map[int]bool{1: true},
+		"d": []int{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Flatten(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]interface{}{
+		"a.0":   int64(1),
+		"a.1.b": "x",
+		"c.1":   true,
+		"d":     []interface{}{},
+	}, m)
+}
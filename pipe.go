@@ -0,0 +1,86 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"io"
+)
+
+// chunkWriter passes written data to fn in chunks of size bytes
+type chunkWriter struct {
+	buf []byte
+	fn  func(chunk []byte) error
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf, p = w.buf[:len(w.buf)+m], p[m:]
+		if len(w.buf) == cap(w.buf) {
+			if err := w.Flush(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *chunkWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.fn(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+// MarshalChunks encodes values like Marshal, but calls fn with the output in chunks of size bytes,
+// the last of which may be shorter, so that the encoding is never held in memory as a whole. The
+// chunk is only valid until fn returns, and an error returned by fn stops encoding.
+// Values encoded WithDictionary are compressed as a whole before being chunked.
+func MarshalChunks(size int, fn func(chunk []byte) error, v interface{}, vv ...interface{}) error {
+	if size <= 0 {
+		return &EncoderError{fmt.Sprintf("invalid chunk size %d", size)}
+	}
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+	w := &chunkWriter{buf: make([]byte, 0, size), fn: fn}
+
+	if fileOptions(opts).dict != nil {
+		data, err := marshal(vv, opts)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	enc := NewEncoder(w, opts...)
+	if err := encode(enc, vv); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// MarshalReader returns a reader of values encoded like Marshal in a separate goroutine as the
+// reader is consumed, e.g. to upload an encoding without holding it in memory. Encoding errors are
+// returned by Read, and closing the reader early stops encoding.
+func MarshalReader(v interface{}, vv ...interface{}) io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(MarshalChunks(pipeChunkSize, func(chunk []byte) error {
+			_, err := w.Write(chunk)
+			return err
+		}, v, vv...))
+	}()
+	return r
+}
+
+const pipeChunkSize = 32 << 10
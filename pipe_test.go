@@ -0,0 +1,70 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestMarshalChunks(t *testing.T) {
+	x1 := NewTestInputObject()
+	x2 := NewTestInputArray()
+	data, err := Marshal(x1, x2, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	var sizes []int
+	err = MarshalChunks(64, func(chunk []byte) error {
+		sizes = append(sizes, len(chunk))
+		buf.Write(chunk)
+		return nil
+	}, x1, x2, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data, buf.Bytes())
+	for i, n := range sizes {
+		if n != 64 && i != len(sizes)-1 || n == 0 || n > 64 {
+			t.Fatalf("invalid chunk %d of %d bytes", i, n)
+		}
+	}
+
+	errStop := errors.New("stop")
+	err = MarshalChunks(64, func([]byte) error {
+		return errStop
+	}, x1)
+	if err != errStop {
+		t.Fatal("error of fn should stop encoding")
+	}
+	if err = MarshalChunks(0, nil, x1); err == nil {
+		t.Fatal("zero chunk size should not encode")
+	}
+}
+
+func TestMarshalReader(t *testing.T) {
+	x := NewTestInputObject()
+	data, err := Marshal(x, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := MarshalReader(x, WithCanonical())
+	y, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data, y)
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r = MarshalReader(make(chan int), WithErrorOnUnsupported())
+	if _, err = ioutil.ReadAll(r); err == nil {
+		t.Fatal("encoding error should be returned by Read")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"io"
+	"sync"
+)
+
+type EncoderPool struct {
+	pool sync.Pool
+	o    options
+}
+
+func NewEncoderPool(opts ...Option) *EncoderPool {
+	p := &EncoderPool{}
+	p.o.apply(opts)
+	return p
+}
+
+func (p *EncoderPool) Get(w io.Writer) *Encoder {
+	if e, ok := p.pool.Get().(*Encoder); ok {
+		e.Reset(w)
+		return e
+	}
+	e := &Encoder{options: p.o}
+	e.Reset(w)
+	return e
+}
+
+func (p *EncoderPool) Put(e *Encoder) {
+	e.Reset(nil) // do not keep the writer alive
+	e.options = p.o
+	p.pool.Put(e)
+}
+
+type DecoderPool struct {
+	pool sync.Pool
+	o    options
+}
+
+func NewDecoderPool(opts ...Option) *DecoderPool {
+	p := &DecoderPool{}
+	p.o.apply(opts)
+	return p
+}
+
+func (p *DecoderPool) Get(r io.Reader) *Decoder {
+	if d, ok := p.pool.Get().(*Decoder); ok {
+		d.Reset(r)
+		return d
+	}
+	d := &Decoder{options: p.o}
+	d.Reset(r)
+	return d
+}
+
+func (p *DecoderPool) Put(d *Decoder) {
+	d.Reset(nil)
+	d.options = p.o
+	p.pool.Put(d)
+}
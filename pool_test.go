@@ -0,0 +1,75 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestEncoderDecoderPool(t *testing.T) {
+	encPool := NewEncoderPool(WithExactKinds())
+	decPool := NewDecoderPool(WithExactKinds())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf := new(bytes.Buffer)
+			enc := encPool.Get(buf)
+			enc.SetCanonical(true)
+			err := enc.Encode(int16(i))
+			if err != nil {
+				t.Error(err)
+			}
+			encPool.Put(enc)
+
+			var y interface{}
+			dec := decPool.Get(buf)
+			err = dec.Decode(&y)
+			if err != nil {
+				t.Error(err)
+			}
+			if err = dec.Close(); err != nil {
+				t.Error(err)
+			}
+			decPool.Put(dec)
+
+			if y != int16(i) {
+				t.Errorf("expected %d, got %v", i, y)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	enc := encPool.Get(new(bytes.Buffer))
+	if enc.canonical || !enc.exactKinds {
+		t.FailNow()
+	}
+}
+
+func TestPoolChecksum(t *testing.T) {
+	data, err := Marshal(1, "x", WithChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// objects of a cold pool are set up like the reused ones
+	var buf bytes.Buffer
+	enc := NewEncoderPool(WithChecksum()).Get(&buf)
+	if err = enc.EncodeAll([]interface{}{1, "x"}); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data, buf.Bytes())
+
+	data[len(data)-1] ^= 0xFF
+	var n int
+	var s string
+	dec := NewDecoderPool(WithChecksum()).Get(bytes.NewReader(data))
+	if err = dec.DecodeAll(&n, &s); err == nil {
+		t.Fatal("corrupted data should fail checksum")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"math"
+	"reflect"
+)
+
+// quantizeFloat rounds x to prec decimal digits, preferring a value encoded as float32
+// when it rounds to the same digits
+func quantizeFloat(x float64, prec int) float64 {
+	s := math.Pow10(prec)
+	r := math.Round(x*s) / s
+	if f := float64(float32(r)); math.Round(f*s)/s == r {
+		return f
+	}
+	return r
+}
+
+// quantized returns floats, or slices and arrays of floats, of field value f rounded to prec digits
+func quantized(f reflect.Value, prec int) reflect.Value {
+	switch f.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return reflect.ValueOf(quantizeFloat(f.Float(), prec)).Convert(f.Type())
+	case reflect.Slice, reflect.Array:
+		switch f.Type().Elem().Kind() {
+		case reflect.Float32, reflect.Float64:
+		default:
+			return f
+		}
+		var q reflect.Value
+		if f.Kind() == reflect.Slice {
+			if f.IsNil() {
+				return f
+			}
+			q = reflect.MakeSlice(f.Type(), f.Len(), f.Len())
+		} else {
+			q = reflect.New(f.Type()).Elem()
+		}
+		for i := 0; i < f.Len(); i++ {
+			q.Index(i).SetFloat(quantizeFloat(f.Index(i).Float(), prec))
+		}
+		return q
+	}
+	return f
+}
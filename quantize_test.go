@@ -0,0 +1,53 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"math"
+	"testing"
+)
+
+type testTelemetry struct {
+	Latency float64    `godat:",prec=1"`
+	Load    float64    `godat:",prec=3"`
+	Samples []float64  `godat:",prec=2"`
+	Window  [2]float32 `godat:",prec=0"`
+	Name    string     `godat:",prec=2"`
+	Exact   float64
+}
+
+func TestMarshalFieldPrecision(t *testing.T) {
+	x := testTelemetry{12.345678, 0.123456789, []float64{1.005, 2.1234}, [2]float32{1.6, -2.4}, "a", 0.1}
+	for _, opts := range [][]interface{}{nil, {WithCanonical()}} {
+		data, err := Marshal(x, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var y testTelemetry
+		if err = Unmarshal(data, &y); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range []struct {
+			x    float64
+			prec int
+			want float64
+		}{
+			{y.Latency, 1, 12.3},
+			{y.Load, 3, 0.123},
+			{y.Samples[0], 2, 1},
+			{y.Samples[1], 2, 2.12},
+			{float64(y.Window[0]), 0, 2},
+			{float64(y.Window[1]), 0, -2},
+		} {
+			if math.Abs(c.x-c.want) >= math.Pow10(-c.prec)/2 {
+				t.Fatalf("%v is not rounded to %v", c.x, c.want)
+			}
+		}
+		assertEqual(t, "a", y.Name)
+		assertEqual(t, 0.1, y.Exact)
+	}
+	assertEqual(t, 1.5, quantizeFloat(1.46, 1))
+	assertEqual(t, float64(float32(12.3)), quantizeFloat(12.345678, 1))
+	assertEqual(t, 1234567.891, quantizeFloat(1234567.8912, 3))
+}
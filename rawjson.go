@@ -0,0 +1,49 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// ExtJSON is the code of extension values holding JSON, which decode into interface{} as json.RawMessage.
+const ExtJSON byte = 'J'
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// rawMessageEncoder encodes json.RawMessage as JSON extension values, or as strings before format version 2
+func rawMessageEncoder(e *Encoder, v reflect.Value) error {
+	if e.preserveEmpty && v.IsNil() {
+		return e.EncodeNil()
+	}
+	if e.formatVersion < 2 {
+		return e.EncodeString(string(v.Bytes()))
+	}
+	return e.EncodeExt(Ext{ExtJSON, v.Bytes()})
+}
+
+// rawMessageDecoder decodes JSON extension values, strings and binaries into json.RawMessage
+func rawMessageDecoder(d *Decoder, t byte, v reflect.Value) error {
+	if typeOf(t) != ExtType {
+		return d.decodeType(t, v)
+	}
+	n, err := d.readSize(t)
+	if err != nil {
+		return err
+	}
+	var code uint8
+	if err = d.read(&code); err != nil {
+		return err
+	}
+	if code != ExtJSON {
+		return &DecoderTypeError{"ext", v.Type()}
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return err
+	}
+	v.SetBytes(data)
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type testHybrid struct {
+	ID      int
+	Payload json.RawMessage
+	Extra   *json.RawMessage
+}
+
+func TestMarshalRawMessage(t *testing.T) {
+	extra := json.RawMessage(`[1,2]`)
+	x := testHybrid{1, json.RawMessage(`{"a":true}`), &extra}
+	for _, version := range []int{1, 2} {
+		data, err := Marshal(x, WithFormatVersion(version))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var y testHybrid
+		if err = Unmarshal(data, &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, x, y)
+
+		var m map[string]interface{}
+		if err = Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		if version == 1 {
+			assertEqual(t, `{"a":true}`, m["Payload"])
+		} else {
+			assertEqual(t, json.RawMessage(`{"a":true}`), m["Payload"])
+		}
+	}
+
+	data, err := Marshal(Ext{1, []byte("{}")}, WithFormatVersion(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y json.RawMessage
+	if err = Unmarshal(data, &y); err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
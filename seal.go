@@ -0,0 +1,224 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	envelopeVersion   = 2  // version 1 has no key ID
+	envelopeNonceSize = 12 // of AES-GCM
+)
+
+// Keyring holds keys by the IDs recorded in envelopes sealed with them.
+type Keyring map[string][]byte
+
+type envelope struct {
+	header []byte // authenticated as additional data
+	id     string
+	nonce  []byte
+	aad    []byte
+}
+
+// Seal encodes the values like Marshal and encrypts them with AES-GCM under key of 16, 24 or 32 bytes.
+// The result holds the envelope version, the key ID set WithKeyID, a random nonce and the data set
+// WithAAD, which are authenticated along with the values but not encrypted.
+func Seal(key []byte, v interface{}, vv ...interface{}) ([]byte, error) {
+	_, opts := splitOptions(vv)
+	data, err := Marshal(v, vv...)
+	if err != nil {
+		return nil, err
+	}
+	o := fileOptions(opts)
+	return sealEnvelope(key, o.keyID, o.aad, data)
+}
+
+// Open decrypts data sealed with key, or with the key of its ID WithKeyring, and decodes
+// its values like Unmarshal. If data is set WithAAD, it must match the data authenticated
+// by the envelope.
+func Open(key, data []byte, v interface{}, vv ...interface{}) error {
+	_, opts := splitOptions(vv)
+	plain, err := openEnvelope(key, data, fileOptions(opts))
+	if err != nil {
+		return err
+	}
+	return Unmarshal(plain, v, vv...)
+}
+
+// EnvelopeAAD returns the additional data authenticated by sealed data, without verifying it.
+func EnvelopeAAD(data []byte) ([]byte, error) {
+	e, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	return e.aad, nil
+}
+
+// EnvelopeKeyID returns the ID of the key that sealed data, without verifying it.
+func EnvelopeKeyID(data []byte) (string, error) {
+	e, err := parseEnvelope(data)
+	if err != nil {
+		return "", err
+	}
+	return e.id, nil
+}
+
+// ReEncrypt seals the file dumped WithEncryption again with key, and the ID set WithKeyID.
+// The file is opened with the key WithEncryption or WithKeyring, and replaced atomically
+// without decoding its values or writing them unencrypted.
+func ReEncrypt(filename string, key []byte, opts ...Option) error {
+	o := fileOptions(opts)
+	b := backendOf(o)
+	f, err := b.Open(filename)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	plain, err := openEnvelope(o.encryptionKey, data, o)
+	if err != nil {
+		return err
+	}
+	if data, err = sealEnvelope(key, o.keyID, o.aad, plain); err != nil {
+		return err
+	}
+
+	tmp := tempName(filename)
+	w, err := b.Create(tmp)
+	if err == nil {
+		if _, err = w.Write(data); err == nil && o.sync {
+			err = syncFile(w)
+		}
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil {
+		err = b.Rename(tmp, filename)
+	}
+	if err != nil {
+		b.Remove(tmp)
+		return err
+	}
+	if o.sync {
+		return syncParent(b, filename)
+	}
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealEnvelope(key []byte, id string, aad, plain []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 1, 1+2*binary.MaxVarintLen64+len(id)+envelopeNonceSize+len(aad))
+	header[0] = envelopeVersion
+	header = appendUvarint(header, uint64(len(id)))
+	header = append(header, id...)
+	n := len(header)
+	header = header[:n+envelopeNonceSize]
+	if _, err = io.ReadFull(rand.Reader, header[n:]); err != nil {
+		return nil, err
+	}
+	header = appendUvarint(header, uint64(len(aad)))
+	header = append(header, aad...)
+	return aead.Seal(header, header[n:n+envelopeNonceSize], plain, header), nil
+}
+
+func appendUvarint(p []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(p, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+// openEnvelope returns the plain data sealed with key, or with the key of its ID in the keyring of o
+func openEnvelope(key, data []byte, o *options) ([]byte, error) {
+	e, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if o.keyring != nil {
+		k, ok := o.keyring[e.id]
+		if !ok && key == nil {
+			return nil, &DecoderError{fmt.Sprintf("unknown envelope key %q", e.id)}
+		} else if ok {
+			key = k
+		}
+	}
+	if o.aad != nil && !bytes.Equal(o.aad, e.aad) {
+		return nil, &DecoderError{"envelope additional data mismatch"}
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, e.nonce, data[len(e.header):], e.header)
+	if err != nil {
+		return nil, &DecoderError{"envelope authentication failed"}
+	}
+	return plain, nil
+}
+
+func parseEnvelope(data []byte) (*envelope, error) {
+	if len(data) == 0 {
+		return nil, &DecoderError{"empty envelope"}
+	}
+	if data[0] != 1 && data[0] != envelopeVersion {
+		return nil, &DecoderError{fmt.Sprintf("unsupported envelope version %d", data[0])}
+	}
+	e := &envelope{}
+	p := data[1:]
+	next := func(n uint64) ([]byte, bool) {
+		if n > uint64(len(p)) {
+			return nil, false
+		}
+		x := p[:n]
+		p = p[n:]
+		return x, true
+	}
+	nextVar := func() ([]byte, bool) {
+		n, k := binary.Uvarint(p)
+		if k <= 0 {
+			return nil, false
+		}
+		p = p[k:]
+		return next(n)
+	}
+
+	ok := true
+	if data[0] > 1 {
+		var id []byte
+		id, ok = nextVar()
+		e.id = string(id)
+	}
+	if ok {
+		e.nonce, ok = next(envelopeNonceSize)
+	}
+	if ok {
+		e.aad, ok = nextVar()
+	}
+	if !ok {
+		return nil, &DecoderError{"truncated envelope"}
+	}
+	e.header = data[:len(data)-len(p)]
+	return e, nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	aad := []byte("tenant=1")
+	data, err := Seal(key, map[string]int{"a": 1}, "x", WithAAD(aad), WithChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte{tString8, 1, 'x'}) {
+		t.Fatal("values are not encrypted")
+	}
+	x, err := EnvelopeAAD(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, aad, x)
+
+	var m map[string]int
+	var s string
+	if err = Open(key, data, &m, &s, WithChecksum()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, map[string]int{"a": 1}, m)
+	assertEqual(t, "x", s)
+	if err = Open(key, data, &m, &s, WithAAD(aad)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Open(key, data, &m, WithAAD([]byte("tenant=2"))); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = Open(bytes.Repeat([]byte{8}, 32), data, &m); err == nil {
+		t.Fatal("expected error")
+	}
+	bad := append([]byte(nil), data...)
+	bad[2+envelopeNonceSize+1] ^= 1 // additional data
+	if err = Open(key, bad, &m); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = Open(key, data[:10], &m); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = Seal([]byte("short"), 1); err == nil {
+		t.Fatal("expected error")
+	}
+
+	other, _ := Seal(key, map[string]int{"a": 1}, "x", WithAAD(aad))
+	if bytes.Equal(data, other) {
+		t.Fatal("nonce is reused")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	k1, k2 := bytes.Repeat([]byte{1}, 16), bytes.Repeat([]byte{2}, 32)
+	b := NewMemoryBackend()
+	if err := Dump("data", []int{1, 2}, "x", WithBackend(b), WithEncryption(k1), WithKeyID("k1"), WithIndex()); err != nil {
+		t.Fatal(err)
+	}
+	keys := Keyring{"k1": k1, "k2": k2}
+	var x []int
+	var s string
+	if err := Load("data", &x, &s, WithBackend(b), WithKeyring(keys)); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []int{1, 2}, x)
+	assertEqual(t, "x", s)
+
+	if err := ReEncrypt("data", k2, WithBackend(b), WithKeyring(keys), WithKeyID("k2")); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := b.Open("data")
+	data, _ := ioutil.ReadAll(f)
+	id, err := EnvelopeKeyID(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "k2", id)
+
+	if err = Load("data", &x, WithBackend(b), WithEncryption(k1)); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = Load("data", &x, WithBackend(b), WithKeyring(Keyring{"k1": k1})); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = LoadNth("data", 1, &s, WithBackend(b), WithKeyring(Keyring{"k2": k2})); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "x", s)
+	if err = Open(nil, data, &x, &s, WithKeyring(keys)); err != nil {
+		t.Fatal(err)
+	}
+
+	// envelopes of version 1 have no key ID
+	aead, _ := newAEAD(k1)
+	header := append([]byte{1}, make([]byte, envelopeNonceSize+1)...)
+	plain, _ := Marshal("v1")
+	data = aead.Seal(header, header[1:1+envelopeNonceSize], plain, header)
+	if err = Open(k1, data, &s); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "v1", s)
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// isSetType reports whether map type t has empty struct values, so it encodes as a set of its keys
+func isSetType(t reflect.Type) bool {
+	return t.Elem().Kind() == reflect.Struct && t.Elem().NumField() == 0
+}
+
+func setEncoder(e *Encoder, v reflect.Value) error {
+	if e.preserveEmpty && v.IsNil() {
+		return e.EncodeNil()
+	}
+	if err := e.writeType(tSet); err != nil {
+		return err
+	}
+	keys := v.MapKeys()
+	if err := e.EncodeArrayHeader(len(keys)); err != nil {
+		return err
+	}
+	if !e.canonical {
+		for _, k := range keys {
+			if err := e.EncodeValue(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	x := make([][]byte, len(keys))
+	for i, k := range keys {
+		var kb bytes.Buffer
+		if err := e.encodeKey(&kb, k); err != nil {
+			return err
+		}
+		x[i] = kb.Bytes()
+	}
+	return e.writeSet(x)
+}
+
+// writeSet writes encoded keys of a canonical set in the order of canonical object keys
+func (e *Encoder) writeSet(x [][]byte) error {
+	sort.Slice(x, func(i, j int) bool { return bytes.Compare(x[i], x[j]) < 0 })
+	for i, k := range x {
+		if i > 0 && bytes.Equal(x[i-1], k) {
+			return &EncoderError{fmt.Sprintf("duplicate canonical key % x", k)}
+		}
+		if err := e.writeRaw(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeSet decodes keys of a set into maps, or its array into other values
+func (d *Decoder) decodeSet(v reflect.Value) error {
+	t, err := d.readType()
+	if err != nil {
+		return err
+	}
+	if typeOf(t) != ArrayType {
+		return &DecoderError{fmt.Sprintf("set of %s", typeOf(t))}
+	}
+	for v.Kind() == reflect.Ptr {
+		v = indirect(v)
+	}
+	switch {
+	case v.Kind() == reflect.Map:
+	case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		m := reflect.ValueOf(make(map[interface{}]interface{}))
+		if err = d.decodeSetKeys(m, t, reflect.ValueOf(struct{}{})); err != nil {
+			return err
+		}
+		v.Set(m)
+		return nil
+	default:
+		return d.decodeType(t, v)
+	}
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	} else if !d.inPlace && !d.mergeMaps {
+		for _, k := range v.MapKeys() {
+			v.SetMapIndex(k, reflect.Value{})
+		}
+	}
+	member := reflect.Zero(v.Type().Elem())
+	if member.Kind() == reflect.Bool {
+		member = reflect.ValueOf(true).Convert(member.Type())
+	}
+	return d.decodeSetKeys(v, t, member)
+}
+
+// decodeSetKeys decodes the array of type t into keys of m with value member
+func (d *Decoder) decodeSetKeys(m reflect.Value, t byte, member reflect.Value) error {
+	n, err := d.readSize(t)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		if err = d.charge(n, m.Type().Key().Size()); err != nil {
+			return err
+		}
+	}
+	for i := 0; ; i++ {
+		if more, err := d.more(i, n); err != nil {
+			return err
+		} else if !more {
+			break
+		}
+		vk := reflect.New(m.Type().Key())
+		if err = d.decodeValue(vk); err != nil {
+			return err
+		}
+		k, err := hashableKey(vk.Elem())
+		if err != nil {
+			return err
+		}
+		if d.rejectDuplicates && m.MapIndex(k).IsValid() {
+			return &DecoderError{fmt.Sprintf("duplicate key %v", k.Interface())}
+		}
+		m.SetMapIndex(k, member)
+	}
+	return nil
+}
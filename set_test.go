@@ -0,0 +1,69 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMarshalSet(t *testing.T) {
+	x := map[uint32]struct{}{}
+	for i := uint32(0); i < 100; i++ {
+		x[i*1000] = struct{}{}
+	}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, tSet, data[0])
+	objects := map[uint32]map[int]int{}
+	for k := range x {
+		objects[k] = map[int]int{} // encoded like empty structs of objects
+	}
+	if p, err := Marshal(objects); err != nil || len(data) > len(p)*2/3 {
+		t.Fatalf("set of %d bytes is not compact", len(data))
+	}
+
+	var y map[uint32]struct{}
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+
+	var b map[int]bool
+	if err = Unmarshal(data, &b); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(x), len(b))
+	assertEqual(t, true, b[99000])
+
+	var s []int
+	if err = Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(x), len(s))
+
+	var v interface{}
+	if err = Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, struct{}{}, v.(map[interface{}]interface{})[uint64(5000)])
+
+	canonical, err := Marshal(x, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		var buf bytes.Buffer
+		if err = CopyValue(NewEncoder(&buf, WithCanonical()), NewDecoder(bytes.NewReader(data))); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, canonical, buf.Bytes())
+	}
+
+	if err = Unmarshal([]byte{tSet, tString8, 0}, &y); err == nil {
+		t.FailNow()
+	}
+}
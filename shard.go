@@ -0,0 +1,129 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync"
+)
+
+func shardName(filename string, i int) string {
+	return fmt.Sprintf("%s.shard%d", filename, i)
+}
+
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxShards bounds the shard count, which LoadSharded reads from the input
+const maxShards = 1 << 16
+
+// DumpSharded spreads the entries of map m across shards files by the hash of
+// their encoded keys and writes them concurrently; filename receives the shard count.
+func DumpSharded(filename string, shards int, m interface{}, opts ...Option) error {
+	v := reflect.ValueOf(m)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Map {
+		return &EncoderError{fmt.Sprintf("cannot shard value of type %T", m)}
+	}
+	if shards < 1 || shards > maxShards {
+		return &EncoderError{fmt.Sprintf("invalid shard count %d", shards)}
+	}
+
+	keys := make([][]reflect.Value, shards)
+	enc := NewEncoder(nil, opts...)
+	h := fnv.New64a()
+	var buf bytes.Buffer
+	for _, k := range v.MapKeys() {
+		buf.Reset()
+		if err := enc.clone(&buf).EncodeValue(k); err != nil {
+			return err
+		}
+		h.Reset()
+		h.Write(buf.Bytes())
+		i := h.Sum64() % uint64(shards)
+		keys[i] = append(keys[i], k)
+	}
+
+	errs := make([]error, shards)
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = dumpFunc(shardName(filename, i), opts, func(enc *Encoder) error {
+				return enc.encodeMapKeys(v, keys[i])
+			})
+		}(i)
+	}
+	wg.Wait()
+	if err := firstError(errs); err != nil {
+		return err
+	}
+
+	return dumpFunc(filename, opts, func(enc *Encoder) error {
+		return enc.Encode(shards)
+	})
+}
+
+// LoadSharded loads files written by DumpSharded concurrently into the map pointed to by m.
+func LoadSharded(filename string, m interface{}, opts ...Option) error {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return &DecoderError{fmt.Sprintf("non-pointer %T", m)}
+	}
+	v = v.Elem()
+	if v.Kind() != reflect.Map {
+		return &DecoderTypeError{"sharded object", v.Type()}
+	}
+
+	var shards int
+	if err := load(filename, []interface{}{&shards}, opts); err != nil {
+		return err
+	}
+	if shards < 1 || shards > maxShards {
+		return &DecoderError{fmt.Sprintf("invalid shard count %d", shards)}
+	}
+
+	parts := make([]reflect.Value, shards)
+	errs := make([]error, shards)
+	var wg sync.WaitGroup
+	for i := range parts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			parts[i] = reflect.New(v.Type())
+			errs[i] = load(shardName(filename, i), []interface{}{parts[i].Interface()}, opts)
+		}(i)
+	}
+	wg.Wait()
+	if err := firstError(errs); err != nil {
+		return err
+	}
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	} else {
+		for _, k := range v.MapKeys() {
+			v.SetMapIndex(k, reflect.Value{})
+		}
+	}
+	for _, p := range parts {
+		p = p.Elem()
+		for _, k := range p.MapKeys() {
+			v.SetMapIndex(k, p.MapIndex(k))
+		}
+	}
+	return nil
+}
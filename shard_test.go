@@ -0,0 +1,86 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDumpSharded(t *testing.T) {
+	fn := randomFilename()
+	defer func() {
+		os.Remove(fn)
+		for i := 0; i < 4; i++ {
+			os.Remove(shardName(fn, i))
+		}
+	}()
+
+	x := make(map[string]*TestInputInt)
+	for i := 0; i < 1000; i++ {
+		x[string(rune('A'+i%26))+string(rune('a'+i/26))] = &TestInputInt{A: i}
+	}
+	err := DumpSharded(fn, 4, x, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y0 map[string]*TestInputInt
+	err = Load(shardName(fn, 0), &y0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(y0) == 0 || len(y0) == len(x) {
+		t.FailNow()
+	}
+
+	y := map[string]*TestInputInt{"stale": nil}
+	err = LoadSharded(fn, &y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x, y)
+}
+
+func TestDumpShardedError(t *testing.T) {
+	fn := randomFilename()
+	err := DumpSharded(fn, 2, []int{1})
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	err = DumpSharded(fn, 0, map[int]int{})
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	var y map[int]int
+	err = LoadSharded(fn, &y)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	err = LoadSharded(fn, y)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
+
+func TestLoadShardedInvalidCount(t *testing.T) {
+	b := NewMemoryBackend()
+	for _, shards := range []int{-1, 0, maxShards + 1} {
+		if err := Dump("a.dat", shards, WithBackend(b)); err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]int
+		if _, ok := LoadSharded("a.dat", &m, WithBackend(b)).(*DecoderError); !ok {
+			t.Fatalf("shard count %d should not load", shards)
+		}
+	}
+}
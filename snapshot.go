@@ -0,0 +1,68 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"os"
+)
+
+type SnapshotSaver struct {
+	filename string
+	keep     int
+	opts     []Option
+}
+
+func NewSnapshotSaver(filename string, keep int, opts ...Option) *SnapshotSaver {
+	return &SnapshotSaver{filename, keep, opts}
+}
+
+func (s *SnapshotSaver) name(i int) string {
+	if i == 0 {
+		return s.filename
+	}
+	return fmt.Sprintf("%s.%d", s.filename, i)
+}
+
+func (s *SnapshotSaver) Save(v interface{}, vv ...interface{}) error {
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+	opts = append(s.opts[:len(s.opts):len(s.opts)], opts...)
+
+	tmp, err := dumpTemp(s.filename, opts, func(enc *Encoder) error {
+		return encode(enc, vv)
+	})
+	if err != nil {
+		return err
+	}
+
+	// shift older snapshots: state.dat.1 -> state.dat.2, state.dat -> state.dat.1
+	if s.keep > 0 {
+		b := backendOf(fileOptions(opts))
+		for i := s.keep - 1; i >= 0; i-- {
+			if err = b.Rename(s.name(i), s.name(i+1)); err != nil && !os.IsNotExist(err) {
+				b.Remove(tmp)
+				return err
+			}
+		}
+	}
+	return renameTemp(tmp, s.filename, opts)
+}
+
+// Load reads the newest snapshot that decodes without errors.
+func (s *SnapshotSaver) Load(v interface{}, vv ...interface{}) error {
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+	opts = append(s.opts[:len(s.opts):len(s.opts)], opts...)
+
+	var first error
+	for i := 0; i <= s.keep; i++ {
+		err := load(s.name(i), vv, opts)
+		if err == nil {
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
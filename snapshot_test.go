@@ -0,0 +1,92 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDumpAtomic(t *testing.T) {
+	fn := randomFilename()
+	defer os.Remove(fn)
+
+	x := NewTestInputString()
+	err := DumpAtomic(fn, x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y := &TestInputString{}
+	err = Load(fn, &y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x, y)
+
+	err = DumpAtomic(fn, make(chan int), WithErrorOnUnsupported())
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+
+	y = &TestInputString{}
+	err = Load(fn, &y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, x, y)
+}
+
+func TestSnapshotSaver(t *testing.T) {
+	fn := randomFilename()
+	s := NewSnapshotSaver(fn, 2)
+	defer func() {
+		for i := 0; i <= 3; i++ {
+			os.Remove(s.name(i))
+		}
+	}()
+
+	for i := 1; i <= 4; i++ {
+		err := s.Save(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := os.Stat(s.name(3))
+	if !os.IsNotExist(err) {
+		t.FailNow()
+	}
+
+	var y int
+	err = s.Load(&y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 4, y)
+
+	// corrupt the latest snapshot
+	err = ioutil.WriteFile(fn, []byte{tInt64, 1}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Load(&y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 3, y)
+
+	for i := 0; i <= 2; i++ {
+		os.Remove(s.name(i))
+	}
+	err = s.Load(&y)
+	if err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
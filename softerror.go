@@ -0,0 +1,87 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldError describes a nested value that a lenient Decoder left zero.
+type FieldError struct {
+	Path   string
+	Offset int64
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s at offset %d: %v", e.Path, e.Offset, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeErrors lists every value skipped by a lenient Decoder.
+type DecodeErrors []*FieldError
+
+func (e DecodeErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return fmt.Sprintf("godat: %d values not decoded: %s", len(e), strings.Join(s, "; "))
+}
+
+// soft reports whether type mismatches of nested values are recovered from
+func (d *Decoder) soft() bool {
+	return d.softError != nil || d.lenient
+}
+
+// decodeSoft decodes the next value into v like decodeWith, but reports type
+// mismatches to the soft error handler and leaves v zero instead of failing.
+func (d *Decoder) decodeSoft(dec decoderFunc, v reflect.Value) error {
+	offset, total := d.r.n, d.total
+	raw, err := d.readRaw(nil)
+	if err != nil {
+		return err
+	}
+	d.total = total // bytes are charged when decoded from raw
+
+	// decode from the buffered value, so the rest of it can be dropped on error
+	r := d.r
+	d.r = &peekReader{r: &sliceReader{raw}, n: offset}
+	t, err := d.readType()
+	if err == nil {
+		err = dec(d, t, v)
+	}
+	d.r = r
+
+	if _, ok := err.(*DecoderTypeError); ok {
+		if v.CanSet() {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		path := strings.Join(d.path, "")
+		if d.softError != nil {
+			d.softError(path, offset, typeOf(raw[0]), v.Type())
+		}
+		if d.lenient {
+			d.errs = append(d.errs, &FieldError{path, offset, err})
+		}
+		return nil
+	}
+	return err
+}
+
+func (d *Decoder) pushPath(elem string) {
+	if len(d.path) == 0 {
+		elem = strings.TrimPrefix(elem, ".")
+	}
+	d.path = append(d.path, elem)
+}
+
+func (d *Decoder) popPath() {
+	d.path = d.path[:len(d.path)-1]
+}
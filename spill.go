@@ -0,0 +1,187 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+)
+
+// encodeCanonicalMap encodes map v with sorted keys, iterating over its entries instead of
+// collecting keys up front where supported. Encoded entries beyond the memory limit are spilled into temporary
+// files as sorted runs, which are merged into the output.
+func (e *Encoder) encodeCanonicalMap(v reflect.Value) error {
+	s := &entrySpill{limit: e.mapMemory}
+	defer s.close()
+
+	err := rangeMap(v, func(k, v reflect.Value) error {
+		kv, err := e.encodeEntry(k, v)
+		if err != nil {
+			return err
+		}
+		return s.add(kv)
+	})
+	if err != nil {
+		return err
+	}
+	if len(s.runs) == 0 {
+		return e.writeEntries(s.x)
+	}
+	if err := s.spill(); err != nil {
+		return err
+	}
+	return s.merge(e)
+}
+
+type entrySpill struct {
+	limit int
+	size  int
+	n     int
+	x     encodedEntries
+	runs  []*os.File
+}
+
+func (s *entrySpill) add(kv [2][]byte) error {
+	s.x = append(s.x, kv)
+	s.size += len(kv[0]) + len(kv[1])
+	if s.limit > 0 && s.size > s.limit {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes buffered entries into a new sorted run
+func (s *entrySpill) spill() error {
+	if err := sortEntries(s.x); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile("", "godat")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+
+	w := bufio.NewWriter(f)
+	for _, kv := range s.x {
+		for _, p := range kv {
+			if _, err = w.Write(appendUvarint(nil, uint64(len(p)))); err != nil {
+				return err
+			}
+			if _, err = w.Write(p); err != nil {
+				return err
+			}
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	s.n += len(s.x)
+	s.x, s.size = s.x[:0], 0
+	return nil
+}
+
+// merge writes the entries of all runs into e in key order
+func (s *entrySpill) merge(e *Encoder) error {
+	h := make(runHeap, 0, len(s.runs))
+	for _, f := range s.runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r := &spillRun{r: bufio.NewReader(f)}
+		if ok, err := r.next(); err != nil {
+			return err
+		} else if ok {
+			h = append(h, r)
+		}
+	}
+	heap.Init(&h)
+
+	if err := e.EncodeObjectHeader(s.n); err != nil {
+		return err
+	}
+	var last []byte
+	for len(h) > 0 {
+		r := h[0]
+		if last != nil && bytes.Equal(last, r.kv[0]) {
+			return duplicateKeyError(last)
+		}
+		if err := e.writeRaw(r.kv[0]); err != nil {
+			return err
+		}
+		if err := e.writeRaw(r.kv[1]); err != nil {
+			return err
+		}
+		last = r.kv[0]
+		if ok, err := r.next(); err != nil {
+			return err
+		} else if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return nil
+}
+
+func (s *entrySpill) close() {
+	for _, f := range s.runs {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+type spillRun struct {
+	r  *bufio.Reader
+	kv [2][]byte
+}
+
+// next reads the following entry of the run, reporting false at its end
+func (r *spillRun) next() (bool, error) {
+	for i := range r.kv {
+		n, err := binary.ReadUvarint(r.r)
+		if err == io.EOF && i == 0 {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		p := make([]byte, n)
+		if _, err = io.ReadFull(r.r, p); err != nil {
+			return false, err
+		}
+		r.kv[i] = p
+	}
+	return true, nil
+}
+
+type runHeap []*spillRun
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return bytes.Compare(h[i].kv[0], h[j].kv[0]) < 0 }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*spillRun)) }
+
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// sortEntries sorts x by encoded keys, which must be unique
+func sortEntries(x encodedEntries) error {
+	sort.Sort(x)
+	for i := 1; i < len(x); i++ {
+		if bytes.Equal(x[i-1][0], x[i][0]) {
+			return duplicateKeyError(x[i][0])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"time"
+)
+
+// Standard types keeping their state in unexported fields are encoded by built-in rules:
+// regexp.Regexp as its source string, time.Location as its name, and big.Int as an integer
+// number if it fits 64 bits, or as its decimal string otherwise.
+var (
+	regexpType   = reflect.TypeOf(regexp.Regexp{})
+	locationType = reflect.TypeOf(time.Location{})
+	bigIntType   = reflect.TypeOf(big.Int{})
+)
+
+func init() {
+	builtinEncoders[regexpType] = regexpEncoder
+	builtinEncoders[locationType] = locationEncoder
+	builtinEncoders[bigIntType] = bigIntEncoder
+	builtinDecoders[regexpType] = regexpDecoder
+	builtinDecoders[locationType] = locationDecoder
+	builtinDecoders[reflect.PtrTo(locationType)] = locationDecoder
+	builtinDecoders[bigIntType] = bigIntDecoder
+}
+
+// addrOf returns the address of v, copying it if v is not addressable
+func addrOf(v reflect.Value) interface{} {
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface()
+}
+
+// decodeText returns the string of type t, reporting false for values of other types, which are left unread
+func (d *Decoder) decodeText(t byte) (string, bool, error) {
+	if typeOf(t) != StringType {
+		return "", false, nil
+	}
+	n, err := d.readSize(t)
+	if err != nil {
+		return "", true, err
+	}
+	data, err := d.nextString(n)
+	return string(data), true, err
+}
+
+func regexpEncoder(e *Encoder, v reflect.Value) error {
+	return e.EncodeString(addrOf(v).(*regexp.Regexp).String())
+}
+
+func regexpDecoder(d *Decoder, t byte, v reflect.Value) error {
+	s, ok, err := d.decodeText(t)
+	if !ok {
+		return d.decodeType(t, v)
+	} else if err != nil {
+		return err
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return &DecoderError{err.Error()}
+	}
+	v.Set(reflect.ValueOf(re).Elem())
+	return nil
+}
+
+func locationEncoder(e *Encoder, v reflect.Value) error {
+	return e.EncodeString(addrOf(v).(*time.Location).String())
+}
+
+func locationDecoder(d *Decoder, t byte, v reflect.Value) error {
+	s, ok, err := d.decodeText(t)
+	if !ok {
+		return d.decodeType(t, v)
+	} else if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return &DecoderError{err.Error()}
+	}
+	if v.Kind() == reflect.Ptr {
+		// keep pointers to shared locations, e.g. time.Local
+		v.Set(reflect.ValueOf(loc))
+	} else {
+		_ = loc.String() // copies of time.Local must be initialized
+		v.Set(reflect.ValueOf(loc).Elem())
+	}
+	return nil
+}
+
+func bigIntEncoder(e *Encoder, v reflect.Value) error {
+	x := addrOf(v).(*big.Int)
+	switch {
+	case x.IsInt64():
+		return e.EncodeInt(x.Int64())
+	case x.IsUint64():
+		return e.EncodeUint(x.Uint64())
+	}
+	return e.EncodeString(x.String())
+}
+
+func bigIntDecoder(d *Decoder, t byte, v reflect.Value) error {
+	var s string
+	switch typeOf(t) {
+	case IntType, UintType:
+		n, err := d.readNumber(t)
+		if err != nil {
+			return err
+		}
+		s = n.String()
+	case StringType:
+		var err error
+		if s, _, err = d.decodeText(t); err != nil {
+			return err
+		}
+	default:
+		return d.decodeType(t, v)
+	}
+	x, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return &DecoderError{fmt.Sprintf("invalid integer %q", s)}
+	}
+	v.Set(reflect.ValueOf(x).Elem())
+	return nil
+}
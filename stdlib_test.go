@@ -0,0 +1,71 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"math/big"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestMarshalStdlibTypes(t *testing.T) {
+	type rules struct {
+		Pattern *regexp.Regexp
+		Zone    *time.Location
+		Local   *time.Location
+		Small   *big.Int
+		Large   big.Int
+		Nil     *time.Location
+	}
+	large, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	x := rules{
+		Pattern: regexp.MustCompile(`^[a-z]+\d*$`),
+		Zone:    time.UTC,
+		Local:   time.Local,
+		Small:   big.NewInt(42),
+		Large:   *large,
+	}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y rules
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x.Pattern.String(), y.Pattern.String())
+	if !y.Pattern.MatchString("abc12") {
+		t.Fatal("decoded pattern should match")
+	}
+	assertEqual(t, time.UTC, y.Zone)
+	assertEqual(t, time.Local, y.Local)
+	assertEqual(t, 0, x.Small.Cmp(y.Small))
+	assertEqual(t, 0, x.Large.Cmp(&y.Large))
+	assertEqual(t, (*time.Location)(nil), y.Nil)
+
+	// rules are readable when decoded into interfaces
+	var z map[string]interface{}
+	if err = Unmarshal(data, &z); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, `^[a-z]+\d*$`, z["Pattern"])
+	assertEqual(t, "UTC", z["Zone"])
+	assertEqual(t, "-123456789012345678901234567890", z["Large"])
+
+	if err = Unmarshal(mustMarshal(t, map[string]string{"Pattern": "("}), &y); err == nil {
+		t.Fatal("invalid pattern should not decode")
+	}
+	if err = Unmarshal(mustMarshal(t, map[string]string{"Zone": "Nowhere/Unknown"}), &y); err == nil {
+		t.Fatal("unknown location should not decode")
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	data, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"encoding/base64"
+	"strings"
+	"unsafe"
+)
+
+// TextPrefix marks values encoded by EncodeToText.
+const TextPrefix = "godat1:"
+
+// MarshalToString is Marshal returning a string, which shares memory with the encoded data.
+func MarshalToString(v interface{}, vv ...interface{}) (string, error) {
+	data, err := Marshal(v, vv...)
+	if err != nil {
+		return "", err
+	}
+	return *(*string)(unsafe.Pointer(&data)), nil
+}
+
+// UnmarshalFromString is Unmarshal reading from s without copying it.
+func UnmarshalFromString(s string, v interface{}, vv ...interface{}) error {
+	vv, opts := splitOptions(append([]interface{}{v}, vv...))
+	if fileOptions(opts).trusted {
+		// trusted decoders would let byte slices share the immutable memory of s
+		return unmarshal([]byte(s), vv, opts)
+	}
+	return unmarshal(*(*[]byte)(unsafe.Pointer(&struct {
+		string
+		int
+	}{s, len(s)})), vv, opts)
+}
+
+// EncodeToText encodes values like Marshal into TextPrefix followed by their standard base64,
+// which can be embedded into JSON, YAML or environment variables.
+func EncodeToText(v interface{}, vv ...interface{}) (string, error) {
+	data, err := Marshal(v, vv...)
+	if err != nil {
+		return "", err
+	}
+	return TextPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecodeFromText decodes values of EncodeToText, with or without TextPrefix, like Unmarshal.
+func DecodeFromText(s string, v interface{}, vv ...interface{}) error {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, TextPrefix))
+	if err != nil {
+		return &DecoderError{"invalid text: " + err.Error()}
+	}
+	return Unmarshal(data, v, vv...)
+}
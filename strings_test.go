@@ -0,0 +1,57 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarshalToString(t *testing.T) {
+	x := NewTestInputObject()
+	s, err := MarshalToString(x, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(x, WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, string(data), s)
+
+	for _, opts := range [][]interface{}{nil, {WithTrusted()}} {
+		y := &TestInputObject{}
+		if err = UnmarshalFromString(s, &y, opts...); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, x, y)
+	}
+
+	var z interface{}
+	if err = UnmarshalFromString("", &z); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestEncodeToText(t *testing.T) {
+	s, err := EncodeToText([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "godat1:QQJTAWFTAWI=", s)
+
+	for _, s := range []string{s, strings.TrimPrefix(s, TextPrefix)} {
+		var y []string
+		if err = DecodeFromText(s, &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, []string{"a", "b"}, y)
+	}
+
+	var y []string
+	if err = DecodeFromText("godat1:QQ!", &y); err == nil {
+		t.FailNow()
+	}
+	_ = err.Error()
+}
@@ -0,0 +1,9 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+// directories cannot be synced on Windows, file metadata is flushed with the file itself
+func syncDir(dir string) error {
+	return nil
+}
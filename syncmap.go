@@ -0,0 +1,48 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"reflect"
+	"sync"
+)
+
+var syncMapType = reflect.TypeOf(sync.Map{})
+
+// syncMapEncoder encodes entries of sync.Map as an object, like map[interface{}]interface{}
+func syncMapEncoder(e *Encoder, v reflect.Value) error {
+	if !v.CanAddr() {
+		p := reflect.New(syncMapType)
+		p.Elem().Set(v)
+		v = p.Elem()
+	}
+	m := make(map[interface{}]interface{})
+	v.Addr().Interface().(*sync.Map).Range(func(key, value interface{}) bool {
+		m[key] = value
+		return true
+	})
+	return e.encodeMap(reflect.ValueOf(m))
+}
+
+// syncMapDecoder stores decoded entries of objects into sync.Map, replacing its entries like maps
+func syncMapDecoder(d *Decoder, t byte, v reflect.Value) error {
+	if typeOf(t) != ObjectType || !v.CanAddr() {
+		return d.decodeType(t, v)
+	}
+	var m map[interface{}]interface{}
+	if err := d.decodeType(t, reflect.ValueOf(&m).Elem()); err != nil {
+		return err
+	}
+	sm := v.Addr().Interface().(*sync.Map)
+	if !d.inPlace && !d.mergeMaps {
+		sm.Range(func(key, _ interface{}) bool {
+			sm.Delete(key)
+			return true
+		})
+	}
+	for key, value := range m {
+		sm.Store(key, value)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"sync"
+	"testing"
+)
+
+type testCache struct {
+	Name    string
+	Entries sync.Map
+	Shared  *sync.Map
+}
+
+func TestMarshalSyncMap(t *testing.T) {
+	x := &testCache{Name: "cache", Shared: new(sync.Map)}
+	x.Entries.Store("a", int64(1))
+	x.Entries.Store(int64(2), []interface{}{"b"})
+	x.Shared.Store("c", true)
+
+	for _, opts := range [][]interface{}{nil, {WithCanonical()}} {
+		data, err := Marshal(x, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		y := &testCache{}
+		if err = Unmarshal(data, &y); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, "cache", y.Name)
+		for key, value := range map[interface{}]interface{}{
+			"a":      int64(1),
+			int64(2): []interface{}{"b"},
+		} {
+			v, _ := y.Entries.Load(key)
+			assertEqual(t, value, v)
+		}
+		v, _ := y.Shared.Load("c")
+		assertEqual(t, true, v)
+
+		var m map[string]interface{}
+		if err = Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, map[interface{}]interface{}{"c": true}, m["Shared"])
+	}
+
+	data, err := Marshal(x.Shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y := new(sync.Map)
+	y.Store("d", "kept")
+	if err = Unmarshal(data, y, WithMapMerge()); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := y.Load("d")
+	assertEqual(t, "kept", v)
+	if err = Unmarshal(data, y); err != nil {
+		t.Fatal(err)
+	}
+	_, ok := y.Load("d")
+	assertEqual(t, false, ok)
+	v, _ = y.Load("c")
+	assertEqual(t, true, v)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+type teeValidator struct {
+	r    io.Reader
+	pw   *io.PipeWriter
+	done chan error
+	err  error
+}
+
+// TeeValidator returns a reader that passes the bytes of r through, while checking
+// that they form a valid stream of values, verifying the checksum WithChecksum.
+// Reads fail once a problem is found, and Close stops the validation.
+func TeeValidator(r io.Reader, opts ...Option) io.ReadCloser {
+	pr, pw := io.Pipe()
+	t := &teeValidator{r: r, pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := validateStream(NewDecoder(pr, opts...))
+		if err == nil {
+			_, err = io.Copy(ioutil.Discard, pr) // trailing index or values not counted
+		}
+		pr.CloseWithError(err)
+		t.done <- err
+	}()
+	return t
+}
+
+func validateStream(d *Decoder) error {
+	for {
+		if err := d.Skip(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return d.verifyChecksum()
+}
+
+func (t *teeValidator) Read(p []byte) (int, error) {
+	if t.err != nil {
+		return 0, t.err
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if _, werr := t.pw.Write(p[:n]); werr != nil {
+			t.err = <-t.done
+			return 0, t.err
+		}
+	}
+	if err == io.EOF {
+		t.pw.Close()
+		if t.err = <-t.done; t.err == nil {
+			t.err = io.EOF
+		}
+		return n, t.err
+	}
+	return n, err
+}
+
+func (t *teeValidator) Close() error {
+	if t.err == nil {
+		t.err = &DecoderError{"read from closed validator"}
+		t.pw.CloseWithError(t.err)
+		<-t.done
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestTeeValidator(t *testing.T) {
+	data, err := Marshal(map[string]interface{}{"a": strings.Repeat("x", 1000)}, []int{1, 2}, WithChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	r := TeeValidator(iotest.OneByteReader(bytes.NewReader(data)), WithChecksum())
+	if _, err = io.Copy(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data, buf.Bytes())
+	r.Close()
+
+	bad := append([]byte(nil), data...)
+	bad[len(bad)-1] ^= 1
+	if _, err = ioutil.ReadAll(TeeValidator(bytes.NewReader(bad), WithChecksum())); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = ioutil.ReadAll(TeeValidator(bytes.NewReader(data[:100]))); err == nil {
+		t.Fatal("expected error")
+	}
+	bad = append([]byte{tArray8, 2, 0xFF}, data...)
+	if _, err = ioutil.ReadAll(TeeValidator(bytes.NewReader(bad))); err == nil {
+		t.Fatal("expected error")
+	}
+
+	r = TeeValidator(bytes.NewReader(data))
+	if _, err = r.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, err = r.Read(make([]byte, 10)); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Tensor is a dense multi-dimensional array of numbers in row-major order. It is encoded
+// as its shape followed by a packed block of Data, which is one of []float64, []float32,
+// []int64 or []int32.
+type Tensor struct {
+	Shape []int
+	Data  interface{}
+}
+
+// Matrix is implemented by dense matrices, such as *mat.Dense of gonum.
+type Matrix interface {
+	Dims() (r, c int)
+	At(i, j int) float64
+}
+
+var tensorType = reflect.TypeOf(Tensor{})
+
+// NewMatrix returns a tensor of shape [len(rows), len(rows[0])] holding rows.
+func NewMatrix(rows [][]float64) (*Tensor, error) {
+	var c int
+	if len(rows) > 0 {
+		c = len(rows[0])
+	}
+	data := make([]float64, 0, len(rows)*c)
+	for _, row := range rows {
+		if len(row) != c {
+			return nil, &EncoderError{"ragged matrix rows"}
+		}
+		data = append(data, row...)
+	}
+	return &Tensor{Shape: []int{len(rows), c}, Data: data}, nil
+}
+
+// TensorOf returns a tensor holding the elements of m. Use mat.NewDense(t.Shape[0],
+// t.Shape[1], t.Data.([]float64)) to convert it back into a gonum matrix.
+func TensorOf(m Matrix) *Tensor {
+	r, c := m.Dims()
+	data := make([]float64, 0, r*c)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			data = append(data, m.At(i, j))
+		}
+	}
+	return &Tensor{Shape: []int{r, c}, Data: data}
+}
+
+// Rows returns elements of a 2-dimensional float64 tensor as rows.
+func (t *Tensor) Rows() ([][]float64, error) {
+	data, ok := t.Data.([]float64)
+	if !ok || len(t.Shape) != 2 || t.Shape[0] < 0 || t.Shape[1] < 0 {
+		return nil, &DecoderError{fmt.Sprintf("tensor of shape %v is not a float64 matrix", t.Shape)}
+	}
+	n, m := t.Shape[0], t.Shape[1]
+	if m > 0 && (len(data)%m != 0 || len(data)/m != n) || m == 0 && (len(data) != 0 || n > maxPrealloc) {
+		return nil, &DecoderLengthError{TensorType, uint64(n)}
+	}
+	rows := make([][]float64, n)
+	for i := range rows {
+		rows[i] = data[i*m : (i+1)*m : (i+1)*m]
+	}
+	return rows, nil
+}
+
+// tensorElem returns the wire type and size of elements of tensor data
+func tensorElem(data interface{}) (byte, int, int) {
+	switch x := data.(type) {
+	case []float64:
+		return tFloat64, 8, len(x)
+	case []float32:
+		return tFloat32, 4, len(x)
+	case []int64:
+		return tInt64, 8, len(x)
+	case []int32:
+		return tInt32, 4, len(x)
+	}
+	return 0, 0, 0
+}
+
+func (e *Encoder) EncodeTensor(t *Tensor) error {
+	elem, size, n := tensorElem(t.Data)
+	if elem == 0 {
+		return &EncoderError{fmt.Sprintf("unsupported tensor data %T", t.Data)}
+	}
+	if len(t.Shape) > math.MaxUint8 {
+		return &EncoderError{fmt.Sprintf("unsupported tensor rank %d", len(t.Shape))}
+	}
+	count := 1
+	for _, dim := range t.Shape {
+		if err := checkLength(dim); err != nil {
+			return err
+		}
+		count *= dim
+	}
+	if count != n {
+		return &EncoderError{fmt.Sprintf("tensor of shape %v holds %d elements", t.Shape, n)}
+	}
+
+	order := e.byteOrder()
+	p := make([]byte, 3+4*len(t.Shape)+size*n)
+	p[0], p[1], p[2] = tTensor, elem, byte(len(t.Shape))
+	for i, dim := range t.Shape {
+		order.PutUint32(p[3+4*i:], uint32(dim))
+	}
+	data := p[3+4*len(t.Shape):]
+	switch x := t.Data.(type) {
+	case []float64:
+		for i, f := range x {
+			order.PutUint64(data[8*i:], math.Float64bits(f))
+		}
+	case []float32:
+		for i, f := range x {
+			order.PutUint32(data[4*i:], math.Float32bits(f))
+		}
+	case []int64:
+		for i, f := range x {
+			order.PutUint64(data[8*i:], uint64(f))
+		}
+	case []int32:
+		for i, f := range x {
+			order.PutUint32(data[4*i:], uint32(f))
+		}
+	}
+	return e.writeRaw(p)
+}
+
+func tensorEncoder(e *Encoder, v reflect.Value) error {
+	t := v.Interface().(Tensor)
+	return e.EncodeTensor(&t)
+}
+
+// readTensorHeader reads element type and shape of a tensor, returning its raw header
+// and the size of its data
+func (d *Decoder) readTensorHeader() (byte, []int, []byte, int, error) {
+	p, err := d.next(2)
+	if err != nil {
+		return 0, nil, nil, 0, err
+	}
+	elem, rank := p[0], int(p[1])
+	size := sizeOf(elem)
+	if elem != tFloat64 && elem != tFloat32 && elem != tInt64 && elem != tInt32 {
+		return 0, nil, nil, 0, &DecoderError{fmt.Sprintf("invalid tensor element type %#x", elem)}
+	}
+	dims, err := d.next(4 * rank)
+	if err != nil {
+		return 0, nil, nil, 0, err
+	}
+	order := d.byteOrder()
+	shape := make([]int, rank)
+	count, max := uint64(1), uint64(maxInt/size)
+	left, known := d.inputLeft()
+	for i := range shape {
+		n := uint64(order.Uint32(dims[4*i:]))
+		if d.limit > 0 && n > uint64(d.limit) {
+			return 0, nil, nil, 0, &DecoderError{fmt.Sprintf("tensor dimension %d exceeds limit %d", n, d.limit)}
+		}
+		// dimensions are bounded even when another one is 0, as matrices hold a slice per row
+		if known && n > uint64(left) || n > 0 && count > max/n {
+			return 0, nil, nil, 0, &DecoderLengthError{TensorType, n}
+		}
+		shape[i], count = int(n), count*n
+	}
+	if d.limit > 0 && count > uint64(d.limit) {
+		return 0, nil, nil, 0, &DecoderError{fmt.Sprintf("tensor length %d exceeds limit %d", count, d.limit)}
+	}
+	return elem, shape, append(p[:2:2], dims...), int(count) * size, nil
+}
+
+func (d *Decoder) readTensor() (*Tensor, error) {
+	elem, shape, _, size, err := d.readTensorHeader()
+	if err != nil {
+		return nil, err
+	}
+	p, err := d.next(size)
+	if err != nil {
+		return nil, err
+	}
+	order := d.byteOrder()
+	t := &Tensor{Shape: shape}
+	switch elem {
+	case tFloat64:
+		data := make([]float64, len(p)/8)
+		for i := range data {
+			data[i] = math.Float64frombits(order.Uint64(p[8*i:]))
+		}
+		t.Data = data
+	case tFloat32:
+		data := make([]float32, len(p)/4)
+		for i := range data {
+			data[i] = math.Float32frombits(order.Uint32(p[4*i:]))
+		}
+		t.Data = data
+	case tInt64:
+		data := make([]int64, len(p)/8)
+		for i := range data {
+			data[i] = int64(order.Uint64(p[8*i:]))
+		}
+		t.Data = data
+	case tInt32:
+		data := make([]int32, len(p)/4)
+		for i := range data {
+			data[i] = int32(order.Uint32(p[4*i:]))
+		}
+		t.Data = data
+	}
+	return t, nil
+}
+
+// decodeTensor decodes a tensor into a Tensor, a [][]float64 matrix or a slice of its data
+func (d *Decoder) decodeTensor(v reflect.Value) error {
+	t, err := d.readTensor()
+	if err != nil {
+		return err
+	}
+	for v.Kind() == reflect.Ptr {
+		v = indirect(v)
+	}
+	switch {
+	case v.Type() == tensorType, v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		v.Set(reflect.ValueOf(*t))
+	case v.Type() == reflect.TypeOf([][]float64(nil)):
+		rows, err := t.Rows()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(rows))
+	case len(t.Shape) == 1 && v.Type() == reflect.TypeOf(t.Data):
+		v.Set(reflect.ValueOf(t.Data))
+	default:
+		return &DecoderTypeError{fmt.Sprintf("tensor%v", t.Shape), v.Type()}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+type testDense struct {
+	r, c int
+	data []float64
+}
+
+func (m *testDense) Dims() (int, int)    { return m.r, m.c }
+func (m *testDense) At(i, j int) float64 { return m.data[i*m.c+j] }
+
+func TestTensor(t *testing.T) {
+	rows := [][]float64{{1, 2, 3}, {4, 5, 6}}
+	x, err := NewMatrix(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, TensorOf(&testDense{2, 3, []float64{1, 2, 3, 4, 5, 6}}))
+
+	data, err := Marshal(x, Tensor{Shape: []int{2}, Data: []int32{7, 8}}, "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y1 [][]float64
+	var y2 []int32
+	var s string
+	if err = Unmarshal(data, &y1, &y2, &s); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, rows, y1)
+	assertEqual(t, []int32{7, 8}, y2)
+	assertEqual(t, "tail", s)
+
+	var z1 interface{}
+	var z2 *Tensor
+	if err = Unmarshal(data, &z1, &z2); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, *x, z1)
+	assertEqual(t, []int{2}, z2.Shape)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	if err = dec.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err = CopyValue(NewEncoder(out), dec); err != nil {
+		t.Fatal(err)
+	}
+	if err = dec.Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "tail", s)
+
+	var y3 []float32
+	if err = Unmarshal(data, &y3); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = Marshal(Tensor{Shape: []int{3}, Data: []float64{1}}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = NewMatrix([][]float64{{1}, {}}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestTensorLengthError(t *testing.T) {
+	data := []byte{tTensor, tFloat64, 2, 0x7f, 0xff, 0xff, 0xff, 0, 0, 0, 0}
+	var y [][]float64
+	err := Unmarshal(data, &y)
+	if _, ok := err.(*DecoderLengthError); !ok {
+		t.Fatalf("%T: %v", err, err)
+	}
+	err = NewDecoder(bufio.NewReader(bytes.NewReader(data))).Decode(&y)
+	if _, ok := err.(*DecoderLengthError); !ok {
+		t.Fatalf("%T: %v", err, err)
+	}
+
+	// shape [2^29, 2^30, 2^31] overflows the element count
+	data = []byte{tTensor, tFloat64, 3, 0x20, 0, 0, 0, 0x40, 0, 0, 0, 0x80, 0, 0, 0}
+	var z interface{}
+	err = NewDecoder(bufio.NewReader(bytes.NewReader(data))).Decode(&z)
+	if _, ok := err.(*DecoderLengthError); !ok {
+		t.Fatalf("%T: %v", err, err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// TimeLocation controls how the Encoder treats locations of time.Time values.
+type TimeLocation uint8
+
+const (
+	TimePreserve TimeLocation = iota // keep the zone offset of each time
+	TimeUTC                          // convert times to UTC
+	TimeDrop                         // keep the wall clock of times, but move them to UTC
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+const timeSize = 14 // seconds, nanoseconds and zone offset in minutes
+
+func timeEncoder(e *Encoder, v reflect.Value) error {
+	return e.EncodeTime(v.Interface().(time.Time))
+}
+
+// EncodeTime encodes t as a time value since format version 2, or as binary otherwise.
+func (e *Encoder) EncodeTime(t time.Time) error {
+	switch e.timeLocation {
+	case TimeUTC:
+		t = t.UTC()
+	case TimeDrop:
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	}
+	if e.formatVersion < 2 {
+		data, err := t.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		return e.EncodeBinary(data)
+	}
+
+	offset := -1 // UTC
+	if t.Location() != time.UTC {
+		_, offset = t.Zone()
+		if offset%60 != 0 || offset/60 < -32768 || offset/60 > 32767 {
+			return &EncoderError{fmt.Sprintf("unsupported zone offset %ds", offset)}
+		}
+		offset /= 60
+	}
+	order := e.byteOrder()
+	var p [1 + timeSize]byte
+	p[0] = tTime
+	order.PutUint64(p[1:], uint64(t.Unix()))
+	order.PutUint32(p[9:], uint32(t.Nanosecond()))
+	order.PutUint16(p[13:], uint16(offset))
+	return e.writeRaw(p[:])
+}
+
+func (d *Decoder) readTime() (time.Time, error) {
+	p, err := d.next(timeSize)
+	if err != nil {
+		return time.Time{}, err
+	}
+	order := d.byteOrder()
+	sec, nsec := int64(order.Uint64(p)), order.Uint32(p[8:])
+	if nsec >= 1e9 {
+		return time.Time{}, &DecoderError{fmt.Sprintf("invalid time nanoseconds %d", nsec)}
+	}
+	t := time.Unix(sec, int64(nsec))
+	if offset := int16(order.Uint16(p[12:])); offset == -1 {
+		t = t.UTC()
+	} else {
+		t = t.In(time.FixedZone("", int(offset)*60))
+	}
+	return t, nil
+}
+
+func (d *Decoder) decodeTime(v reflect.Value, t time.Time) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() != timeType {
+			return &DecoderTypeError{"time", v.Type()}
+		}
+		v.Set(reflect.ValueOf(t))
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return &DecoderTypeError{"time", v.Type()}
+		}
+		v.Set(reflect.ValueOf(t))
+	case reflect.Ptr:
+		return d.decodeTime(indirect(v), t)
+	default:
+		return &DecoderTypeError{"time", v.Type()}
+	}
+	return nil
+}
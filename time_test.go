@@ -0,0 +1,36 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEncodeTimeLocation(t *testing.T) {
+	x := time.Date(2018, 3, 1, 10, 30, 0, 5, time.FixedZone("EET", 2*60*60))
+	for _, tc := range []struct {
+		l TimeLocation
+		y time.Time
+	}{
+		{TimePreserve, x},
+		{TimeUTC, time.Date(2018, 3, 1, 8, 30, 0, 5, time.UTC)},
+		{TimeDrop, time.Date(2018, 3, 1, 10, 30, 0, 5, time.UTC)},
+	} {
+		data, err := Marshal([]interface{}{x}, WithTimeLocation(tc.l))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var y []time.Time
+		if err = Unmarshal(data, &y); err != nil {
+			t.Fatal(err)
+		}
+		if !y[0].Equal(tc.y) {
+			t.Fatalf("%d: %s != %s", tc.l, y[0], tc.y)
+		}
+		_, offset := y[0].Zone()
+		_, expected := tc.y.Zone()
+		assertEqual(t, expected, offset)
+	}
+}
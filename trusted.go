@@ -0,0 +1,42 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import "io"
+
+// sliceReader reads from an in-memory input that trusted decoders may reference directly
+type sliceReader struct {
+	p []byte
+}
+
+func (r *sliceReader) Read(p []byte) (int, error) {
+	if len(r.p) == 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, r.p)
+	r.p = r.p[n:]
+	return n, nil
+}
+
+func (r *sliceReader) Len() int {
+	return len(r.p)
+}
+
+// slice returns the next n bytes of a trusted in-memory input without copying them
+func (d *Decoder) slice(n int) ([]byte, bool) {
+	if !d.trusted || d.arena != nil || len(d.r.buf) > 0 {
+		return nil, false
+	}
+	r, ok := d.r.r.(*sliceReader)
+	if !ok || len(r.p) < n {
+		return nil, false
+	}
+	p := r.p[:n:n]
+	r.p = r.p[n:]
+	d.r.consume(p)
+	return p, true
+}
@@ -0,0 +1,371 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type encoderFunc func(e *Encoder, v reflect.Value) error
+
+const defaultMaxDepth = 100000
+
+var encoderCache = struct {
+	sync.RWMutex
+	m map[reflect.Type]encoderFunc
+}{m: make(map[reflect.Type]encoderFunc)}
+
+// typeEncoder returns the cached encoder of type t, compiling it on first use
+func typeEncoder(t reflect.Type) encoderFunc {
+	encoderCache.RLock()
+	f := encoderCache.m[t]
+	encoderCache.RUnlock()
+	if f != nil {
+		return f
+	}
+	return compileEncoder(t)
+}
+
+func compileEncoder(t reflect.Type) (f encoderFunc) {
+	// recursive types get an indirect encoder that waits for the real one
+	var wg sync.WaitGroup
+	wg.Add(1)
+	encoderCache.Lock()
+	if f = encoderCache.m[t]; f != nil {
+		encoderCache.Unlock()
+		return f
+	}
+	encoderCache.m[t] = func(e *Encoder, v reflect.Value) error {
+		wg.Wait()
+		return f(e, v)
+	}
+	encoderCache.Unlock()
+
+	f = newTypeEncoder(t)
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.Struct, reflect.Interface, reflect.Ptr:
+		f = depthEncoder(t, f)
+	}
+	wg.Done()
+	encoderCache.Lock()
+	encoderCache.m[t] = f
+	encoderCache.Unlock()
+	return f
+}
+
+// depthEncoder fails encoding of values nested deeper than the limit, which also stops cyclic data
+func depthEncoder(t reflect.Type, f encoderFunc) encoderFunc {
+	return func(e *Encoder, v reflect.Value) error {
+		limit := e.maxDepth
+		if limit <= 0 {
+			limit = defaultMaxDepth
+		}
+		if e.depth >= limit {
+			return &EncoderError{fmt.Sprintf("%s nested deeper than %d levels", t, limit)}
+		}
+		e.depth++
+		err := f(e, v)
+		e.depth--
+		return err
+	}
+}
+
+func newTypeEncoder(t reflect.Type) encoderFunc {
+	if f, ok := builtinEncoders[t]; ok {
+		return f
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return boolEncoder
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return enumEncoder(t, intEncoder)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return enumEncoder(t, uintEncoder)
+	case reflect.Float32, reflect.Float64:
+		return floatEncoder
+	case reflect.String:
+		return stringEncoder
+	case reflect.Slice:
+		if t == rawMessageType {
+			return rawMessageEncoder
+		}
+		if t == bytesType {
+			return bytesEncoder
+		}
+		return newSliceEncoder(t)
+	case reflect.Array:
+		elem := typeEncoder(t.Elem())
+		return func(e *Encoder, v reflect.Value) error {
+			return e.encodeArray(v, elem)
+		}
+	case reflect.Map:
+		if isSetType(t) {
+			return setEncoder
+		}
+		return mapEncoder
+	case reflect.Struct:
+		if t == numberType {
+			return numberEncoder
+		}
+		if isNullType(t) {
+			return newNullEncoder(t)
+		}
+		if t == tensorType {
+			return tensorEncoder
+		}
+		if t == timeType {
+			return timeEncoder
+		}
+		if t == extType {
+			return extEncoder
+		}
+		if t == compressedValueType {
+			return compressedEncoder
+		}
+		if t == syncMapType {
+			return syncMapEncoder
+		}
+		if t == envelopeType {
+			return envelopeEncoder
+		}
+		if t.Implements(orderedEncoderType) {
+			return orderedMapEncoder
+		}
+		return newStructEncoder(t)
+	case reflect.Interface:
+		return interfaceEncoder
+	case reflect.Ptr:
+		return newPtrEncoder(t)
+	}
+	return unsupportedEncoder
+}
+
+func boolEncoder(e *Encoder, v reflect.Value) error {
+	return e.EncodeBool(v.Bool())
+}
+
+func intEncoder(e *Encoder, v reflect.Value) error {
+	if e.exactKinds {
+		return e.EncodeNumber(exactNumber(v))
+	}
+	return e.EncodeInt(v.Int())
+}
+
+func uintEncoder(e *Encoder, v reflect.Value) error {
+	if e.exactKinds {
+		return e.EncodeNumber(exactNumber(v))
+	}
+	return e.EncodeUint(v.Uint())
+}
+
+// enumEncoder encodes names of registered enums, which may be registered after the encoder is compiled
+func enumEncoder(t reflect.Type, f encoderFunc) encoderFunc {
+	if t.PkgPath() == "" {
+		return f
+	}
+	return func(e *Encoder, v reflect.Value) error {
+		if x, ok := enumOf(v.Type()); ok {
+			if name, ok := x.names[enumBits(v)]; ok {
+				return e.EncodeString(name)
+			}
+		}
+		return f(e, v)
+	}
+}
+
+func floatEncoder(e *Encoder, v reflect.Value) error {
+	if e.exactKinds {
+		if err := checkFloat(v.Float()); err != nil {
+			return err
+		}
+		return e.EncodeNumber(exactNumber(v))
+	}
+	return e.EncodeFloat(v.Float())
+}
+
+func stringEncoder(e *Encoder, v reflect.Value) error {
+	return e.EncodeString(v.String())
+}
+
+func bytesEncoder(e *Encoder, v reflect.Value) error {
+	if e.preserveEmpty && v.IsNil() {
+		return e.EncodeNil()
+	}
+	return e.EncodeBinary(v.Bytes())
+}
+
+func newSliceEncoder(t reflect.Type) encoderFunc {
+	elem := typeEncoder(t.Elem())
+	return func(e *Encoder, v reflect.Value) error {
+		if e.preserveEmpty && v.IsNil() {
+			return e.EncodeNil()
+		}
+		return e.encodeArray(v, elem)
+	}
+}
+
+func mapEncoder(e *Encoder, v reflect.Value) error {
+	if e.preserveEmpty && v.IsNil() {
+		return e.EncodeNil()
+	}
+	return e.encodeMap(v)
+}
+
+func numberEncoder(e *Encoder, v reflect.Value) error {
+	return e.EncodeNumber(Number{reflect.Kind(v.Field(0).Uint()), v.Field(1).Uint()})
+}
+
+func newStructEncoder(t reflect.Type) encoderFunc {
+	si := structInfoOf(t)
+	encs := make([]encoderFunc, len(si.fields))
+	for i, sf := range si.fields {
+		encs[i] = typeEncoder(t.Field(sf.index).Type)
+	}
+	return func(e *Encoder, v reflect.Value) error {
+		return e.encodeObject(v, si, encs)
+	}
+}
+
+func interfaceEncoder(e *Encoder, v reflect.Value) error {
+	if v.IsNil() {
+		return e.EncodeNil()
+	}
+	if name, ok := unionName(v.Elem().Type()); ok {
+		return e.encodeUnion(name, v.Elem())
+	}
+	if p := v.Elem(); e.typedNil && p.Kind() == reflect.Ptr && p.IsNil() {
+		if name, ok := unionName(p.Type().Elem()); ok {
+			return e.encodeUnion(typedNilPrefix+name, p)
+		}
+	}
+	return e.EncodeValue(v.Elem())
+}
+
+func newPtrEncoder(t reflect.Type) encoderFunc {
+	elem := typeEncoder(t.Elem())
+	return func(e *Encoder, v reflect.Value) error {
+		if v.IsNil() {
+			return e.EncodeNil()
+		}
+		return elem(e, v.Elem())
+	}
+}
+
+func unsupportedEncoder(e *Encoder, v reflect.Value) error {
+	if e.errorOnUnsupported && !isSupported(v) {
+		return &EncoderError{fmt.Sprintf("unsupported type %s", v.Type())}
+	}
+	return e.EncodeNil()
+}
+
+type decoderFunc func(d *Decoder, t byte, v reflect.Value) error
+
+var decoderCache = struct {
+	sync.RWMutex
+	m map[reflect.Type]decoderFunc
+}{m: make(map[reflect.Type]decoderFunc)}
+
+// typeDecoder returns the cached decoder into values of type t, compiling it on first use
+func typeDecoder(t reflect.Type) decoderFunc {
+	decoderCache.RLock()
+	f := decoderCache.m[t]
+	decoderCache.RUnlock()
+	if f != nil {
+		return f
+	}
+	return compileDecoder(t)
+}
+
+func compileDecoder(t reflect.Type) (f decoderFunc) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	decoderCache.Lock()
+	if f = decoderCache.m[t]; f != nil {
+		decoderCache.Unlock()
+		return f
+	}
+	decoderCache.m[t] = func(d *Decoder, tt byte, v reflect.Value) error {
+		wg.Wait()
+		return f(d, tt, v)
+	}
+	decoderCache.Unlock()
+
+	f = newTypeDecoder(t)
+	wg.Done()
+	decoderCache.Lock()
+	decoderCache.m[t] = f
+	decoderCache.Unlock()
+	return f
+}
+
+// newTypeDecoder specializes decoding of arrays and objects into t, other values are decoded by their type
+func newTypeDecoder(t reflect.Type) decoderFunc {
+	dec := newKindDecoder(t)
+	if isValidator(t) {
+		dec = newValidatingDecoder(dec)
+	}
+	return newCoercingDecoder(t, dec)
+}
+
+func newKindDecoder(t reflect.Type) decoderFunc {
+	if f, ok := builtinDecoders[t]; ok {
+		return f
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if isNullType(t) {
+			return newNullDecoder(t)
+		}
+		if t == syncMapType {
+			return syncMapDecoder
+		}
+		if t == envelopeType {
+			return envelopeDecoder
+		}
+		if reflect.PtrTo(t).Implements(orderedDecoderType) {
+			return orderedMapDecoder
+		}
+		if t != numberType && t != extType {
+			return newStructDecoder(t)
+		}
+	case reflect.Slice:
+		if t == rawMessageType {
+			return rawMessageDecoder
+		}
+	case reflect.Ptr:
+		return newPtrDecoder(t)
+	}
+	return (*Decoder).decodeType
+}
+
+func newPtrDecoder(t reflect.Type) decoderFunc {
+	elem := typeDecoder(t.Elem())
+	return func(d *Decoder, tt byte, v reflect.Value) error {
+		switch typeOf(tt) {
+		case NilType, UnionType:
+			return d.decodeType(tt, v)
+		}
+		return elem(d, tt, indirect(v))
+	}
+}
+
+func newStructDecoder(t reflect.Type) decoderFunc {
+	si := structInfoOf(t)
+	decs := make([]decoderFunc, t.NumField())
+	for _, sf := range si.fields {
+		decs[sf.index] = typeDecoder(t.Field(sf.index).Type)
+	}
+	return func(d *Decoder, tt byte, v reflect.Value) error {
+		if typeOf(tt) != ObjectType {
+			return d.decodeType(tt, v)
+		}
+		n, err := d.readSize(tt)
+		if err != nil {
+			return err
+		}
+		return d.decodeStruct(v, n, si, decs)
+	}
+}
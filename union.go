@@ -0,0 +1,133 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var unions = struct {
+	sync.RWMutex
+	names   map[reflect.Type]string
+	types   map[string]reflect.Type
+	aliases map[string]string
+}{
+	names:   make(map[reflect.Type]string),
+	types:   make(map[string]reflect.Type),
+	aliases: make(map[string]string),
+}
+
+// Register records the concrete type of v under name, so values of that type held
+// in interfaces are encoded as tagged unions and decoded back into the same type.
+// Name may end with a version, as in "acme.Order@2".
+func Register(name string, v interface{}) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		panic("godat: Register nil value")
+	}
+	checkUnionName(name)
+
+	unions.Lock()
+	defer unions.Unlock()
+	if n, ok := unions.names[t]; ok && n != name {
+		panic(fmt.Sprintf("godat: type %s registered twice (%q and %q)", t, n, name))
+	}
+	if u, ok := unions.types[name]; ok && u != t {
+		panic(fmt.Sprintf("godat: name %q registered twice (%s and %s)", name, u, t))
+	}
+	if _, ok := unions.aliases[name]; ok {
+		panic(fmt.Sprintf("godat: name %q already registered as alias", name))
+	}
+	unions.names[t] = name
+	unions.types[name] = t
+}
+
+// RegisterAlias makes unions tagged with alias decode as the type registered under name,
+// so values of renamed types or of their older versions can still be decoded.
+func RegisterAlias(alias, name string) {
+	checkUnionName(alias)
+
+	unions.Lock()
+	defer unions.Unlock()
+	if _, ok := unions.types[alias]; ok {
+		panic(fmt.Sprintf("godat: alias %q already registered as name", alias))
+	}
+	if n, ok := unions.aliases[alias]; ok && n != name {
+		panic(fmt.Sprintf("godat: alias %q registered twice (%q and %q)", alias, n, name))
+	}
+	unions.aliases[alias] = name
+}
+
+func checkUnionName(name string) {
+	if i := strings.LastIndexByte(name, '@'); i >= 0 {
+		if n, err := strconv.Atoi(name[i+1:]); err != nil || n <= 0 || i == 0 {
+			panic(fmt.Sprintf("godat: invalid versioned name %q", name))
+		}
+	}
+}
+
+func unionName(t reflect.Type) (string, bool) {
+	unions.RLock()
+	name, ok := unions.names[t]
+	unions.RUnlock()
+	return name, ok
+}
+
+// typedNilPrefix marks unions of nil pointers to types registered under the rest of the name
+const typedNilPrefix = "*"
+
+func unionType(name string) (reflect.Type, bool) {
+	unions.RLock()
+	t, ok := unions.types[name]
+	if !ok {
+		t, ok = unions.types[unions.aliases[name]]
+	}
+	unions.RUnlock()
+	if !ok && strings.HasPrefix(name, typedNilPrefix) {
+		if t, ok = unionType(name[len(typedNilPrefix):]); ok {
+			t = reflect.PtrTo(t)
+		}
+	}
+	return t, ok
+}
+
+func (e *Encoder) encodeUnion(name string, v reflect.Value) error {
+	if err := e.writeType(tUnion); err != nil {
+		return err
+	}
+	if err := e.EncodeString(name); err != nil {
+		return err
+	}
+	return e.EncodeValue(v)
+}
+
+func (d *Decoder) decodeUnion(v reflect.Value) error {
+	p, err := d.decodeBytes(reflect.TypeOf(""))
+	if err != nil {
+		return err
+	}
+	name := string(p)
+	t, ok := unionType(name)
+	if !ok {
+		return &DecoderError{fmt.Sprintf("unknown union variant %q", name)}
+	}
+
+	if v.Kind() != reflect.Interface {
+		// decode the payload into a concrete target directly
+		return d.decodeValue(v.Addr())
+	}
+	if !t.Implements(v.Type()) {
+		return &DecoderTypeError{fmt.Sprintf("union(%s)", name), v.Type()}
+	}
+	x := reflect.New(t)
+	if err = d.decodeValue(x); err != nil {
+		return err
+	}
+	v.Set(x.Elem())
+	return nil
+}
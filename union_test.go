@@ -0,0 +1,193 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type testShape interface {
+	Area() float64
+}
+
+type testCircle struct {
+	R float64
+}
+
+func (c testCircle) Area() float64 {
+	return 3 * c.R * c.R
+}
+
+type testSquare struct {
+	Side float64
+}
+
+func (s *testSquare) Area() float64 {
+	return s.Side * s.Side
+}
+
+type testDrawing struct {
+	Main   testShape
+	Shapes []testShape
+	Any    interface{}
+}
+
+func init() {
+	Register("circle", testCircle{})
+	Register("square", &testSquare{})
+}
+
+func TestUnion(t *testing.T) {
+	x := testDrawing{
+		Main:   testCircle{2},
+		Shapes: []testShape{&testSquare{3}, testCircle{1}, nil},
+		Any:    testCircle{5},
+	}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y testDrawing
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	if err = dec.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if err = dec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = CopyValue(NewEncoder(&buf), NewDecoder(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, data, buf.Bytes())
+}
+
+func TestUnionConcrete(t *testing.T) {
+	var x testShape = testCircle{2}
+	data, err := Marshal(&x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y testCircle
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+
+	var z testSquare
+	err = Unmarshal(data, &z)
+	if _, ok := err.(*DecoderTypeError); !ok {
+		t.Fatal(err)
+	}
+}
+
+func TestUnionError(t *testing.T) {
+	var s testShape = testCircle{2}
+	data, err := Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y interface {
+		Perimeter() float64
+	}
+	err = Unmarshal(data, &y)
+	if _, ok := err.(*DecoderTypeError); !ok {
+		t.Fatal(err)
+	}
+	_ = err.Error()
+
+	data = append([]byte{tUnion, tString8, 3}, "dot"...)
+	data = append(data, tNil)
+	err = Unmarshal(data, &s)
+	if _, ok := err.(*DecoderError); !ok {
+		t.Fatal(err)
+	}
+	_ = err.Error()
+}
+
+type testOrderV2 struct {
+	ID    int
+	Total float64
+}
+
+func TestUnionAlias(t *testing.T) {
+	Register("test.Order@2", testOrderV2{})
+	RegisterAlias("test.Order@1", "test.Order@2")
+	RegisterAlias("legacy.Order", "test.Order@2")
+
+	for _, name := range []string{"test.Order@1", "legacy.Order"} {
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(buf)
+		if err := enc.encodeUnion(name, reflect.ValueOf(map[string]interface{}{"ID": 7})); err != nil {
+			t.Fatal(err)
+		}
+		var x interface{}
+		if err := Unmarshal(buf.Bytes(), &x); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, testOrderV2{ID: 7}, x)
+	}
+
+	for _, name := range []string{"test.Order@", "test.Order@0", "@1", "test.Order@x"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal(name)
+				}
+			}()
+			Register(name, struct{ X int }{})
+		}()
+	}
+}
+
+func TestUnionTypedNil(t *testing.T) {
+	x := testDrawing{
+		Main:   (*testCircle)(nil),
+		Shapes: []testShape{(*testSquare)(nil), nil},
+		Any:    (*testCircle)(nil),
+	}
+	data, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y testDrawing
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, nil, y.Any)
+
+	data, err = Marshal(x, WithTypedNil())
+	if err != nil {
+		t.Fatal(err)
+	}
+	y = testDrawing{}
+	if err = Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, x, y)
+	if _, ok := y.Any.(*testCircle); !ok || y.Any.(*testCircle) != nil {
+		t.Fatal("typed nil should be restored")
+	}
+
+	var z interface{}
+	data, err = Marshal((*testCircle)(nil), WithTypedNil())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Unmarshal(data, &z); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, nil, z)
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import "reflect"
+
+// Validator is implemented by types that check their decoded values WithValidation.
+type Validator interface {
+	Validate() error
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// isValidator reports whether values of t or pointers to them implement Validator
+func isValidator(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return false // validated by the type pointed to or decoded into
+	}
+	return t.Implements(validatorType) || reflect.PtrTo(t).Implements(validatorType)
+}
+
+func newValidatingDecoder(dec decoderFunc) decoderFunc {
+	return func(d *Decoder, tt byte, v reflect.Value) error {
+		if err := dec(d, tt, v); err != nil || !d.validate {
+			return err
+		}
+		if v.CanAddr() {
+			return v.Addr().Interface().(Validator).Validate()
+		}
+		return v.Interface().(Validator).Validate()
+	}
+}
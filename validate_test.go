@@ -0,0 +1,59 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"errors"
+	"testing"
+)
+
+var errNegativeQty = errors.New("negative quantity")
+
+type testOrderLine struct {
+	Qty int
+}
+
+func (l *testOrderLine) Validate() error {
+	if l.Qty < 0 {
+		return errNegativeQty
+	}
+	return nil
+}
+
+type testOrder struct {
+	Lines []testOrderLine
+	Extra *testOrderLine
+	ByKey map[string]testOrderLine
+}
+
+func TestDecodeValidation(t *testing.T) {
+	valid := testOrder{Lines: []testOrderLine{{1}}, Extra: &testOrderLine{2}}
+	for _, x := range []testOrder{
+		{Lines: []testOrderLine{{1}, {-1}}},
+		{Extra: &testOrderLine{-1}},
+		{ByKey: map[string]testOrderLine{"a": {-1}}},
+	} {
+		data, err := Marshal(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var y testOrder
+		if err = Unmarshal(data, &y); err != nil {
+			t.Fatal(err)
+		}
+		if err = Unmarshal(data, &y, WithValidation()); err != errNegativeQty {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := Marshal(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y testOrder
+	if err = Unmarshal(data, &y, WithValidation()); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, valid, y)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Vector is an entry of the conformance corpus: values encoded with the named options.
+// Values are described in JSON, with binary data in base64 and times in RFC 3339.
+type Vector struct {
+	Name    string        `json:"name"`
+	Options []string      `json:"options,omitempty"`
+	Values  []interface{} `json:"values"`
+	Hex     string        `json:"hex"`
+}
+
+type vectorOption struct {
+	name string
+	opt  Option
+}
+
+var (
+	vCanonical  = vectorOption{"canonical", WithCanonical()}
+	vExactKinds = vectorOption{"exact_kinds", WithExactKinds()}
+	vValueCount = vectorOption{"value_count", WithValueCount()}
+	vChecksum   = vectorOption{"checksum", WithChecksum()}
+	vLittle     = vectorOption{"little_endian", WithLittleEndian()}
+	vVersion2   = vectorOption{"format_version=2", WithFormatVersion(2)}
+)
+
+func conformanceCases() []struct {
+	name   string
+	opts   []vectorOption
+	values []interface{}
+} {
+	at := time.Date(2018, 3, 1, 10, 30, 0, 500, time.FixedZone("", 2*60*60))
+	type c = struct {
+		name   string
+		opts   []vectorOption
+		values []interface{}
+	}
+	one := func(name string, v interface{}, opts ...vectorOption) c {
+		return c{name, opts, []interface{}{v}}
+	}
+	return []c{
+		one("nil", nil),
+		one("true", true),
+		one("false", false),
+		one("int8", int64(-128)),
+		one("int16", int64(-129)),
+		one("int32", int64(math.MinInt32)),
+		one("int64", int64(math.MinInt64)),
+		one("uint8", uint64(255)),
+		one("uint16", uint64(256)),
+		one("uint32", uint64(math.MaxUint32)),
+		one("uint64", uint64(math.MaxUint64)),
+		one("float32", 1.5),
+		one("float64", 0.1),
+		one("exact int16", int16(1), vExactKinds),
+		one("exact float64", 1.5, vExactKinds),
+		one("string", "godat"),
+		one("string unicode", "é漢\U0001F600"),
+		one("string16", strings.Repeat("x", 256)),
+		one("binary", []byte{0, 1, 0xFF}),
+		one("array empty", []interface{}{}),
+		one("array nested", []interface{}{int64(1), []interface{}{"a", nil}}),
+		one("object", map[string]interface{}{"b": int64(1), "a": []interface{}{true}}, vCanonical),
+		one("tensor", Tensor{Shape: []int{2, 2}, Data: []float32{1, 2, 3, 4}}),
+		c{"value count", []vectorOption{vValueCount}, []interface{}{int64(1), "a"}},
+		one("checksum", "a", vChecksum),
+		one("little endian", []interface{}{int64(300), 2.5, "a"}, vLittle),
+		one("varint", int64(-1)<<40, vVersion2),
+		one("uvarint", uint64(1)<<40, vVersion2),
+		one("time", at, vVersion2),
+		one("time utc", at.UTC(), vVersion2),
+		one("ext", Ext{Code: 7, Data: []byte("x")}, vVersion2),
+		one("version 2 little endian", []interface{}{int64(1) << 40, at}, vVersion2, vLittle),
+	}
+}
+
+// ConformanceVectors returns the conformance corpus, which implementations
+// of the format in other languages can use to check byte-exact compatibility.
+func ConformanceVectors() ([]Vector, error) {
+	cases := conformanceCases()
+	vv := make([]Vector, len(cases))
+	for i, c := range cases {
+		args := append([]interface{}(nil), c.values...)
+		var names []string
+		for _, o := range c.opts {
+			args = append(args, o.opt)
+			names = append(names, o.name)
+		}
+		data, err := Marshal(args[0], args[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		vv[i] = Vector{c.name, names, c.values, hex.EncodeToString(data)}
+	}
+	return vv, nil
+}
+
+// WriteConformanceVectors writes the conformance corpus to w as a JSON array.
+func WriteConformanceVectors(w io.Writer) error {
+	vv, err := ConformanceVectors()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(vv)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2017-2018 Alexander Lokhman. All rights reserved.
+// This source code and usage is governed by a MIT style license that can be found in the LICENSE file.
+
+package godat
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestConformanceVectors(t *testing.T) {
+	vv, err := ConformanceVectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := map[string]string{
+		"int16":  "63ff7f",
+		"uint64": "a3ffffffffffffffff",
+		"string": "5305676f646174",
+		"object": "4f025301614101545301624901",
+	}
+	for _, v := range vv {
+		data, err := hex.DecodeString(v.Hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h, ok := golden[v.Name]; ok && h != v.Hex {
+			t.Fatalf("%s: %s != %s", v.Name, v.Hex, h)
+		}
+		dec := NewDecoder(bytes.NewReader(data))
+		for range v.Values {
+			var x interface{}
+			if err = dec.Decode(&x); err != nil {
+				t.Fatalf("%s: %v", v.Name, err)
+			}
+		}
+		var x interface{}
+		if err = dec.Decode(&x); err == nil {
+			t.Fatalf("%s: trailing data", v.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = WriteConformanceVectors(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var x []map[string]interface{}
+	if err = json.Unmarshal(buf.Bytes(), &x); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(vv), len(x))
+}